@@ -0,0 +1,194 @@
+package supervisorkratos
+
+import (
+	"context"
+	"os"
+	"slices"
+	"strings"
+
+	"github.com/orzkratos/supervisorkratos/supervisorrpc"
+	"github.com/pkg/errors"
+)
+
+// SupervisorClient supervisord XML-RPC methods used by Apply, implemented by *supervisorrpc.Client
+// Apply 使用的 supervisord XML-RPC 方法，由 *supervisorrpc.Client 实现
+type SupervisorClient interface {
+	ReloadConfig(ctx context.Context) (*supervisorrpc.ReloadResult, error)
+	AddProcessGroup(ctx context.Context, name string) error
+	RemoveProcessGroup(ctx context.Context, name string) error
+	StopProcessGroup(ctx context.Context, name string, wait bool) ([]*supervisorrpc.ProcessStatus, error)
+}
+
+// ApplyAction action taken on a process group
+// 对进程组执行的操作
+type ApplyAction string
+
+const (
+	ApplyAdd     ApplyAction = "add"     // Group added and autostarted // 添加组并自动启动
+	ApplyRemove  ApplyAction = "remove"  // Group stopped and removed // 停止并删除组
+	ApplyRestart ApplyAction = "restart" // Group stopped, removed and added back // 停止、删除后重新添加组
+)
+
+// ApplyStep one action of Apply on a process group
+// Apply 对某个进程组执行的一个操作
+type ApplyStep struct {
+	Group  string      // Process group name // 进程组名称
+	Action ApplyAction // Action taken // 执行的操作
+}
+
+// ApplyReport result of Apply
+// Apply 的结果
+type ApplyReport struct {
+	Write      *WriteReport                // File changes // 文件变更
+	Reload     *supervisorrpc.ReloadResult // Result of reloadConfig // reloadConfig 的结果
+	Steps      []*ApplyStep                // Actions taken in order // 按顺序执行的操作
+	Skipped    []string                    // Pending groups of other files, left for their owners // 其他文件的待处理组，留给其所有者处理
+	RolledBack bool                        // File restored after supervisord rejected the config // supervisord 拒绝配置后文件已恢复
+}
+
+// Apply write <group>.conf and apply it to a running supervisord, like "supervisorctl reread && supervisorctl update"
+// Only process groups defined by this file (before or after the write) are touched
+// When reloadConfig fails the previous file is restored and the error is returned
+// In dry-run mode only the file changes are reported and supervisord is not called
+//
+// 写入 <group>.conf 并应用到运行中的 supervisord，等同于 "supervisorctl reread && supervisorctl update"
+// 只处理该文件（写入前或写入后）定义的进程组
+// reloadConfig 失败时恢复之前的文件并返回错误
+// 演练模式下只报告文件变更，不调用 supervisord
+func (w *ConfWriter) Apply(ctx context.Context, client SupervisorClient, group *GroupConfig) (*ApplyReport, error) {
+	if err := group.Validate(); err != nil {
+		return nil, err
+	}
+	var groups []string
+	for _, names := range group.ProcessNames() {
+		for _, name := range names {
+			groupName, _, _ := strings.Cut(name, ":")
+			groups = append(groups, groupName)
+		}
+	}
+	return w.applyFile(ctx, client, group.Name, groups, func() (*WriteReport, error) {
+		return w.WriteGroup(group)
+	})
+}
+
+// ApplyProgram write <program>.conf and apply it to a running supervisord, same as Apply
+// 写入 <program>.conf 并应用到运行中的 supervisord，与 Apply 相同
+func (w *ConfWriter) ApplyProgram(ctx context.Context, client SupervisorClient, program *ProgramConfig) (*ApplyReport, error) {
+	if err := program.Validate(); err != nil {
+		return nil, err
+	}
+	return w.applyFile(ctx, client, program.Name, []string{program.Name}, func() (*WriteReport, error) {
+		return w.WriteProgram(program)
+	})
+}
+
+// ApplyRemove remove owned <name>.conf and stop and remove the process groups it defined
+// 删除自有的 <name>.conf，并停止和删除其定义的进程组
+func (w *ConfWriter) ApplyRemove(ctx context.Context, client SupervisorClient, name string) (*ApplyReport, error) {
+	return w.applyFile(ctx, client, name, nil, func() (*WriteReport, error) {
+		return w.Remove(name)
+	})
+}
+
+// applyFile change <name>.conf with write then reread/update the process groups of the file
+// groups are the process groups the file defines after the write
+//
+// 使用 write 修改 <name>.conf，然后对该文件的进程组执行 reread/update
+// groups 是写入后该文件定义的进程组
+func (w *ConfWriter) applyFile(ctx context.Context, client SupervisorClient, name string, groups []string, write func() (*WriteReport, error)) (*ApplyReport, error) {
+	path, err := w.confPath(name + ".conf")
+	if err != nil {
+		return nil, err
+	}
+	previous, err := os.ReadFile(path)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, errors.WithMessagef(err, "read %s", path)
+	}
+	hasPrevious := err == nil
+
+	writeReport, err := write()
+	if err != nil {
+		return nil, err
+	}
+	report := &ApplyReport{Write: writeReport}
+	if w.DryRun {
+		return report, nil
+	}
+
+	// Groups owned by this file, old groups are removed by update when the file drops them
+	// 该文件拥有的组，文件删掉的旧组会被 update 移除
+	owned := make(map[string]bool)
+	if hasPrevious {
+		if sections, err := ParseIni(string(previous)); err == nil {
+			for _, groupName := range processGroupNames(sections) {
+				owned[groupName] = true
+			}
+		}
+	}
+	for _, groupName := range groups {
+		owned[groupName] = true
+	}
+
+	reload, err := client.ReloadConfig(ctx)
+	if err != nil {
+		if rollbackErr := w.rollback(path, previous, hasPrevious); rollbackErr != nil {
+			return report, errors.WithMessagef(err, "reload config (rollback failed: %v)", rollbackErr)
+		}
+		report.RolledBack = true
+		return report, errors.WithMessage(err, "reload config")
+	}
+	report.Reload = reload
+
+	// Same order as supervisorctl update: removed, changed, added
+	// 与 supervisorctl update 顺序一致：删除、变更、新增
+	for _, item := range []struct {
+		names  []string
+		action ApplyAction
+	}{
+		{reload.Removed, ApplyRemove},
+		{reload.Changed, ApplyRestart},
+		{reload.Added, ApplyAdd},
+	} {
+		for _, groupName := range item.names {
+			if !owned[groupName] {
+				report.Skipped = append(report.Skipped, groupName)
+				continue
+			}
+			if err := applyGroupAction(ctx, client, groupName, item.action); err != nil {
+				return report, errors.WithMessagef(err, "%s group %s", item.action, groupName)
+			}
+			report.Steps = append(report.Steps, &ApplyStep{Group: groupName, Action: item.action})
+		}
+	}
+	slices.Sort(report.Skipped)
+	return report, nil
+}
+
+func applyGroupAction(ctx context.Context, client SupervisorClient, name string, action ApplyAction) error {
+	if action == ApplyRemove || action == ApplyRestart {
+		if _, err := client.StopProcessGroup(ctx, name, true); err != nil && !supervisorrpc.IsFault(err, supervisorrpc.FaultBadName) {
+			return err
+		}
+		if err := client.RemoveProcessGroup(ctx, name); err != nil {
+			return err
+		}
+	}
+	if action == ApplyAdd || action == ApplyRestart {
+		if err := client.AddProcessGroup(ctx, name); err != nil && !supervisorrpc.IsFault(err, supervisorrpc.FaultAlreadyAdded) {
+			return err
+		}
+	}
+	return nil
+}
+
+// rollback restore previous file content, or remove the file when there was none
+// 恢复之前的文件内容，之前没有文件时删除该文件
+func (w *ConfWriter) rollback(path string, previous []byte, hasPrevious bool) error {
+	if hasPrevious {
+		return writeFileAtomic(path, previous)
+	}
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
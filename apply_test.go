@@ -0,0 +1,119 @@
+package supervisorkratos_test
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/orzkratos/supervisorkratos"
+	"github.com/orzkratos/supervisorkratos/supervisorrpc"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeSupervisor records XML-RPC calls and answers reloadConfig with a preset result
+// fakeSupervisor 记录 XML-RPC 调用，并用预设结果应答 reloadConfig
+type fakeSupervisor struct {
+	calls     []string
+	reload    *supervisorrpc.ReloadResult
+	reloadErr error
+}
+
+func (f *fakeSupervisor) ReloadConfig(ctx context.Context) (*supervisorrpc.ReloadResult, error) {
+	f.calls = append(f.calls, "reloadConfig")
+	return f.reload, f.reloadErr
+}
+
+func (f *fakeSupervisor) AddProcessGroup(ctx context.Context, name string) error {
+	f.calls = append(f.calls, "addProcessGroup "+name)
+	return nil
+}
+
+func (f *fakeSupervisor) RemoveProcessGroup(ctx context.Context, name string) error {
+	f.calls = append(f.calls, "removeProcessGroup "+name)
+	return nil
+}
+
+func (f *fakeSupervisor) StopProcessGroup(ctx context.Context, name string, wait bool) ([]*supervisorrpc.ProcessStatus, error) {
+	f.calls = append(f.calls, "stopProcessGroup "+name)
+	return nil, nil
+}
+
+func TestConfWriterApply(t *testing.T) {
+	// Test apply restarts changed groups of this file and skips groups of other files
+	// 测试应用会重启该文件中变化的组，并跳过其他文件的组
+	dir := t.TempDir()
+	group := supervisorkratos.NewGroupConfig("services").
+		AddProgram(supervisorkratos.NewProgramConfig("api", "/opt/api", "deploy", "/var/log/services")).
+		AddEventListener(supervisorkratos.NewEventListenerConfig("memmon", "/opt/memmon", "deploy", "/var/log/services", supervisorkratos.EventTick60))
+	writer := supervisorkratos.NewConfWriter(dir)
+
+	client := &fakeSupervisor{reload: &supervisorrpc.ReloadResult{
+		Added:   []string{"memmon"},
+		Changed: []string{"services", "other"},
+	}}
+	report, err := writer.Apply(context.Background(), client, group)
+	require.NoError(t, err)
+	require.Equal(t, []string{"services.conf"}, report.Write.Added)
+	require.Equal(t, []*supervisorkratos.ApplyStep{
+		{Group: "services", Action: supervisorkratos.ApplyRestart},
+		{Group: "memmon", Action: supervisorkratos.ApplyAdd},
+	}, report.Steps)
+	require.Equal(t, []string{"other"}, report.Skipped)
+	require.Equal(t, []string{
+		"reloadConfig",
+		"stopProcessGroup services",
+		"removeProcessGroup services",
+		"addProcessGroup services",
+		"addProcessGroup memmon",
+	}, client.calls)
+
+	// Dropping the event listener removes its group
+	// 去掉事件监听器会删除其组
+	group.EventListeners = nil
+	client = &fakeSupervisor{reload: &supervisorrpc.ReloadResult{Removed: []string{"memmon"}}}
+	report, err = writer.Apply(context.Background(), client, group)
+	require.NoError(t, err)
+	require.Equal(t, []*supervisorkratos.ApplyStep{{Group: "memmon", Action: supervisorkratos.ApplyRemove}}, report.Steps)
+	require.Equal(t, []string{"reloadConfig", "stopProcessGroup memmon", "removeProcessGroup memmon"}, client.calls)
+}
+
+func TestConfWriterApplyRollback(t *testing.T) {
+	// Test the previous file is restored when supervisord rejects the config
+	// 测试 supervisord 拒绝配置时恢复之前的文件
+	dir := t.TempDir()
+	program := supervisorkratos.NewProgramConfig("api", "/opt/api", "deploy", "/var/log/services")
+	group := supervisorkratos.NewGroupConfig("services").AddProgram(program)
+	writer := supervisorkratos.NewConfWriter(dir)
+
+	_, err := writer.Apply(context.Background(), &fakeSupervisor{reload: &supervisorrpc.ReloadResult{}}, group)
+	require.NoError(t, err)
+	previous, err := os.ReadFile(filepath.Join(dir, "services.conf"))
+	require.NoError(t, err)
+
+	program.WithStartSecs(30)
+	client := &fakeSupervisor{reloadErr: &supervisorrpc.Fault{Code: supervisorrpc.FaultCantReread, String: "CANT_REREAD"}}
+	report, err := writer.Apply(context.Background(), client, group)
+	require.True(t, supervisorrpc.IsFault(err, supervisorrpc.FaultCantReread))
+	require.True(t, report.RolledBack)
+	require.Equal(t, []string{"services.conf"}, report.Write.Changed)
+
+	content, err := os.ReadFile(filepath.Join(dir, "services.conf"))
+	require.NoError(t, err)
+	require.Equal(t, string(previous), string(content))
+
+	// New file is removed on rollback
+	// 回滚时删除新文件
+	jobs := supervisorkratos.NewGroupConfig("jobs").AddProgram(supervisorkratos.NewProgramConfig("worker", "/opt/worker", "deploy", "/var/log/services"))
+	_, err = writer.Apply(context.Background(), client, jobs)
+	require.Error(t, err)
+	require.NoFileExists(t, filepath.Join(dir, "jobs.conf"))
+
+	// Dry run does not call supervisord
+	// 演练模式不调用 supervisord
+	client = &fakeSupervisor{}
+	report, err = supervisorkratos.NewConfWriter(dir).WithDryRun(true).Apply(context.Background(), client, jobs)
+	require.NoError(t, err)
+	require.Equal(t, []string{"jobs.conf"}, report.Write.Added)
+	require.Empty(t, client.calls)
+}
@@ -0,0 +1,198 @@
+package supervisorkratos
+
+import (
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// ExecutablePath get executable path, <Root>/bin/<BinName> unless Executable is set
+// 获取可执行文件路径，未设置 Executable 时为 <Root>/bin/<BinName>
+func (p *ProgramConfig) ExecutablePath() string {
+	if p.Executable.IsSet() {
+		return p.Executable.Get()
+	}
+	binName := p.Name
+	if p.BinName.IsSet() {
+		binName = p.BinName.Get()
+	}
+	return filepath.Join(p.Root, "bin", binName)
+}
+
+// CommandArgs get full command as argument list: wrapper, executable, then arguments
+// 获取完整命令的参数列表：包装命令、可执行文件、参数
+func (p *ProgramConfig) CommandArgs() []string {
+	return slices.Concat(p.Wrapper.Get(), []string{p.ExecutablePath()}, p.Args.Get())
+}
+
+// CommandLine get command line rendered for supervisor
+// Arguments are quoted for supervisor's shlex splitting and literal "%" is escaped as "%%"
+// Known %(name)s expressions like %(process_num)02d are kept for supervisor to expand
+//
+// 获取为 supervisor 渲染的命令行
+// 参数会按 supervisor 的 shlex 拆分规则加引号，字面量 "%" 会转义为 "%%"
+// 已知的 %(name)s 表达式（如 %(process_num)02d）会保留给 supervisor 展开
+func (p *ProgramConfig) CommandLine() string {
+	args := p.CommandArgs()
+	results := make([]string, 0, len(args))
+	for _, arg := range args {
+		results = append(results, quoteArg(escapePercent(arg)))
+	}
+	return strings.Join(results, " ")
+}
+
+// escapePercent escape literal "%" as "%%", keeping known %(name)s expressions
+// 把字面量 "%" 转义为 "%%"，保留已知的 %(name)s 表达式
+func escapePercent(value string) string {
+	if !strings.Contains(value, "%") {
+		return value
+	}
+	var res strings.Builder
+	for i := 0; i < len(value); i++ {
+		if value[i] != '%' {
+			res.WriteByte(value[i])
+			continue
+		}
+		name, size, ok := scanExpansion(value[i:])
+		if ok && (slices.Contains(expansionNames, name) || strings.HasPrefix(name, "ENV_")) {
+			res.WriteString(value[i : i+size])
+			i += size - 1
+			continue
+		}
+		res.WriteString("%%")
+	}
+	return res.String()
+}
+
+// unescapePercent reverse escapePercent, "%%" becomes "%"
+// escapePercent 的逆操作，"%%" 变为 "%"
+func unescapePercent(value string) string {
+	return strings.ReplaceAll(value, "%%", "%")
+}
+
+// quoteArg quote argument when it has characters shlex would split or interpret
+// 参数包含 shlex 会拆分或解释的字符时为其加引号
+func quoteArg(arg string) string {
+	if arg == "" {
+		return `""`
+	}
+	safe := true
+	for _, c := range arg {
+		if !isSafeArgRune(c) {
+			safe = false
+			break
+		}
+	}
+	if safe {
+		return arg
+	}
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(arg) + `"`
+}
+
+func isSafeArgRune(c rune) bool {
+	return (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || (c >= '0' && c <= '9') || strings.ContainsRune("_-+=@%,.:/()", c)
+}
+
+// splitCommand split command line the same way as supervisor's shlex.split (posix mode)
+// 按 supervisor 的 shlex.split（posix 模式）相同的方式拆分命令行
+func splitCommand(command string) ([]string, error) {
+	results := make([]string, 0)
+	var arg strings.Builder
+	inArg := false
+	quote := rune(0)
+	runes := []rune(command)
+	for i := 0; i < len(runes); i++ {
+		c := runes[i]
+		switch {
+		case quote == '\'':
+			if c == '\'' {
+				quote = 0
+			} else {
+				arg.WriteRune(c)
+			}
+		case quote == '"':
+			if c == '\\' && i+1 < len(runes) && (runes[i+1] == '"' || runes[i+1] == '\\') {
+				i++
+				arg.WriteRune(runes[i])
+			} else if c == '"' {
+				quote = 0
+			} else {
+				arg.WriteRune(c)
+			}
+		case c == '\'' || c == '"':
+			quote = c
+			inArg = true
+		case c == '\\' && i+1 < len(runes):
+			i++
+			arg.WriteRune(runes[i])
+			inArg = true
+		case c == ' ' || c == '\t' || c == '\n':
+			if inArg {
+				results = append(results, arg.String())
+				arg.Reset()
+				inArg = false
+			}
+		default:
+			arg.WriteRune(c)
+			inArg = true
+		}
+	}
+	if quote != 0 {
+		return nil, errors.Errorf("unterminated quote in command %q", command)
+	}
+	if inArg {
+		results = append(results, arg.String())
+	}
+	return results, nil
+}
+
+// parseCommand set command fields of program from supervisor command line
+// The default <Root>/bin/<Name> path is detected so that tokens before it become the wrapper
+//
+// 根据 supervisor 命令行设置程序的命令字段
+// 会识别默认的 <Root>/bin/<Name> 路径，其之前的部分作为包装命令
+func parseCommand(program *ProgramConfig, command string) error {
+	tokens, err := splitCommand(command)
+	if err != nil {
+		return err
+	}
+	if len(tokens) == 0 {
+		return errors.New("empty command")
+	}
+	for idx := range tokens {
+		tokens[idx] = unescapePercent(tokens[idx])
+	}
+	setCommandTokens(program, tokens)
+	return nil
+}
+
+// setCommandTokens set command fields of program from a non-empty argument list
+// The default <Root>/bin/<Name> path is detected so that tokens before it become the wrapper
+//
+// 根据非空的参数列表设置程序的命令字段
+// 会识别默认的 <Root>/bin/<Name> 路径，其之前的部分作为包装命令
+func setCommandTokens(program *ProgramConfig, tokens []string) {
+	binDir := filepath.Join(program.Root, "bin")
+	defaultPath := filepath.Join(binDir, program.Name)
+	if pos := slices.Index(tokens, defaultPath); pos >= 0 {
+		if pos > 0 {
+			program.Wrapper.Set(tokens[:pos])
+		}
+		if len(tokens) > pos+1 {
+			program.Args.Set(tokens[pos+1:])
+		}
+		return
+	}
+
+	executable := tokens[0]
+	if filepath.Dir(executable) == binDir {
+		program.BinName.Set(filepath.Base(executable))
+	} else {
+		program.Executable.Set(executable)
+	}
+	if len(tokens) > 1 {
+		program.Args.Set(tokens[1:])
+	}
+}
@@ -0,0 +1,121 @@
+package supervisorkratos_test
+
+import (
+	"testing"
+
+	"github.com/orzkratos/supervisorkratos"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCommandWithArgs(t *testing.T) {
+	// Test Kratos service command with -conf flag
+	// 测试带 -conf 参数的 Kratos 服务命令
+	program := supervisorkratos.NewProgramConfig(
+		"kratos-api",
+		"/opt/kratos-api",
+		"deploy",
+		"/var/log/kratos",
+	).WithArgs("-conf", "/opt/kratos-api/configs")
+
+	content := supervisorkratos.GenerateProgramConfig(program)
+	t.Log("=== Command with arguments ===")
+	t.Log(content)
+
+	const expected = `[program:kratos-api]
+user            = deploy
+directory       = /opt/kratos-api
+command         = /opt/kratos-api/bin/kratos-api -conf /opt/kratos-api/configs
+
+stdout_logfile  = /var/log/kratos/kratos-api.log
+
+stderr_logfile  = /var/log/kratos/kratos-api.err
+
+`
+
+	require.Equal(t, expected, content)
+}
+
+func TestCommandWithWrapperAndBinName(t *testing.T) {
+	// Test wrapper command and binary name differing from program name
+	// 测试包装命令以及与程序名称不同的二进制文件名
+	program := supervisorkratos.NewProgramConfig(
+		"order",
+		"/opt/order",
+		"deploy",
+		"/var/log/order",
+	).WithBinName("order-server").
+		WithWrapper("nice", "-n", "10").
+		WithArgs("-conf", "./configs")
+
+	require.Equal(t, "/opt/order/bin/order-server", program.ExecutablePath())
+	require.Equal(t, []string{"nice", "-n", "10", "/opt/order/bin/order-server", "-conf", "./configs"}, program.CommandArgs())
+	require.Equal(t, "nice -n 10 /opt/order/bin/order-server -conf ./configs", program.CommandLine())
+}
+
+func TestCommandWithExecutable(t *testing.T) {
+	// Test executable override outside the bin/ convention
+	// 测试覆盖 bin/ 约定之外的可执行文件
+	program := supervisorkratos.NewProgramConfig(
+		"legacy",
+		"/opt/legacy",
+		"deploy",
+		"/var/log/legacy",
+	).WithExecutable("/usr/local/bin/legacy server").
+		WithArgs("--name", "it's \"quoted\"", "", "--fmt=%s", "--num=%(process_num)02d", `C:\dir`)
+
+	const expected = `"/usr/local/bin/legacy server" --name "it's \"quoted\"" "" --fmt=%%s --num=%(process_num)02d "C:\\dir"`
+	require.Equal(t, expected, program.CommandLine())
+}
+
+func TestCommandDefault(t *testing.T) {
+	// Test default command stays <Root>/bin/<Name>
+	// 测试默认命令仍然是 <Root>/bin/<Name>
+	program := supervisorkratos.NewProgramConfig(
+		"myapp",
+		"/opt/myapp",
+		"deploy",
+		"/var/log/myapp",
+	)
+	require.Equal(t, "/opt/myapp/bin/myapp", program.CommandLine())
+	require.Equal(t, []string{"/opt/myapp/bin/myapp"}, program.CommandArgs())
+}
+
+func TestCommandParseRoundTrip(t *testing.T) {
+	// Test commands survive generate→parse→generate
+	// 测试命令经过 生成→解析→生成 后保持不变
+	programs := []*supervisorkratos.ProgramConfig{
+		supervisorkratos.NewProgramConfig("a", "/opt/a", "deploy", "/var/log/a").
+			WithWrapper("chrt", "-f", "50").
+			WithArgs("-conf", "/opt/a/configs"),
+		supervisorkratos.NewProgramConfig("b", "/opt/b", "deploy", "/var/log/b").
+			WithBinName("b-server"),
+		supervisorkratos.NewProgramConfig("c", "/opt/c", "deploy", "/var/log/c").
+			WithExecutable("/usr/bin/env").
+			WithArgs("python3", "-m", "http.server", "--bind", "", "100% sure"),
+	}
+
+	for _, program := range programs {
+		content := supervisorkratos.GenerateProgramConfig(program)
+		res, err := supervisorkratos.ParseConfig(content)
+		require.NoError(t, err)
+		require.Len(t, res.Programs, 1)
+		require.Equal(t, program.CommandArgs(), res.Programs[0].CommandArgs())
+		require.Equal(t, content, supervisorkratos.GenerateProgramConfig(res.Programs[0]))
+	}
+}
+
+func TestCommandValidate(t *testing.T) {
+	// Test invalid command settings are rejected
+	// 测试无效的命令设置会被拒绝
+	program := supervisorkratos.NewProgramConfig(
+		"myapp",
+		"/opt/myapp",
+		"deploy",
+		"/var/log/myapp",
+	).WithBinName("bin/myapp").
+		WithArgs("line\nbreak")
+
+	_, err := supervisorkratos.GenerateProgramConfigE(program)
+	require.ErrorIs(t, err, supervisorkratos.ErrInvalidValue)
+	t.Log(err)
+}
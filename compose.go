@@ -0,0 +1,286 @@
+package supervisorkratos
+
+import (
+	"bytes"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/yyle88/must"
+	"gopkg.in/yaml.v3"
+)
+
+// ComposeConfig docker-compose rendering of a group, each program becomes a service running the same command in Image
+// ComposeConfig 组的 docker-compose 渲染配置，每个程序成为在 Image 中运行相同命令的服务
+type ComposeConfig struct {
+	Group   *GroupConfig      // Group to render, its name becomes the project name // 要渲染的组，组名成为项目名称
+	Image   string            // Default image of the services // 服务的默认镜像
+	Images  map[string]string // Image of a program by name, overrides Image // 按程序名称指定的镜像，覆盖 Image
+	LogRoot string            // Host DIR mounted over each SlogRoot // 挂载到每个 SlogRoot 的主机目录
+}
+
+// NewComposeConfig create new ComposeConfig with the group and default image, logs are mounted from ./logs
+// 创建新的 ComposeConfig，需要提供组和默认镜像，日志从 ./logs 挂载
+func NewComposeConfig(group *GroupConfig, image string) *ComposeConfig {
+	return &ComposeConfig{
+		Group:   group,
+		Image:   must.Nice(image),
+		Images:  make(map[string]string),
+		LogRoot: "./logs",
+	}
+}
+
+// WithImage set image of the program, overriding the default image
+// 设置程序的镜像，覆盖默认镜像
+func (c *ComposeConfig) WithImage(programName string, image string) *ComposeConfig {
+	c.Images[programName] = image
+	return c
+}
+
+// WithLogRoot set host DIR mounted over each SlogRoot
+// 设置挂载到每个 SlogRoot 的主机目录
+func (c *ComposeConfig) WithLogRoot(logRoot string) *ComposeConfig {
+	c.LogRoot = logRoot
+	return c
+}
+
+// composeFile top level of the compose file
+// compose 文件的顶层
+type composeFile struct {
+	Name     string                     `yaml:"name"`
+	Services map[string]*composeService `yaml:"services"`
+}
+
+// composeService service keys, in the order they are written
+// 服务的键，按写出的顺序排列
+type composeService struct {
+	Image           string            `yaml:"image"`
+	Command         []string          `yaml:"command"`
+	WorkingDir      string            `yaml:"working_dir"`
+	User            string            `yaml:"user"`
+	Environment     map[string]string `yaml:"environment,omitempty"`
+	Ports           []string          `yaml:"ports,omitempty"`
+	Volumes         []string          `yaml:"volumes"`
+	Restart         string            `yaml:"restart"`
+	StopSignal      string            `yaml:"stop_signal"`
+	StopGracePeriod string            `yaml:"stop_grace_period"`
+	Logging         *composeLogging   `yaml:"logging,omitempty"`
+	Deploy          *composeDeploy    `yaml:"deploy,omitempty"`
+}
+
+type composeLogging struct {
+	Driver  string            `yaml:"driver"`
+	Options map[string]string `yaml:"options"`
+}
+
+type composeDeploy struct {
+	Replicas int `yaml:"replicas"`
+}
+
+// GenerateComposeFile generate docker-compose file of the group, panics on invalid config
+// 生成组的 docker-compose 文件，配置无效时 panic
+func GenerateComposeFile(compose *ComposeConfig) string {
+	return must.V1(GenerateComposeFileE(compose))
+}
+
+// GenerateComposeFileE generate docker-compose file of the group
+// NumProcs becomes deploy.replicas, unless instances differ by ports, %(process_num) expressions or ExpandNumProcs,
+// then each instance becomes a service named by its process name
+// Fields map as: command→command, Root→working_dir, UserName→user, Environment→environment, AutoRestart→restart,
+// StopSignal→stop_signal, StopWaitSecs→stop_grace_period, LogMaxBytes/LogBackups→json-file max-size/max-file,
+// SlogRoot→a volume from LogRoot, Ports→published ports
+// Not mapped: StartRetries, StartSecs, ExitCodes, Priority, StopAsGroup, KillAsGroup, RedirectStderr and HealthCheck
+// %(ENV_X)s becomes ${X} read from the shell running compose, "$" is escaped as "$$", %(here)s and %(host_node_name)s are reported as errors
+//
+// 生成组的 docker-compose 文件
+// NumProcs 成为 deploy.replicas，除非实例因端口、%(process_num) 表达式或 ExpandNumProcs 而不同，
+// 此时每个实例成为以其进程名称命名的服务
+// 字段映射：命令→command，Root→working_dir，UserName→user，Environment→environment，AutoRestart→restart，
+// StopSignal→stop_signal，StopWaitSecs→stop_grace_period，LogMaxBytes/LogBackups→json-file 的 max-size/max-file，
+// SlogRoot→从 LogRoot 挂载的卷，Ports→发布的端口
+// 不映射：StartRetries、StartSecs、ExitCodes、Priority、StopAsGroup、KillAsGroup、RedirectStderr 和 HealthCheck
+// %(ENV_X)s 变为从运行 compose 的 shell 读取的 ${X}，"$" 转义为 "$$"，%(here)s 和 %(host_node_name)s 会作为错误报告
+func GenerateComposeFileE(compose *ComposeConfig) (string, error) {
+	if compose == nil || compose.Group == nil {
+		return "", errors.New("compose config and its group are required")
+	}
+	group := compose.Group
+	if err := group.Validate(); err != nil {
+		return "", err
+	}
+	v := &validator{}
+	section := "group:" + group.Name
+	if len(group.EventListeners) > 0 {
+		v.add(section, "EventListeners", len(group.EventListeners), ErrInvalidValue, "event listeners have no compose equivalent")
+	}
+	if len(group.FcgiPrograms) > 0 {
+		v.add(section, "FcgiPrograms", len(group.FcgiPrograms), ErrInvalidValue, "FastCGI programs have no compose equivalent")
+	}
+	if compose.LogRoot == "" {
+		v.add(section, "LogRoot", compose.LogRoot, ErrRequired, "host DIR of the logs is not set")
+	}
+
+	file := &composeFile{Name: group.Name, Services: make(map[string]*composeService)}
+	for _, program := range group.Programs {
+		image := compose.Image
+		if programImage, ok := compose.Images[program.Name]; ok {
+			image = programImage
+		}
+		instances := program.portSections(group.Name)
+		replicas := program.NumProcs.Get()
+		if replicas > 1 && (group.ExpandNumProcs || program.Ports != nil || program.usesProcessNum()) {
+			instances = program.instanceSections(group.Name)
+			replicas = 1
+		}
+		for num, instance := range instances {
+			if _, ok := file.Services[instance.Name]; ok {
+				v.add("program:"+program.Name, "Name", instance.Name, ErrDuplicate, "service %q is written twice", instance.Name)
+				continue
+			}
+			service := instance.composeService(v, group.Name, image, compose.LogRoot, replicas)
+			if program.Ports != nil {
+				for _, port := range []int{program.Ports.HTTPPort(num), program.Ports.GRPCPort(num)} {
+					if port != 0 {
+						service.Ports = append(service.Ports, strconv.Itoa(port)+":"+strconv.Itoa(port))
+					}
+				}
+			}
+			file.Services[instance.Name] = service
+		}
+	}
+	if err := v.result(); err != nil {
+		return "", err
+	}
+
+	var buffer bytes.Buffer
+	encoder := yaml.NewEncoder(&buffer)
+	encoder.SetIndent(2)
+	must.Done(encoder.Encode(file))
+	must.Done(encoder.Close())
+	return buffer.String(), nil
+}
+
+// usesProcessNum check the command, directory or environment refers to %(process_num)
+// 检查命令、目录或环境变量是否引用了 %(process_num)
+func (p *ProgramConfig) usesProcessNum() bool {
+	values := slices.Concat(p.CommandArgs(), []string{p.Root})
+	for _, value := range p.Environment.Get() {
+		values = append(values, value)
+	}
+	return slices.ContainsFunc(values, func(value string) bool {
+		return strings.Contains(value, "%(process_num)")
+	})
+}
+
+// composeService map program to a compose service running replicas copies, ports are published by the caller
+// 将程序映射为运行 replicas 个副本的 compose 服务，端口由调用方发布
+func (p *ProgramConfig) composeService(v *validator, groupName string, image string, logRoot string, replicas int) *composeService {
+	section := "program:" + p.Name
+	vars := p.instanceVars(groupName, 0)
+	expand := func(field string, value string) string {
+		res, err := composeExpand(value, vars)
+		if err != nil {
+			v.add(section, field, value, ErrInvalidValue, "%s", err.Error())
+		}
+		return res
+	}
+
+	service := &composeService{
+		Image:           image,
+		WorkingDir:      expand("Root", p.Root),
+		User:            p.UserName,
+		Volumes:         []string{logRoot + ":" + p.SlogRoot},
+		Restart:         composeRestart(p.AutoRestart.Get()),
+		StopSignal:      "SIG" + signalName(p.StopSignal.Get()),
+		StopGracePeriod: strconv.Itoa(p.StopWaitSecs.Get()) + "s",
+	}
+	for _, arg := range p.CommandArgs() {
+		service.Command = append(service.Command, expand("Command", arg))
+	}
+
+	if environment := p.Environment.Get(); len(environment) > 0 {
+		service.Environment = make(map[string]string, len(environment))
+		for key, value := range environment {
+			service.Environment[key] = expand("Environment", value)
+		}
+	}
+
+	if p.LogMaxBytes.IsSet() || p.LogBackups.IsSet() {
+		service.Logging = &composeLogging{Driver: "json-file", Options: make(map[string]string)}
+		if size, err := ParseByteSize(p.LogMaxBytes.Get()); err == nil && size > 0 {
+			service.Logging.Options["max-size"] = composeByteSize(size)
+		}
+		service.Logging.Options["max-file"] = strconv.Itoa(p.LogBackups.Get() + 1) // The current file and the backups // 当前文件加上备份
+	}
+	if replicas > 1 {
+		service.Deploy = &composeDeploy{Replicas: replicas}
+	}
+	return service
+}
+
+// composeExpand expand supervisor expressions of value for compose, %(ENV_X)s becomes ${X} and literal "$" becomes "$$"
+// composeExpand 为 compose 展开 value 中的 supervisor 表达式，%(ENV_X)s 变为 ${X}，字面量 "$" 变为 "$$"
+func composeExpand(value string, vars map[string]string) (string, error) {
+	var res strings.Builder
+	for i := 0; i < len(value); i++ {
+		if value[i] != '%' {
+			if value[i] == '$' {
+				res.WriteString("$$")
+			} else {
+				res.WriteByte(value[i])
+			}
+			continue
+		}
+		name, size, ok := scanExpansion(value[i:])
+		if !ok || (!slices.Contains(expansionNames, name) && !strings.HasPrefix(name, "ENV_")) {
+			res.WriteByte('%')
+			continue
+		}
+		expression := value[i : i+size]
+		switch {
+		case strings.HasPrefix(name, "ENV_"):
+			if expression != "%("+name+")s" {
+				return "", errors.Errorf("%s has no compose equivalent, only %%(ENV_X)s is supported", expression)
+			}
+			res.WriteString("${" + strings.TrimPrefix(name, "ENV_") + "}")
+		case name == "here" || name == "host_node_name":
+			return "", errors.Errorf("%s has no compose equivalent", expression)
+		default:
+			res.WriteString(strings.ReplaceAll(expandExpressions(expression, vars), "$", "$$"))
+		}
+		i += size - 1
+	}
+	return res.String(), nil
+}
+
+// composeRestart map autorestart to restart:, "unexpected" restarts on any non-zero exit code
+// 将 autorestart 映射为 restart:，"unexpected" 在任何非零退出码时重启
+func composeRestart(autoRestart any) string {
+	switch autoRestart {
+	case true, "true":
+		return "always"
+	case false, "false":
+		return "no"
+	default:
+		return "on-failure"
+	}
+}
+
+// composeByteSize render bytes as json-file max-size, using k/m/g when the size is a whole unit
+// 将字节数渲染为 json-file 的 max-size，大小为整数单位时使用 k/m/g
+func composeByteSize(size int64) string {
+	for _, unit := range []struct {
+		suffix string
+		size   int64
+	}{
+		{"g", 1 << 30},
+		{"m", 1 << 20},
+		{"k", 1 << 10},
+	} {
+		if size%unit.size == 0 {
+			return strconv.FormatInt(size/unit.size, 10) + unit.suffix
+		}
+	}
+	return strconv.FormatInt(size, 10)
+}
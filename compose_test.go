@@ -0,0 +1,93 @@
+package supervisorkratos_test
+
+import (
+	"testing"
+
+	"github.com/orzkratos/supervisorkratos"
+	"github.com/stretchr/testify/require"
+	"gopkg.in/yaml.v3"
+)
+
+func TestComposeFile(t *testing.T) {
+	// Test programs map to services with replicas, restart policy, stop settings, logging and log volumes
+	// 测试程序映射为带有副本数、重启策略、停止设置、日志选项和日志卷的服务
+	group := supervisorkratos.NewGroupConfig("services").
+		AddProgram(supervisorkratos.NewProgramConfig("api", "/opt/api", "deploy", "/var/log/services").
+			WithArgs("-conf", "/opt/api/configs", "-token", "$TOKEN").
+			WithEnvironment(map[string]string{"APP_ENV": "%(ENV_APP_ENV)s", "APP": "%(program_name)s"}).
+			WithNumProcs(3).
+			WithProcessName("%(program_name)s_%(process_num)d").
+			WithAutoRestartMode("unexpected").
+			WithStopSignal("SIGint").
+			WithStopWaitSecs(30).
+			WithLogMaxBytes("50MB").
+			WithLogBackups(5)).
+		AddProgram(supervisorkratos.NewProgramConfig("worker", "/opt/worker", "deploy", "/var/log/services").
+			WithAutoRestart(false))
+
+	content := supervisorkratos.GenerateComposeFile(supervisorkratos.NewComposeConfig(group, "example/services:dev").
+		WithImage("worker", "example/worker:dev").
+		WithLogRoot("./var/log"))
+	t.Log(content)
+	require.Contains(t, content, "name: services\nservices:\n  api:\n    image: example/services:dev\n")
+
+	var res map[string]any
+	require.NoError(t, yaml.Unmarshal([]byte(content), &res))
+	api := res["services"].(map[string]any)["api"].(map[string]any)
+	require.Equal(t, []any{"/opt/api/bin/api", "-conf", "/opt/api/configs", "-token", "$$TOKEN"}, api["command"])
+	require.Equal(t, "/opt/api", api["working_dir"])
+	require.Equal(t, "deploy", api["user"])
+	require.Equal(t, map[string]any{"APP_ENV": "${APP_ENV}", "APP": "api"}, api["environment"])
+	require.Equal(t, "on-failure", api["restart"])
+	require.Equal(t, "SIGINT", api["stop_signal"])
+	require.Equal(t, "30s", api["stop_grace_period"])
+	require.Equal(t, []any{"./var/log:/var/log/services"}, api["volumes"])
+	require.Equal(t, map[string]any{"max-size": "50m", "max-file": "6"}, api["logging"].(map[string]any)["options"])
+	require.Equal(t, map[string]any{"replicas": 3}, api["deploy"])
+
+	worker := res["services"].(map[string]any)["worker"].(map[string]any)
+	require.Equal(t, "example/worker:dev", worker["image"])
+	require.Equal(t, "no", worker["restart"])
+	require.NotContains(t, worker, "deploy")
+	require.NotContains(t, worker, "logging")
+}
+
+func TestComposeFileInstances(t *testing.T) {
+	// Test instances with their own ports or process numbers become one service each
+	// 测试拥有各自端口或进程编号的实例各自成为一个服务
+	group := supervisorkratos.NewGroupConfig("services").
+		AddProgram(supervisorkratos.NewProgramConfig("api", "/opt/api", "deploy", "/var/log/services").
+			WithNumProcs(2).
+			WithProcessName("%(program_name)s_%(process_num)d").
+			WithArgs("-id", "%(process_num)d").
+			WithPorts(supervisorkratos.NewPortAllocation(8000, 9000)))
+
+	content := supervisorkratos.GenerateComposeFile(supervisorkratos.NewComposeConfig(group, "example/api:dev"))
+	t.Log(content)
+	var res struct {
+		Services map[string]struct {
+			Command     []string          `yaml:"command"`
+			Environment map[string]string `yaml:"environment"`
+			Ports       []string          `yaml:"ports"`
+			Deploy      map[string]int    `yaml:"deploy"`
+		} `yaml:"services"`
+	}
+	require.NoError(t, yaml.Unmarshal([]byte(content), &res))
+	require.Len(t, res.Services, 2)
+	require.Equal(t, []string{"/opt/api/bin/api", "-id", "1"}, res.Services["api_1"].Command)
+	require.Equal(t, "0.0.0.0:8001", res.Services["api_1"].Environment["KRATOS_HTTP_ADDR"])
+	require.Equal(t, []string{"8001:8001", "9001:9001"}, res.Services["api_1"].Ports)
+	require.Nil(t, res.Services["api_1"].Deploy)
+
+	// %(here)s has no compose equivalent
+	// %(here)s 没有 compose 对应物
+	group.Programs[0].WithArgs("-conf", "%(here)s/configs")
+	_, err := supervisorkratos.GenerateComposeFileE(supervisorkratos.NewComposeConfig(group, "example/api:dev"))
+	require.ErrorIs(t, err, supervisorkratos.ErrInvalidValue)
+
+	// Neither has %(host_node_name)s, the host running the containers is unknown here
+	// %(host_node_name)s 也没有，此处无法得知运行容器的主机
+	group.Programs[0].WithArgs("-host", "%(host_node_name)s")
+	_, err = supervisorkratos.GenerateComposeFileE(supervisorkratos.NewComposeConfig(group, "example/api:dev"))
+	require.ErrorIs(t, err, supervisorkratos.ErrInvalidValue)
+}
@@ -0,0 +1,387 @@
+package supervisorkratos
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/yyle88/must"
+)
+
+// ConfMarker header line of files owned by ConfWriter, files without it are never touched
+// ConfWriter 所管理文件的头部标记行，没有该标记的文件永远不会被改动
+const ConfMarker = "; Code generated by supervisorkratos. DO NOT EDIT."
+
+// ConfWriter write one .conf per group and per standalone program into a conf.d directory
+// Every file is rendered before anything is written, each write is an atomic temp-file+rename
+//
+// 将每个组和每个独立程序写成 conf.d 目录中的一个 .conf 文件
+// 写入前先渲染全部文件，每次写入都是原子的 临时文件+重命名
+type ConfWriter struct {
+	Dir    string // Target conf.d directory // 目标 conf.d 目录
+	DryRun bool   // Report changes without touching files // 只报告变更而不改动文件
+}
+
+// NewConfWriter create new ConfWriter with target directory
+// 创建新的 ConfWriter，需要提供目标目录
+func NewConfWriter(dir string) *ConfWriter {
+	return &ConfWriter{
+		Dir:    must.Nice(dir),
+		DryRun: false,
+	}
+}
+
+// WithDryRun set dry-run mode, changes are reported but files are not touched
+// 设置演练模式，只报告变更而不改动文件
+func (w *ConfWriter) WithDryRun(dryRun bool) *ConfWriter {
+	w.DryRun = dryRun
+	return w
+}
+
+// WriteReport file names changed by ConfWriter, sorted
+// ConfWriter 变更的文件名，已排序
+type WriteReport struct {
+	Added     []string // New files // 新增的文件
+	Changed   []string // Files with new content // 内容变化的文件
+	Removed   []string // Stale owned files // 过期的自有文件
+	Unchanged []string // Files with same content // 内容不变的文件
+}
+
+// HasChanges check whether any file is added, changed or removed
+// 检查是否有文件被新增、修改或删除
+func (r *WriteReport) HasChanges() bool {
+	return len(r.Added) > 0 || len(r.Changed) > 0 || len(r.Removed) > 0
+}
+
+// Sync make the directory hold exactly one file per group and standalone program
+// Owned files (starting with ConfMarker) that are no longer wanted are removed
+//
+// 使目录中恰好包含每个组和每个独立程序的一个文件
+// 不再需要的自有文件（以 ConfMarker 开头）会被删除
+func (w *ConfWriter) Sync(groups []*GroupConfig, programs []*ProgramConfig) (*WriteReport, error) {
+	files, err := renderConfFiles(groups, programs)
+	if err != nil {
+		return nil, err
+	}
+	owned, err := w.ownedFiles()
+	if err != nil {
+		return nil, err
+	}
+	report, err := w.write(files)
+	if err != nil {
+		return nil, err
+	}
+	for _, name := range owned {
+		if _, ok := files[name]; ok {
+			continue
+		}
+		if !w.DryRun {
+			if err := os.Remove(filepath.Join(w.Dir, name)); err != nil {
+				return nil, errors.WithMessagef(err, "remove %s", name)
+			}
+		}
+		report.Removed = append(report.Removed, name)
+	}
+	return report, w.syncDir(report)
+}
+
+// WriteGroup write <group>.conf without removing other files
+// 写入 <group>.conf，不删除其他文件
+func (w *ConfWriter) WriteGroup(group *GroupConfig) (*WriteReport, error) {
+	return w.Write([]*GroupConfig{group}, nil)
+}
+
+// WriteProgram write <program>.conf without removing other files
+// 写入 <program>.conf，不删除其他文件
+func (w *ConfWriter) WriteProgram(program *ProgramConfig) (*WriteReport, error) {
+	return w.Write(nil, []*ProgramConfig{program})
+}
+
+// Write write one file per group and standalone program without removing other files
+// 为每个组和每个独立程序写入一个文件，不删除其他文件
+func (w *ConfWriter) Write(groups []*GroupConfig, programs []*ProgramConfig) (*WriteReport, error) {
+	files, err := renderConfFiles(groups, programs)
+	if err != nil {
+		return nil, err
+	}
+	report, err := w.write(files)
+	if err != nil {
+		return nil, err
+	}
+	return report, w.syncDir(report)
+}
+
+// Remove remove owned <name>.conf files, missing files are skipped and files without ConfMarker are refused
+// 删除自有的 <name>.conf 文件，不存在的文件会跳过，没有 ConfMarker 的文件会被拒绝
+func (w *ConfWriter) Remove(names ...string) (*WriteReport, error) {
+	report := &WriteReport{}
+	for _, name := range names {
+		fileName := name + ".conf"
+		path, err := w.confPath(fileName)
+		if err != nil {
+			return nil, err
+		}
+		data, err := os.ReadFile(path)
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return nil, errors.WithMessagef(err, "read %s", fileName)
+		}
+		if !isOwnedConf(data) {
+			return nil, errors.Errorf("refuse to remove %s: missing marker header", fileName)
+		}
+		if !w.DryRun {
+			if err := os.Remove(path); err != nil {
+				return nil, errors.WithMessagef(err, "remove %s", fileName)
+			}
+		}
+		report.Removed = append(report.Removed, fileName)
+	}
+	slices.Sort(report.Removed)
+	return report, w.syncDir(report)
+}
+
+// renderConfFiles validate and render every file content, keyed by file name
+// 校验并渲染每个文件的内容，以文件名为键
+func renderConfFiles(groups []*GroupConfig, programs []*ProgramConfig) (map[string]string, error) {
+	v := &validator{}
+	for _, group := range groups {
+		if group == nil {
+			v.add("group", "GroupConfig", nil, ErrRequired, "nil config")
+			continue
+		}
+		group.validateFields(v)
+	}
+	for _, program := range programs {
+		if program == nil {
+			v.add("program", "ProgramConfig", nil, ErrRequired, "nil config")
+			continue
+		}
+		program.validateFields(v, "program:"+program.Name)
+	}
+	if err := v.result(); err != nil {
+		return nil, err
+	}
+	checkConfCollisions(v, groups, programs)
+
+	files := make(map[string]string, len(groups)+len(programs))
+	add := func(section string, name string, content string) {
+		fileName := name + ".conf"
+		if _, ok := files[fileName]; ok {
+			v.add(section, "Name", name, ErrDuplicate, "file %q is written twice", fileName)
+			return
+		}
+		files[fileName] = ConfMarker + "\n\n" + content
+	}
+	for _, group := range groups {
+		add("group:"+group.Name, group.Name, renderGroupConfig(group))
+	}
+	for _, program := range programs {
+		add("program:"+program.Name, program.Name, renderProgramConfig(program))
+	}
+	if err := v.result(); err != nil {
+		return nil, err
+	}
+	return files, nil
+}
+
+// checkConfCollisions report sections and process groups defined by more than one conf file
+// supervisor merges sections of the same name across included files, so the last one would win silently
+//
+// 报告被多个配置文件定义的段和进程组
+// supervisor 会合并各个包含文件中的同名段，因此最后一个会静默生效
+func checkConfCollisions(v *validator, groups []*GroupConfig, programs []*ProgramConfig) {
+	sectionFiles := make(map[string]string)
+	processGroupFiles := make(map[string]string)
+	check := func(section string, fileName string, sections []string, processGroups []string) {
+		for _, name := range sections {
+			if other, ok := sectionFiles[name]; ok && other != fileName {
+				v.add(section, "Name", name, ErrDuplicate, "section [%s] is in both %s and %s", name, other, fileName)
+			}
+			sectionFiles[name] = fileName
+		}
+		for _, name := range processGroups {
+			if other, ok := processGroupFiles[name]; ok && other != fileName {
+				v.add(section, "Name", name, ErrDuplicate, "process group %q is in both %s and %s", name, other, fileName)
+			}
+			processGroupFiles[name] = fileName
+		}
+	}
+	groupNames := func(group *GroupConfig) ([]string, []string) {
+		sections := []string{"group:" + group.Name}
+		processGroups := []string{group.Name}
+		for _, program := range group.programSections() {
+			sections = append(sections, "program:"+program.Name)
+		}
+		for _, listener := range group.EventListeners {
+			sections = append(sections, "eventlistener:"+listener.Name)
+			processGroups = append(processGroups, listener.Name)
+		}
+		for _, program := range group.FcgiPrograms {
+			sections = append(sections, "fcgi-program:"+program.Name)
+			processGroups = append(processGroups, program.Name)
+		}
+		return sections, processGroups
+	}
+	for _, group := range groups {
+		sections, processGroups := groupNames(group)
+		check("group:"+group.Name, group.Name+".conf", sections, processGroups)
+	}
+	for _, program := range programs {
+		// A program with several port instances is rendered as a group of its name
+		// 拥有多个端口实例的程序会渲染为以其名称命名的组
+		sections, processGroups := []string{"program:" + program.Name}, []string{program.Name}
+		if len(program.portSections("")) > 1 {
+			sections, processGroups = groupNames(&GroupConfig{Name: program.Name, Programs: []*ProgramConfig{program}})
+		}
+		check("program:"+program.Name, program.Name+".conf", sections, processGroups)
+	}
+}
+
+// ownedFiles list .conf files in the directory that start with ConfMarker
+// 列出目录中以 ConfMarker 开头的 .conf 文件
+func (w *ConfWriter) ownedFiles() ([]string, error) {
+	entries, err := os.ReadDir(w.Dir)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, errors.WithMessagef(err, "read dir %s", w.Dir)
+	}
+	var names []string
+	for _, entry := range entries {
+		if !entry.Type().IsRegular() || !strings.HasSuffix(entry.Name(), ".conf") {
+			continue
+		}
+		data, err := os.ReadFile(filepath.Join(w.Dir, entry.Name()))
+		if err != nil {
+			return nil, errors.WithMessagef(err, "read %s", entry.Name())
+		}
+		if isOwnedConf(data) {
+			names = append(names, entry.Name())
+		}
+	}
+	return names, nil
+}
+
+// write compare every file with the directory, then write the added and changed ones
+// Ownership of every target is checked before any file is written, so a refused file leaves the directory unchanged
+//
+// 将每个文件与目录比较，然后写入新增和变化的文件
+// 写入任何文件之前先检查所有目标的归属，因此被拒绝的文件不会让目录发生任何变化
+func (w *ConfWriter) write(files map[string]string) (*WriteReport, error) {
+	report := &WriteReport{}
+	var pending []string
+	for _, name := range sortedKeys(files) {
+		path, err := w.confPath(name)
+		if err != nil {
+			return nil, err
+		}
+		data, err := os.ReadFile(path)
+		switch {
+		case os.IsNotExist(err):
+			report.Added = append(report.Added, name)
+		case err != nil:
+			return nil, errors.WithMessagef(err, "read %s", name)
+		case !isOwnedConf(data):
+			return nil, errors.Errorf("refuse to overwrite %s: missing marker header", name)
+		case bytes.Equal(data, []byte(files[name])):
+			report.Unchanged = append(report.Unchanged, name)
+			continue
+		default:
+			report.Changed = append(report.Changed, name)
+		}
+		pending = append(pending, name)
+	}
+	if w.DryRun || len(pending) == 0 {
+		return report, nil
+	}
+
+	if err := os.MkdirAll(w.Dir, 0o755); err != nil {
+		return nil, errors.WithMessagef(err, "create dir %s", w.Dir)
+	}
+	for _, name := range pending {
+		if err := writeFileAtomic(filepath.Join(w.Dir, name), []byte(files[name])); err != nil {
+			return nil, errors.WithMessagef(err, "write %s", name)
+		}
+	}
+	return report, nil
+}
+
+// confPath path of fileName in the directory, refusing names that resolve anywhere else
+// Names are validated already, this is the last guard before touching the file system
+//
+// fileName 在目录中的路径，拒绝解析到其他位置的名称
+// 名称已经校验过，这是操作文件系统之前的最后一道防线
+func (w *ConfWriter) confPath(fileName string) (string, error) {
+	path := filepath.Join(w.Dir, fileName)
+	if filepath.Dir(path) != filepath.Clean(w.Dir) || filepath.Base(path) != fileName {
+		return "", errors.Errorf("refuse %q: path resolves outside %s", fileName, w.Dir)
+	}
+	return path, nil
+}
+
+// ownsConf check fileName exists in the directory and starts with ConfMarker
+// 检查 fileName 是否存在于目录中且以 ConfMarker 开头
+func (w *ConfWriter) ownsConf(fileName string) (bool, error) {
+	path, err := w.confPath(fileName)
+	if err != nil {
+		return false, err
+	}
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return false, nil
+	}
+	if err != nil {
+		return false, errors.WithMessagef(err, "read %s", fileName)
+	}
+	return isOwnedConf(data), nil
+}
+
+// syncDir flush directory entries so renames and removals survive a crash
+// 刷新目录项，使重命名和删除在崩溃后仍然生效
+func (w *ConfWriter) syncDir(report *WriteReport) error {
+	if w.DryRun || !report.HasChanges() {
+		return nil
+	}
+	dir, err := os.Open(w.Dir)
+	if err != nil {
+		return errors.WithMessagef(err, "open dir %s", w.Dir)
+	}
+	defer dir.Close()
+	return errors.WithMessagef(dir.Sync(), "sync dir %s", w.Dir)
+}
+
+// writeFileAtomic write content to a temp file in the same directory, fsync it, then rename over path
+// 将内容写入同目录的临时文件并 fsync，然后重命名覆盖目标路径
+func writeFileAtomic(path string, content []byte) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".tmp-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name()) // No-op after rename succeeds // 重命名成功后无操作
+	if _, err := tmp.Write(content); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Chmod(0o644); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+func isOwnedConf(data []byte) bool {
+	return bytes.HasPrefix(data, []byte(ConfMarker+"\n"))
+}
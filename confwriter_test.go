@@ -0,0 +1,149 @@
+package supervisorkratos_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/orzkratos/supervisorkratos"
+	"github.com/stretchr/testify/require"
+)
+
+func TestConfWriterSync(t *testing.T) {
+	// Test sync writes one file per group and program, then reports changes and removes stale files
+	// 测试同步为每个组和程序写入一个文件，然后报告变更并删除过期文件
+	dir := t.TempDir()
+	newProgram := func(name string) *supervisorkratos.ProgramConfig {
+		return supervisorkratos.NewProgramConfig(name, "/opt/"+name, "deploy", "/var/log/services")
+	}
+	group := supervisorkratos.NewGroupConfig("services").AddProgram(newProgram("api"))
+	worker := newProgram("worker")
+
+	writer := supervisorkratos.NewConfWriter(dir)
+	report, err := writer.Sync([]*supervisorkratos.GroupConfig{group}, []*supervisorkratos.ProgramConfig{worker})
+	require.NoError(t, err)
+	require.Equal(t, []string{"services.conf", "worker.conf"}, report.Added)
+	require.True(t, report.HasChanges())
+
+	data, err := os.ReadFile(filepath.Join(dir, "services.conf"))
+	require.NoError(t, err)
+	require.Equal(t, supervisorkratos.ConfMarker+"\n\n"+supervisorkratos.GenerateGroupConfig(group), string(data))
+
+	// Written files parse back, the marker is a comment
+	// 写入的文件可以解析回来，标记是注释
+	res, err := supervisorkratos.ParseConfigFile(filepath.Join(dir, "services.conf"))
+	require.NoError(t, err)
+	require.Len(t, res.Groups, 1)
+
+	// Same input writes nothing
+	// 相同输入不写入任何内容
+	report, err = writer.Sync([]*supervisorkratos.GroupConfig{group}, []*supervisorkratos.ProgramConfig{worker})
+	require.NoError(t, err)
+	require.False(t, report.HasChanges())
+	require.Equal(t, []string{"services.conf", "worker.conf"}, report.Unchanged)
+
+	// Files without marker are kept
+	// 没有标记的文件会被保留
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "manual.conf"), []byte("[program:manual]\n"), 0o644))
+
+	// Dry run reports without touching files
+	// 演练模式只报告而不改动文件
+	group.Programs[0].WithStartSecs(5)
+	report, err = supervisorkratos.NewConfWriter(dir).WithDryRun(true).Sync([]*supervisorkratos.GroupConfig{group}, nil)
+	require.NoError(t, err)
+	require.Equal(t, []string{"services.conf"}, report.Changed)
+	require.Equal(t, []string{"worker.conf"}, report.Removed)
+	require.FileExists(t, filepath.Join(dir, "worker.conf"))
+
+	report, err = writer.Sync([]*supervisorkratos.GroupConfig{group}, nil)
+	require.NoError(t, err)
+	require.Equal(t, []string{"services.conf"}, report.Changed)
+	require.Equal(t, []string{"worker.conf"}, report.Removed)
+	require.NoFileExists(t, filepath.Join(dir, "worker.conf"))
+	require.FileExists(t, filepath.Join(dir, "manual.conf"))
+
+	entries, err := os.ReadDir(dir)
+	require.NoError(t, err)
+	require.Len(t, entries, 2) // No temp files left // 没有残留的临时文件
+}
+
+func TestConfWriterRefuse(t *testing.T) {
+	// Test invalid configs write nothing and files without marker are never overwritten
+	// 测试无效配置不写入任何内容，没有标记的文件永远不会被覆盖
+	dir := t.TempDir()
+	writer := supervisorkratos.NewConfWriter(dir)
+
+	good := supervisorkratos.NewProgramConfig("api", "/opt/api", "deploy", "/var/log/services")
+	bad := supervisorkratos.NewProgramConfig("bad", "/opt/bad", "deploy", "/var/log/services").WithStopSignal("BOOM")
+	_, err := writer.Write(nil, []*supervisorkratos.ProgramConfig{good, bad})
+	require.ErrorIs(t, err, supervisorkratos.ErrInvalidValue)
+	require.NoFileExists(t, filepath.Join(dir, "api.conf"))
+
+	_, err = writer.Write([]*supervisorkratos.GroupConfig{supervisorkratos.NewGroupConfig("api").AddProgram(good)}, []*supervisorkratos.ProgramConfig{good})
+	require.ErrorIs(t, err, supervisorkratos.ErrDuplicate)
+
+	// supervisor merges the same section across files, so a program may live in one file only
+	// supervisor 会合并各文件中的同名段，因此程序只能位于一个文件中
+	_, err = writer.Write([]*supervisorkratos.GroupConfig{supervisorkratos.NewGroupConfig("services").AddProgram(good)}, []*supervisorkratos.ProgramConfig{good})
+	require.ErrorIs(t, err, supervisorkratos.ErrDuplicate)
+	require.ErrorContains(t, err, "section [program:api] is in both services.conf and api.conf")
+	_, err = writer.Write([]*supervisorkratos.GroupConfig{
+		supervisorkratos.NewGroupConfig("services").AddProgram(good),
+		supervisorkratos.NewGroupConfig("backend").AddProgram(good),
+	}, nil)
+	require.ErrorIs(t, err, supervisorkratos.ErrDuplicate)
+	require.NoFileExists(t, filepath.Join(dir, "services.conf"))
+
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "api.conf"), []byte("[program:api]\n"), 0o644))
+	_, err = writer.WriteProgram(good)
+	require.Error(t, err)
+	_, err = writer.Remove("api")
+	require.Error(t, err)
+
+	require.NoError(t, os.Remove(filepath.Join(dir, "api.conf")))
+	report, err := writer.WriteProgram(good)
+	require.NoError(t, err)
+	require.Equal(t, []string{"api.conf"}, report.Added)
+	report, err = writer.Remove("api", "missing")
+	require.NoError(t, err)
+	require.Equal(t, []string{"api.conf"}, report.Removed)
+}
+
+func TestConfWriterRefuseWritesNothing(t *testing.T) {
+	// Test an unowned target refuses the whole write before any other file is written
+	// 测试存在非自有的目标文件时，在写入其他文件之前拒绝整个写入
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "zz.conf"), []byte("[program:zz]\n"), 0o644))
+
+	writer := supervisorkratos.NewConfWriter(dir)
+	_, err := writer.Write(nil, []*supervisorkratos.ProgramConfig{
+		supervisorkratos.NewProgramConfig("aa", "/opt/aa", "deploy", "/var/log/services"),
+		supervisorkratos.NewProgramConfig("zz", "/opt/zz", "deploy", "/var/log/services"),
+	})
+	require.ErrorContains(t, err, "refuse to overwrite zz.conf")
+
+	entries, err := os.ReadDir(dir)
+	require.NoError(t, err)
+	require.Len(t, entries, 1)
+	require.Equal(t, "zz.conf", entries[0].Name())
+	data, err := os.ReadFile(filepath.Join(dir, "zz.conf"))
+	require.NoError(t, err)
+	require.Equal(t, "[program:zz]\n", string(data))
+}
+
+func TestConfWriterRefuseOutsideDir(t *testing.T) {
+	// Test names resolving outside the directory are refused before touching files
+	// 测试解析到目录之外的名称在操作文件之前被拒绝
+	root := t.TempDir()
+	dir := filepath.Join(root, "conf.d")
+	require.NoError(t, os.Mkdir(dir, 0o755))
+	require.NoError(t, os.WriteFile(filepath.Join(root, "escape.conf"), []byte(supervisorkratos.ConfMarker+"\n"), 0o644))
+
+	writer := supervisorkratos.NewConfWriter(dir)
+	_, err := writer.Remove("../escape")
+	require.ErrorContains(t, err, "outside")
+	require.FileExists(t, filepath.Join(root, "escape.conf"))
+
+	_, err = supervisorkratos.NewBlueGreenDeploy(writer).Current("../escape")
+	require.ErrorContains(t, err, "outside")
+}
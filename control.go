@@ -0,0 +1,436 @@
+package supervisorkratos
+
+import (
+	"net"
+	"net/url"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/yyle88/must"
+	"github.com/yyle88/printgo"
+)
+
+// UnixHTTPServerConfig [unix_http_server] section configuration
+// [unix_http_server] 段配置
+type UnixHTTPServerConfig struct {
+	File     string       // Unix socket file path // unix socket 文件路径
+	Chmod    *Opt[string] // Socket file mode in octal // socket 文件的八进制权限
+	Chown    *Opt[string] // Socket file owner, "user" or "user:group" // socket 文件属主，"user" 或 "user:group"
+	Username *Opt[string] // Username for HTTP basic auth // HTTP 基本认证用户名
+	Password *Opt[string] // Password, plain text or {SHA}hex // 密码，明文或 {SHA}hex
+}
+
+// InetHTTPServerConfig [inet_http_server] section configuration
+// [inet_http_server] 段配置
+type InetHTTPServerConfig struct {
+	Port     string       // Listen address "host:port", "*:port" or a bare "port" for all interfaces // 监听地址 "host:port"，"*:port" 或单独的 "port" 表示所有网卡
+	Username *Opt[string] // Username for HTTP basic auth // HTTP 基本认证用户名
+	Password *Opt[string] // Password, plain text or {SHA}hex // 密码，明文或 {SHA}hex
+}
+
+// SupervisorctlConfig [supervisorctl] section configuration
+// [supervisorctl] 段配置
+type SupervisorctlConfig struct {
+	ServerURL   string       // Server URL, unix:///path or http://host:port // 服务地址，unix:///path 或 http://host:port
+	Username    *Opt[string] // Username to auth with server // 向服务端认证的用户名
+	Password    *Opt[string] // Password to auth with server // 向服务端认证的密码
+	Prompt      *Opt[string] // Prompt string // 提示符
+	HistoryFile *Opt[string] // Readline history file path // readline 历史文件路径
+}
+
+// RPCInterfaceConfig [rpcinterface:x] section configuration
+// [rpcinterface:x] 段配置
+type RPCInterfaceConfig struct {
+	Name    string // Interface name, "supervisor" for the standard one // 接口名称，标准接口为 "supervisor"
+	Factory string // Factory import path // 工厂函数导入路径
+}
+
+// NewUnixHTTPServerConfig create new UnixHTTPServerConfig with socket file path
+// 创建新的 UnixHTTPServerConfig，需要提供 socket 文件路径
+func NewUnixHTTPServerConfig(file string) *UnixHTTPServerConfig {
+	return &UnixHTTPServerConfig{
+		File:     must.Nice(file),
+		Chmod:    NewOpt("0700"),
+		Chown:    NewOpt(""),
+		Username: NewOpt(""),
+		Password: NewOpt(""),
+	}
+}
+
+// WithChmod set socket file mode in octal, e.g. "0770"
+// 设置 socket 文件的八进制权限，例如 "0770"
+func (c *UnixHTTPServerConfig) WithChmod(chmod string) *UnixHTTPServerConfig {
+	c.Chmod.Set(chmod)
+	return c
+}
+
+// WithChown set socket file owner, "user" or "user:group"
+// 设置 socket 文件属主，"user" 或 "user:group"
+func (c *UnixHTTPServerConfig) WithChown(chown string) *UnixHTTPServerConfig {
+	c.Chown.Set(chown)
+	return c
+}
+
+// WithCredentials set username and password for HTTP basic auth
+// 设置 HTTP 基本认证的用户名和密码
+func (c *UnixHTTPServerConfig) WithCredentials(username string, password string) *UnixHTTPServerConfig {
+	c.Username.Set(username)
+	c.Password.Set(password)
+	return c
+}
+
+// NewInetHTTPServerConfig create new InetHTTPServerConfig with listen address "host:port"
+// 创建新的 InetHTTPServerConfig，需要提供监听地址 "host:port"
+func NewInetHTTPServerConfig(port string) *InetHTTPServerConfig {
+	return &InetHTTPServerConfig{
+		Port:     must.Nice(port),
+		Username: NewOpt(""),
+		Password: NewOpt(""),
+	}
+}
+
+// WithCredentials set username and password for HTTP basic auth
+// 设置 HTTP 基本认证的用户名和密码
+func (c *InetHTTPServerConfig) WithCredentials(username string, password string) *InetHTTPServerConfig {
+	c.Username.Set(username)
+	c.Password.Set(password)
+	return c
+}
+
+// NewSupervisorctlConfig create new SupervisorctlConfig with server URL
+// 创建新的 SupervisorctlConfig，需要提供服务地址
+func NewSupervisorctlConfig(serverURL string) *SupervisorctlConfig {
+	return &SupervisorctlConfig{
+		ServerURL:   must.Nice(serverURL),
+		Username:    NewOpt(""),
+		Password:    NewOpt(""),
+		Prompt:      NewOpt("supervisor"),
+		HistoryFile: NewOpt(""),
+	}
+}
+
+// WithCredentials set username and password to auth with server
+// 设置向服务端认证的用户名和密码
+func (c *SupervisorctlConfig) WithCredentials(username string, password string) *SupervisorctlConfig {
+	c.Username.Set(username)
+	c.Password.Set(password)
+	return c
+}
+
+// WithPrompt set prompt string
+// 设置提示符
+func (c *SupervisorctlConfig) WithPrompt(prompt string) *SupervisorctlConfig {
+	c.Prompt.Set(prompt)
+	return c
+}
+
+// WithHistoryFile set readline history file path
+// 设置 readline 历史文件路径
+func (c *SupervisorctlConfig) WithHistoryFile(historyFile string) *SupervisorctlConfig {
+	c.HistoryFile.Set(historyFile)
+	return c
+}
+
+// NewRPCInterfaceConfig create the standard [rpcinterface:supervisor] config required by supervisorctl
+// 创建 supervisorctl 所需的标准 [rpcinterface:supervisor] 配置
+func NewRPCInterfaceConfig() *RPCInterfaceConfig {
+	return &RPCInterfaceConfig{
+		Name:    "supervisor",
+		Factory: "supervisor.rpcinterface:make_main_rpcinterface",
+	}
+}
+
+// Validate check unix http server config and return *ValidationError listing every invalid field
+// 校验 unix http server 配置，返回列出每个无效字段的 *ValidationError
+func (c *UnixHTTPServerConfig) Validate() error {
+	v := &validator{}
+	c.validateFields(v)
+	return v.result()
+}
+
+func (c *UnixHTTPServerConfig) validateFields(v *validator) {
+	const section = "unix_http_server"
+	if c == nil {
+		v.add(section, "UnixHTTPServerConfig", nil, ErrRequired, "nil config")
+		return
+	}
+	checkAbsPath(v, section, "File", c.File)
+	if c.Chmod == nil || c.Chown == nil || c.Username == nil || c.Password == nil {
+		v.add(section, "UnixHTTPServerConfig", nil, ErrRequired, "option is nil, create config with NewUnixHTTPServerConfig")
+		return
+	}
+	if mode, err := strconv.ParseUint(c.Chmod.Get(), 8, 32); err != nil || mode > 0o7777 {
+		v.add(section, "Chmod", c.Chmod.Get(), ErrInvalidValue, "expect octal mode like \"0700\"")
+	}
+	if c.Chown.IsSet() {
+		userName, groupName, hasGroup := strings.Cut(c.Chown.Get(), ":")
+		if userName == "" || (hasGroup && groupName == "") || strings.ContainsAny(c.Chown.Get(), " \t\n") {
+			v.add(section, "Chown", c.Chown.Get(), ErrInvalidValue, "expect \"user\" or \"user:group\"")
+		}
+	}
+	checkCredentials(v, section, c.Username, c.Password)
+}
+
+// Validate check inet http server config and return *ValidationError listing every invalid field
+// 校验 inet http server 配置，返回列出每个无效字段的 *ValidationError
+func (c *InetHTTPServerConfig) Validate() error {
+	v := &validator{}
+	c.validateFields(v)
+	return v.result()
+}
+
+func (c *InetHTTPServerConfig) validateFields(v *validator) {
+	const section = "inet_http_server"
+	if c == nil {
+		v.add(section, "InetHTTPServerConfig", nil, ErrRequired, "nil config")
+		return
+	}
+	if c.Username == nil || c.Password == nil {
+		v.add(section, "InetHTTPServerConfig", nil, ErrRequired, "option is nil, create config with NewInetHTTPServerConfig")
+		return
+	}
+	if _, _, err := inetAddress(c.Port); err != nil {
+		v.add(section, "Port", c.Port, ErrInvalidValue, "%s", err.Error())
+	}
+	checkCredentials(v, section, c.Username, c.Password)
+}
+
+// Validate check supervisorctl config and return *ValidationError listing every invalid field
+// 校验 supervisorctl 配置，返回列出每个无效字段的 *ValidationError
+func (c *SupervisorctlConfig) Validate() error {
+	v := &validator{}
+	c.validateFields(v)
+	return v.result()
+}
+
+func (c *SupervisorctlConfig) validateFields(v *validator) {
+	const section = "supervisorctl"
+	if c == nil {
+		v.add(section, "SupervisorctlConfig", nil, ErrRequired, "nil config")
+		return
+	}
+	if c.Username == nil || c.Password == nil || c.Prompt == nil || c.HistoryFile == nil {
+		v.add(section, "SupervisorctlConfig", nil, ErrRequired, "option is nil, create config with NewSupervisorctlConfig")
+		return
+	}
+	if _, err := parseServerURL(c.ServerURL); err != nil {
+		v.add(section, "ServerURL", c.ServerURL, ErrInvalidValue, "%s", err.Error())
+	}
+	checkCredentials(v, section, c.Username, c.Password)
+	if c.Prompt.Get() == "" {
+		v.add(section, "Prompt", c.Prompt.Get(), ErrRequired, "prompt is empty")
+	}
+	if c.HistoryFile.IsSet() {
+		checkAbsPath(v, section, "HistoryFile", c.HistoryFile.Get())
+	}
+}
+
+// Validate check rpc interface config and return *ValidationError listing every invalid field
+// 校验 rpc interface 配置，返回列出每个无效字段的 *ValidationError
+func (c *RPCInterfaceConfig) Validate() error {
+	v := &validator{}
+	c.validateFields(v)
+	return v.result()
+}
+
+func (c *RPCInterfaceConfig) validateFields(v *validator) {
+	if c == nil {
+		v.add("rpcinterface", "RPCInterfaceConfig", nil, ErrRequired, "nil config")
+		return
+	}
+	section := "rpcinterface:" + c.Name
+	if !isValidSectionName(c.Name) {
+		v.add(section, "Name", c.Name, ErrInvalidValue, sectionNameReason)
+	}
+	if module, function, ok := strings.Cut(c.Factory, ":"); !ok || module == "" || function == "" {
+		v.add(section, "Factory", c.Factory, ErrInvalidValue, "expect \"module:function\"")
+	}
+}
+
+func checkCredentials(v *validator, section string, username *Opt[string], password *Opt[string]) {
+	if username.Get() != "" && password.Get() == "" {
+		v.add(section, "Password", "", ErrRequired, "username is set without password")
+	}
+	if username.Get() == "" && password.Get() != "" {
+		v.add(section, "Username", "", ErrRequired, "password is set without username")
+	}
+}
+
+// splitHostPort split "host:port" address, host may be empty or "*"
+// 拆分 "host:port" 地址，host 可以为空或 "*"
+func splitHostPort(address string) (string, int, error) {
+	host, portText, err := net.SplitHostPort(address)
+	if err != nil {
+		return "", 0, err
+	}
+	port, err := strconv.Atoi(portText)
+	if err != nil || port < 1 || port > 65535 {
+		return "", 0, &net.AddrError{Err: "invalid port", Addr: address}
+	}
+	return host, port, nil
+}
+
+// inetAddress split the port of [inet_http_server], a bare port listens on every interface like supervisor's inet_address
+// 拆分 [inet_http_server] 的 port，与 supervisor 的 inet_address 一样，单独的端口监听所有网卡
+func inetAddress(address string) (string, int, error) {
+	if !strings.Contains(address, ":") {
+		return splitHostPort(":" + address)
+	}
+	return splitHostPort(address)
+}
+
+// parseServerURL parse supervisorctl server URL, accepts unix:///path and http://host:port
+// 解析 supervisorctl 服务地址，接受 unix:///path 和 http://host:port
+func parseServerURL(serverURL string) (*url.URL, error) {
+	res, err := url.Parse(serverURL)
+	if err != nil {
+		return nil, err
+	}
+	switch res.Scheme {
+	case "unix":
+		if !filepath.IsAbs(res.Path) {
+			return nil, &url.Error{Op: "parse", URL: serverURL, Err: errInvalidServerURL}
+		}
+	case "http":
+		if _, _, err := splitHostPort(res.Host); err != nil {
+			return nil, &url.Error{Op: "parse", URL: serverURL, Err: err}
+		}
+	default:
+		return nil, &url.Error{Op: "parse", URL: serverURL, Err: errInvalidServerURL}
+	}
+	return res, nil
+}
+
+var errInvalidServerURL = errors.New("expect unix:///path or http://host:port")
+
+// GenerateUnixHTTPServerConfig generate [unix_http_server] section, panics on invalid config
+// 生成 [unix_http_server] 段，配置无效时 panic
+func GenerateUnixHTTPServerConfig(config *UnixHTTPServerConfig) string {
+	return must.V1(GenerateUnixHTTPServerConfigE(config))
+}
+
+// GenerateUnixHTTPServerConfigE generate [unix_http_server] section
+// Returns *ValidationError listing every invalid field
+//
+// 生成 [unix_http_server] 段
+// 返回列出所有无效字段的 *ValidationError
+func GenerateUnixHTTPServerConfigE(config *UnixHTTPServerConfig) (string, error) {
+	if err := config.Validate(); err != nil {
+		return "", err
+	}
+	return renderUnixHTTPServerConfig(config), nil
+}
+
+func renderUnixHTTPServerConfig(config *UnixHTTPServerConfig) string {
+	ptx := printgo.NewPTX()
+	ptx.Println("[unix_http_server]")
+	ptx.Println(iniLine("file", config.File))
+	if config.Chmod.IsSet() {
+		ptx.Println(iniLine("chmod", config.Chmod.Get()))
+	}
+	if config.Chown.IsSet() {
+		ptx.Println(iniLine("chown", config.Chown.Get()))
+	}
+	if config.Username.IsSet() {
+		ptx.Println(iniLine("username", escapePercent(config.Username.Get())))
+	}
+	if config.Password.IsSet() {
+		ptx.Println(iniLine("password", escapePercent(config.Password.Get())))
+	}
+	return ptx.String()
+}
+
+// GenerateInetHTTPServerConfig generate [inet_http_server] section, panics on invalid config
+// 生成 [inet_http_server] 段，配置无效时 panic
+func GenerateInetHTTPServerConfig(config *InetHTTPServerConfig) string {
+	return must.V1(GenerateInetHTTPServerConfigE(config))
+}
+
+// GenerateInetHTTPServerConfigE generate [inet_http_server] section
+// Returns *ValidationError listing every invalid field
+//
+// 生成 [inet_http_server] 段
+// 返回列出所有无效字段的 *ValidationError
+func GenerateInetHTTPServerConfigE(config *InetHTTPServerConfig) (string, error) {
+	if err := config.Validate(); err != nil {
+		return "", err
+	}
+	return renderInetHTTPServerConfig(config), nil
+}
+
+func renderInetHTTPServerConfig(config *InetHTTPServerConfig) string {
+	ptx := printgo.NewPTX()
+	ptx.Println("[inet_http_server]")
+	ptx.Println(iniLine("port", config.Port))
+	if config.Username.IsSet() {
+		ptx.Println(iniLine("username", escapePercent(config.Username.Get())))
+	}
+	if config.Password.IsSet() {
+		ptx.Println(iniLine("password", escapePercent(config.Password.Get())))
+	}
+	return ptx.String()
+}
+
+// GenerateSupervisorctlConfig generate [supervisorctl] section, panics on invalid config
+// 生成 [supervisorctl] 段，配置无效时 panic
+func GenerateSupervisorctlConfig(config *SupervisorctlConfig) string {
+	return must.V1(GenerateSupervisorctlConfigE(config))
+}
+
+// GenerateSupervisorctlConfigE generate [supervisorctl] section
+// Returns *ValidationError listing every invalid field
+//
+// 生成 [supervisorctl] 段
+// 返回列出所有无效字段的 *ValidationError
+func GenerateSupervisorctlConfigE(config *SupervisorctlConfig) (string, error) {
+	if err := config.Validate(); err != nil {
+		return "", err
+	}
+	return renderSupervisorctlConfig(config), nil
+}
+
+func renderSupervisorctlConfig(config *SupervisorctlConfig) string {
+	ptx := printgo.NewPTX()
+	ptx.Println("[supervisorctl]")
+	ptx.Println(iniLine("serverurl", config.ServerURL))
+	if config.Username.IsSet() {
+		ptx.Println(iniLine("username", escapePercent(config.Username.Get())))
+	}
+	if config.Password.IsSet() {
+		ptx.Println(iniLine("password", escapePercent(config.Password.Get())))
+	}
+	if config.Prompt.IsSet() {
+		ptx.Println(iniLine("prompt", config.Prompt.Get()))
+	}
+	if config.HistoryFile.IsSet() {
+		ptx.Println(iniLine("history_file", config.HistoryFile.Get()))
+	}
+	return ptx.String()
+}
+
+// GenerateRPCInterfaceConfig generate [rpcinterface:x] section, panics on invalid config
+// 生成 [rpcinterface:x] 段，配置无效时 panic
+func GenerateRPCInterfaceConfig(config *RPCInterfaceConfig) string {
+	return must.V1(GenerateRPCInterfaceConfigE(config))
+}
+
+// GenerateRPCInterfaceConfigE generate [rpcinterface:x] section
+// Returns *ValidationError listing every invalid field
+//
+// 生成 [rpcinterface:x] 段
+// 返回列出所有无效字段的 *ValidationError
+func GenerateRPCInterfaceConfigE(config *RPCInterfaceConfig) (string, error) {
+	if err := config.Validate(); err != nil {
+		return "", err
+	}
+	return renderRPCInterfaceConfig(config), nil
+}
+
+func renderRPCInterfaceConfig(config *RPCInterfaceConfig) string {
+	ptx := printgo.NewPTX()
+	ptx.Println("[rpcinterface:" + config.Name + "]")
+	ptx.Println(iniLine("supervisor.rpcinterface_factory", config.Factory))
+	return ptx.String()
+}
@@ -0,0 +1,174 @@
+package supervisorkratos_test
+
+import (
+	"testing"
+
+	"github.com/orzkratos/supervisorkratos"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/require"
+)
+
+func TestControlSections(t *testing.T) {
+	// Test each control-plane section renders on its own
+	// 测试每个控制面段可以单独渲染
+	unixServer := supervisorkratos.NewUnixHTTPServerConfig("/var/run/supervisor.sock").
+		WithChmod("0770").
+		WithChown("root:deploy").
+		WithCredentials("admin", "{SHA}e5e9fa1ba31ecd1ae84f75caaa474f3a663f05f4")
+	require.Equal(t, `[unix_http_server]
+file            = /var/run/supervisor.sock
+chmod           = 0770
+chown           = root:deploy
+username        = admin
+password        = {SHA}e5e9fa1ba31ecd1ae84f75caaa474f3a663f05f4
+`, supervisorkratos.GenerateUnixHTTPServerConfig(unixServer))
+
+	inetServer := supervisorkratos.NewInetHTTPServerConfig("127.0.0.1:9001").
+		WithCredentials("admin", "secret")
+	require.Equal(t, `[inet_http_server]
+port            = 127.0.0.1:9001
+username        = admin
+password        = secret
+`, supervisorkratos.GenerateInetHTTPServerConfig(inetServer))
+
+	// A bare port listens on every interface, "%" in credentials is escaped since supervisor expands them
+	// 单独的端口监听所有网卡，supervisor 会展开凭据，因此其中的 "%" 会被转义
+	inetServer = supervisorkratos.NewInetHTTPServerConfig("9001").
+		WithCredentials("admin", "50%off-%(ENV_SUPERVISOR_SALT)s")
+	require.Equal(t, `[inet_http_server]
+port            = 9001
+username        = admin
+password        = 50%%off-%(ENV_SUPERVISOR_SALT)s
+`, supervisorkratos.GenerateInetHTTPServerConfig(inetServer))
+	_, err := supervisorkratos.GenerateMainConfigE(supervisorkratos.NewMainConfig(
+		supervisorkratos.NewSupervisordConfig("/var/log/supervisor/supervisord.log", "/var/run/supervisord.pid"),
+	).WithInetHTTPServer(inetServer).WithSupervisorctl(supervisorkratos.NewSupervisorctlConfig("http://127.0.0.1:9001")))
+	require.NoError(t, err)
+
+	supervisorctl := supervisorkratos.NewSupervisorctlConfig("unix:///var/run/supervisor.sock").
+		WithPrompt("kratos").
+		WithHistoryFile("/root/.sc_history")
+	require.Equal(t, `[supervisorctl]
+serverurl       = unix:///var/run/supervisor.sock
+prompt          = kratos
+history_file    = /root/.sc_history
+`, supervisorkratos.GenerateSupervisorctlConfig(supervisorctl))
+
+	require.Equal(t, `[rpcinterface:supervisor]
+supervisor.rpcinterface_factory = supervisor.rpcinterface:make_main_rpcinterface
+`, supervisorkratos.GenerateRPCInterfaceConfig(supervisorkratos.NewRPCInterfaceConfig()))
+}
+
+func TestMainConfig(t *testing.T) {
+	// Test complete supervisord.conf with every section
+	// 测试包含所有段的完整 supervisord.conf
+	config := supervisorkratos.NewMainConfig(
+		supervisorkratos.NewSupervisordConfig(
+			"/var/log/supervisor/supervisord.log",
+			"/var/run/supervisord.pid",
+		).WithChildlogdir("/var/log/supervisor"),
+	).WithUnixHTTPServer(
+		supervisorkratos.NewUnixHTTPServerConfig("/var/run/supervisor.sock").WithChmod("0700"),
+	).WithInetHTTPServer(
+		supervisorkratos.NewInetHTTPServerConfig("*:9001").WithCredentials("admin", "secret"),
+	).WithSupervisorctl(
+		supervisorkratos.NewSupervisorctlConfig("unix:///var/run/supervisor.sock"),
+	).WithInclude("/etc/supervisor/conf.d/*.conf")
+
+	content := supervisorkratos.GenerateMainConfig(config)
+	t.Log("=== Complete supervisord.conf ===")
+	t.Log(content)
+
+	const expected = `[supervisord]
+logfile         = /var/log/supervisor/supervisord.log
+pidfile         = /var/run/supervisord.pid
+childlogdir     = /var/log/supervisor
+
+[unix_http_server]
+file            = /var/run/supervisor.sock
+chmod           = 0700
+
+[inet_http_server]
+port            = *:9001
+username        = admin
+password        = secret
+
+[rpcinterface:supervisor]
+supervisor.rpcinterface_factory = supervisor.rpcinterface:make_main_rpcinterface
+
+[supervisorctl]
+serverurl       = unix:///var/run/supervisor.sock
+
+[include]
+files           = /etc/supervisor/conf.d/*.conf
+`
+
+	require.Equal(t, expected, content)
+
+	sections, err := supervisorkratos.ParseIni(content)
+	require.NoError(t, err)
+	require.Len(t, sections, 6)
+
+	// The http server URL matches the inet server on any interface
+	// http 服务地址可以匹配监听所有网卡的 inet 服务
+	config.Supervisorctl = supervisorkratos.NewSupervisorctlConfig("http://localhost:9001").WithCredentials("admin", "secret")
+	require.NoError(t, config.Validate())
+}
+
+func TestMainConfigServerURLMismatch(t *testing.T) {
+	// Test supervisorctl serverurl must match a configured server
+	// 测试 supervisorctl 的 serverurl 必须与已配置的服务端一致
+	newConfig := func() *supervisorkratos.MainConfig {
+		return supervisorkratos.NewMainConfig(
+			supervisorkratos.NewSupervisordConfig(
+				"/var/log/supervisor/supervisord.log",
+				"/var/run/supervisord.pid",
+			),
+		).WithUnixHTTPServer(
+			supervisorkratos.NewUnixHTTPServerConfig("/var/run/supervisor.sock"),
+		).WithInetHTTPServer(
+			supervisorkratos.NewInetHTTPServerConfig("127.0.0.1:9001"),
+		)
+	}
+
+	testCases := map[string]*supervisorkratos.MainConfig{
+		"other socket":    newConfig().WithSupervisorctl(supervisorkratos.NewSupervisorctlConfig("unix:///tmp/supervisor.sock")),
+		"other port":      newConfig().WithSupervisorctl(supervisorkratos.NewSupervisorctlConfig("http://127.0.0.1:9002")),
+		"other host":      newConfig().WithSupervisorctl(supervisorkratos.NewSupervisorctlConfig("http://10.0.0.1:9001")),
+		"no servers":      supervisorkratos.NewMainConfig(supervisorkratos.NewSupervisordConfig("/var/log/s.log", "/var/run/s.pid")).WithSupervisorctl(supervisorkratos.NewSupervisorctlConfig("unix:///var/run/supervisor.sock")),
+		"no rpcinterface": newConfig().WithRPCInterface(nil).WithSupervisorctl(supervisorkratos.NewSupervisorctlConfig("unix:///var/run/supervisor.sock")),
+	}
+	for name, config := range testCases {
+		t.Run(name, func(t *testing.T) {
+			_, err := supervisorkratos.GenerateMainConfigE(config)
+			require.Error(t, err)
+			t.Log(err)
+
+			var verr *supervisorkratos.ValidationError
+			require.True(t, errors.As(err, &verr))
+			require.Len(t, verr.Section("supervisorctl"), 1)
+		})
+	}
+}
+
+func TestControlSectionsValidate(t *testing.T) {
+	// Test invalid control-plane values are reported
+	// 测试无效的控制面取值会被报告
+	_, err := supervisorkratos.GenerateUnixHTTPServerConfigE(
+		supervisorkratos.NewUnixHTTPServerConfig("supervisor.sock").WithChmod("0999").WithChown("root:"),
+	)
+	require.ErrorIs(t, err, supervisorkratos.ErrInvalidValue)
+	t.Log(err)
+
+	_, err = supervisorkratos.GenerateInetHTTPServerConfigE(
+		supervisorkratos.NewInetHTTPServerConfig("9001").WithCredentials("admin", ""),
+	)
+	require.ErrorIs(t, err, supervisorkratos.ErrRequired)
+	t.Log(err)
+
+	_, err = supervisorkratos.GenerateSupervisorctlConfigE(
+		supervisorkratos.NewSupervisorctlConfig("ftp://127.0.0.1:9001"),
+	)
+	require.ErrorIs(t, err, supervisorkratos.ErrInvalidValue)
+	t.Log(err)
+}
@@ -0,0 +1,234 @@
+package supervisorkratos
+
+import (
+	"context"
+	"os"
+	"time"
+
+	"github.com/orzkratos/supervisorkratos/supervisorrpc"
+	"github.com/pkg/errors"
+	"github.com/yyle88/must"
+)
+
+// DeployColor slot of a blue/green deploy
+// 蓝绿部署的槽位
+type DeployColor string
+
+const (
+	DeployBlue  DeployColor = "blue"  // Program runs as <name>-blue // 程序以 <name>-blue 运行
+	DeployGreen DeployColor = "green" // Program runs as <name>-green // 程序以 <name>-green 运行
+)
+
+// DeployClient supervisord XML-RPC methods used by BlueGreenDeploy, implemented by *supervisorrpc.Client
+// BlueGreenDeploy 使用的 supervisord XML-RPC 方法，由 *supervisorrpc.Client 实现
+type DeployClient interface {
+	SupervisorClient
+	ProcessClient
+}
+
+// BlueGreenDeploy deploy a program next to the running one, then retire the old one
+// Each color is a standalone <name>-<color>.conf, so starting one never restarts the other
+// The conf files in Writer.Dir are the source of truth of which color is live
+//
+// 在运行中的程序旁部署新程序，然后下线旧程序
+// 每个颜色是独立的 <name>-<color>.conf，因此启动一个不会重启另一个
+// Writer.Dir 中的配置文件是当前哪个颜色在线的唯一依据
+type BlueGreenDeploy struct {
+	Writer       *ConfWriter     // Writer of the conf.d directory // conf.d 目录的写入器
+	HealthCheck  HealthCheckFunc // Optional gate after each new instance is RUNNING // 每个新实例 RUNNING 后的可选检查
+	PollInterval time.Duration   // Interval of getProcessInfo polls // getProcessInfo 轮询间隔
+	Timeout      time.Duration   // Max wait of new instances, 0 derives it from the program // 新实例的最长等待时间，0 表示根据程序推算
+}
+
+// NewBlueGreenDeploy create new BlueGreenDeploy writing into the writer directory
+// 创建新的 BlueGreenDeploy，写入 writer 的目录
+func NewBlueGreenDeploy(writer *ConfWriter) *BlueGreenDeploy {
+	return &BlueGreenDeploy{
+		Writer:       must.Full(writer),
+		HealthCheck:  nil,
+		PollInterval: 500 * time.Millisecond,
+		Timeout:      0,
+	}
+}
+
+// WithHealthCheck set health check gate, a failing check rolls the new color back, nil falls back to ProgramConfig.HealthCheck
+// 设置健康检查关卡，检查失败会回滚新颜色，nil 时使用 ProgramConfig.HealthCheck
+func (d *BlueGreenDeploy) WithHealthCheck(healthCheck HealthCheckFunc) *BlueGreenDeploy {
+	d.HealthCheck = healthCheck
+	return d
+}
+
+// WithPollInterval set interval of getProcessInfo polls
+// 设置 getProcessInfo 轮询间隔
+func (d *BlueGreenDeploy) WithPollInterval(pollInterval time.Duration) *BlueGreenDeploy {
+	d.PollInterval = pollInterval
+	return d
+}
+
+// WithTimeout set max wait of new instances
+// 设置新实例的最长等待时间
+func (d *BlueGreenDeploy) WithTimeout(timeout time.Duration) *BlueGreenDeploy {
+	d.Timeout = timeout
+	return d
+}
+
+// DeployReport result of BlueGreenDeploy.Deploy
+// BlueGreenDeploy.Deploy 的结果
+type DeployReport struct {
+	From       string   // Retired program name, a color or the plain name, empty when nothing was live // 下线的程序名称，为某个颜色或普通名称，没有在线程序时为空
+	To         string   // New program name // 新的程序名称
+	Started    []string // Started process names // 已启动的进程名称
+	RolledBack bool     // New color removed after a failure // 失败后新颜色已被删除
+}
+
+// Current live color of program name read from the conf files, empty when none is deployed
+// 从配置文件读取程序的在线颜色，未部署时为空
+func (d *BlueGreenDeploy) Current(name string) (DeployColor, error) {
+	var res DeployColor
+	for _, color := range []DeployColor{DeployBlue, DeployGreen} {
+		owned, err := d.Writer.ownsConf(name + "-" + string(color) + ".conf")
+		if err != nil {
+			return "", err
+		}
+		if !owned {
+			continue
+		}
+		if res != "" {
+			return "", errors.Errorf("both %s-blue and %s-green are deployed, remove one to continue", name, name)
+		}
+		res = color
+	}
+	return res, nil
+}
+
+// Deploy run program as <name>-<color> with root as Root next to the live color, wait for health, then retire the live color
+// When no color is deployed yet, an owned plain <name>.conf holding only [program:<name>] is the live program and is retired the same way
+// On failure the new color is stopped and removed and the live color keeps running
+// Both colors run at the same time, so listen ports must not clash (e.g. pass a port per release in Args)
+//
+// 以 root 作为 Root，在在线颜色旁运行 <name>-<color>，等待健康后下线在线颜色
+// 尚未部署任何颜色时，只包含 [program:<name>] 的自有普通 <name>.conf 即为在线程序，以同样的方式下线
+// 失败时新颜色会被停止和删除，在线颜色继续运行
+// 两个颜色会同时运行，因此监听端口不能冲突（例如在 Args 中为每次发布传入端口）
+func (d *BlueGreenDeploy) Deploy(ctx context.Context, client DeployClient, program *ProgramConfig, root string) (*DeployReport, error) {
+	if err := program.Validate(); err != nil {
+		return nil, err
+	}
+	current, err := d.Current(program.Name)
+	if err != nil {
+		return nil, err
+	}
+	color := DeployBlue
+	if current == DeployBlue {
+		color = DeployGreen
+	}
+	previous := ""
+	if current != "" {
+		previous = program.Name + "-" + string(current)
+	} else {
+		// First deploy of a program running under its plain name // 以普通名称运行的程序的首次部署
+		plain, err := d.plainProgram(program.Name)
+		if err != nil {
+			return nil, err
+		}
+		if plain {
+			previous = program.Name
+		}
+	}
+
+	next := program.Clone()
+	next.Name = program.Name + "-" + string(color)
+	next.Root = root
+	if !next.BinName.IsSet() {
+		next.BinName.Set(program.Name) // Binary keeps its name inside the new root // 二进制文件在新根目录中保持原名
+	}
+	if err := next.Validate(); err != nil {
+		return nil, err
+	}
+	report := &DeployReport{To: next.Name}
+	if _, err := d.Writer.ApplyProgram(ctx, client, next); err != nil {
+		return report, errors.WithMessagef(err, "apply %s", next.Name)
+	}
+
+	if err := d.startHealthy(ctx, client, next, report); err != nil {
+		if _, rollbackErr := d.Writer.ApplyRemove(ctx, client, next.Name); rollbackErr != nil {
+			return report, errors.WithMessagef(err, "start %s (rollback failed: %v)", next.Name, rollbackErr)
+		}
+		report.RolledBack = true
+		return report, errors.WithMessagef(err, "start %s", next.Name)
+	}
+
+	if previous != "" {
+		report.From = previous
+		if _, err := d.Writer.ApplyRemove(ctx, client, report.From); err != nil {
+			return report, errors.WithMessagef(err, "retire %s", report.From)
+		}
+	}
+	return report, nil
+}
+
+// plainProgram check an owned <name>.conf runs the program under its plain name
+// Retiring removes the whole file, so a file with any other section (e.g. a group of the same name) is an error
+//
+// 检查自有的 <name>.conf 是否以普通名称运行该程序
+// 下线会删除整个文件，因此包含其他段的文件（例如同名的组）会报错
+func (d *BlueGreenDeploy) plainProgram(name string) (bool, error) {
+	fileName := name + ".conf"
+	owned, err := d.Writer.ownsConf(fileName)
+	if err != nil || !owned {
+		return false, err
+	}
+	path, err := d.Writer.confPath(fileName)
+	if err != nil {
+		return false, err
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return false, errors.WithMessagef(err, "read %s", fileName)
+	}
+	sections, err := ParseIni(string(data))
+	if err != nil {
+		return false, errors.WithMessagef(err, "parse %s", fileName)
+	}
+	if len(sections) != 1 || sections[0].Name != "program:"+name {
+		return false, errors.Errorf("%s holds more than [program:%s], move the other sections out before the first deploy", fileName, name)
+	}
+	return true, nil
+}
+
+// startHealthy start every instance of program, wait RUNNING for StartSecs and run the health check
+// 启动程序的每个实例，等待 RUNNING 达到 StartSecs 并执行健康检查
+func (d *BlueGreenDeploy) startHealthy(ctx context.Context, client ProcessClient, program *ProgramConfig, report *DeployReport) error {
+	timeout := d.Timeout
+	if timeout <= 0 {
+		timeout = startTimeout(program)
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	healthCheck := d.HealthCheck
+	if healthCheck == nil && program.HealthCheck != nil {
+		healthCheck = program.HealthCheckFunc("")
+	}
+
+	names := program.ProcessNames("")
+	for _, name := range names {
+		// Autostart programs are already starting after addProcessGroup
+		// 自动启动的程序在 addProcessGroup 之后已经在启动中
+		if err := client.StartProcess(ctx, name, false); err != nil && !supervisorrpc.IsFault(err, supervisorrpc.FaultAlreadyStarted) {
+			return errors.WithMessagef(err, "start %s", name)
+		}
+		report.Started = append(report.Started, name)
+	}
+	for _, name := range names {
+		if err := waitProcessRunning(ctx, client, name, program.StartSecs.Get(), d.PollInterval); err != nil {
+			return err
+		}
+		if healthCheck != nil {
+			if err := healthCheck(ctx, name); err != nil {
+				return errors.WithMessagef(err, "health check %s", name)
+			}
+		}
+	}
+	return nil
+}
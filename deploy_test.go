@@ -0,0 +1,193 @@
+package supervisorkratos_test
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/orzkratos/supervisorkratos"
+	"github.com/orzkratos/supervisorkratos/supervisorrpc"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeDeploySupervisor reread the conf.d directory like supervisord and run processes instantly
+// fakeDeploySupervisor 像 supervisord 一样重新读取 conf.d 目录，进程立即运行
+type fakeDeploySupervisor struct {
+	dir        string
+	configured []string
+	active     []string
+	running    map[string]bool
+	calls      []string
+}
+
+func (f *fakeDeploySupervisor) ReloadConfig(ctx context.Context) (*supervisorrpc.ReloadResult, error) {
+	entries, err := os.ReadDir(f.dir)
+	if err != nil {
+		return nil, err
+	}
+	var configured []string
+	for _, entry := range entries {
+		configured = append(configured, strings.TrimSuffix(entry.Name(), ".conf"))
+	}
+	res := &supervisorrpc.ReloadResult{}
+	for _, name := range configured {
+		if !slices.Contains(f.active, name) {
+			res.Added = append(res.Added, name)
+		}
+	}
+	for _, name := range f.active {
+		if !slices.Contains(configured, name) {
+			res.Removed = append(res.Removed, name)
+		}
+	}
+	f.configured = configured
+	return res, nil
+}
+
+func (f *fakeDeploySupervisor) AddProcessGroup(ctx context.Context, name string) error {
+	f.calls = append(f.calls, "add "+name)
+	f.active = append(f.active, name)
+	return nil
+}
+
+func (f *fakeDeploySupervisor) RemoveProcessGroup(ctx context.Context, name string) error {
+	f.calls = append(f.calls, "remove "+name)
+	f.active = slices.DeleteFunc(f.active, func(s string) bool { return s == name })
+	return nil
+}
+
+func (f *fakeDeploySupervisor) StopProcessGroup(ctx context.Context, name string, wait bool) ([]*supervisorrpc.ProcessStatus, error) {
+	f.calls = append(f.calls, "stop "+name)
+	delete(f.running, name+":"+name)
+	return nil, nil
+}
+
+func (f *fakeDeploySupervisor) GetProcessInfo(ctx context.Context, name string) (*supervisorrpc.ProcessInfo, error) {
+	now := time.Unix(1700000000, 0)
+	if !f.running[name] {
+		return &supervisorrpc.ProcessInfo{State: supervisorrpc.ProcessStopped}, nil
+	}
+	return &supervisorrpc.ProcessInfo{State: supervisorrpc.ProcessRunning, Start: now, Now: now.Add(time.Minute)}, nil
+}
+
+func (f *fakeDeploySupervisor) StartProcess(ctx context.Context, name string, wait bool) error {
+	f.calls = append(f.calls, "start "+name)
+	f.running[name] = true
+	return nil
+}
+
+func (f *fakeDeploySupervisor) StopProcess(ctx context.Context, name string, wait bool) error {
+	delete(f.running, name)
+	return nil
+}
+
+func TestBlueGreenDeploy(t *testing.T) {
+	// Test deploys alternate between blue and green and retire the previous color
+	// 测试部署在蓝绿之间交替并下线之前的颜色
+	dir := t.TempDir()
+	client := &fakeDeploySupervisor{dir: dir, running: map[string]bool{}}
+	program := supervisorkratos.NewProgramConfig("api", "/opt/api/v1", "deploy", "/var/log/services")
+	deploy := supervisorkratos.NewBlueGreenDeploy(supervisorkratos.NewConfWriter(dir)).WithPollInterval(time.Millisecond)
+
+	report, err := deploy.Deploy(context.Background(), client, program, "/opt/api/v1")
+	require.NoError(t, err)
+	require.Equal(t, &supervisorkratos.DeployReport{To: "api-blue", Started: []string{"api-blue:api-blue"}}, report)
+
+	report, err = deploy.Deploy(context.Background(), client, program, "/opt/api/v2")
+	require.NoError(t, err)
+	require.Equal(t, "api-blue", report.From)
+	require.Equal(t, "api-green", report.To)
+	require.Equal(t, []string{"api-green"}, client.active)
+
+	color, err := deploy.Current("api")
+	require.NoError(t, err)
+	require.Equal(t, supervisorkratos.DeployGreen, color)
+
+	// The live conf runs the binary of the new root, named after the original program
+	// 在线配置运行新根目录下的二进制文件，文件名沿用原程序名
+	content, err := os.ReadFile(filepath.Join(dir, "api-green.conf"))
+	require.NoError(t, err)
+	require.Contains(t, string(content), "command         = /opt/api/v2/bin/api\n")
+	require.Contains(t, string(content), "stdout_logfile  = /var/log/services/api-green.log\n")
+	require.NoFileExists(t, filepath.Join(dir, "api-blue.conf"))
+
+	// Original program is untouched
+	// 原程序保持不变
+	require.Equal(t, "api", program.Name)
+	require.Equal(t, "/opt/api/v1", program.Root)
+}
+
+func TestBlueGreenDeployRollback(t *testing.T) {
+	// Test failing health check removes the new color and keeps the live one
+	// 测试健康检查失败会删除新颜色并保留在线颜色
+	dir := t.TempDir()
+	client := &fakeDeploySupervisor{dir: dir, running: map[string]bool{}}
+	program := supervisorkratos.NewProgramConfig("api", "/opt/api/v1", "deploy", "/var/log/services")
+	deploy := supervisorkratos.NewBlueGreenDeploy(supervisorkratos.NewConfWriter(dir)).WithPollInterval(time.Millisecond)
+
+	_, err := deploy.Deploy(context.Background(), client, program, "/opt/api/v1")
+	require.NoError(t, err)
+
+	errUnhealthy := errors.New("unhealthy")
+	deploy.WithHealthCheck(func(ctx context.Context, name string) error { return errUnhealthy })
+	report, err := deploy.Deploy(context.Background(), client, program, "/opt/api/v2")
+	require.ErrorIs(t, err, errUnhealthy)
+	require.True(t, report.RolledBack)
+	require.Equal(t, []string{"api-blue"}, client.active)
+	require.NoFileExists(t, filepath.Join(dir, "api-green.conf"))
+
+	color, err := deploy.Current("api")
+	require.NoError(t, err)
+	require.Equal(t, supervisorkratos.DeployBlue, color)
+}
+
+func TestBlueGreenDeployMigrate(t *testing.T) {
+	// Test the first deploy of a program running under its plain name retires the plain conf
+	// 测试以普通名称运行的程序首次部署时会下线普通名称的配置
+	dir := t.TempDir()
+	client := &fakeDeploySupervisor{dir: dir, running: map[string]bool{}}
+	program := supervisorkratos.NewProgramConfig("api", "/opt/api/v1", "deploy", "/var/log/services")
+	writer := supervisorkratos.NewConfWriter(dir)
+	_, err := writer.ApplyProgram(context.Background(), client, program)
+	require.NoError(t, err)
+	require.Equal(t, []string{"api"}, client.active)
+
+	deploy := supervisorkratos.NewBlueGreenDeploy(writer).WithPollInterval(time.Millisecond)
+	report, err := deploy.Deploy(context.Background(), client, program, "/opt/api/v2")
+	require.NoError(t, err)
+	require.Equal(t, "api", report.From)
+	require.Equal(t, "api-blue", report.To)
+	require.Equal(t, []string{"api-blue"}, client.active)
+	require.Contains(t, client.calls, "stop api")
+	require.NoFileExists(t, filepath.Join(dir, "api.conf"))
+
+	color, err := deploy.Current("api")
+	require.NoError(t, err)
+	require.Equal(t, supervisorkratos.DeployBlue, color)
+}
+
+func TestBlueGreenDeployGroupFile(t *testing.T) {
+	// Test a group file named after the program is not retired, it would stop the other programs of the group
+	// 测试不会下线以程序命名的组文件，否则会停止组内的其他程序
+	dir := t.TempDir()
+	client := &fakeDeploySupervisor{dir: dir, running: map[string]bool{}}
+	group := supervisorkratos.NewGroupConfig("api").
+		AddProgram(supervisorkratos.NewProgramConfig("api", "/opt/api/v1", "deploy", "/var/log/services")).
+		AddProgram(supervisorkratos.NewProgramConfig("worker", "/opt/worker", "deploy", "/var/log/services"))
+	writer := supervisorkratos.NewConfWriter(dir)
+	_, err := writer.Apply(context.Background(), client, group)
+	require.NoError(t, err)
+
+	deploy := supervisorkratos.NewBlueGreenDeploy(writer).WithPollInterval(time.Millisecond)
+	report, err := deploy.Deploy(context.Background(), client, group.Programs[0], "/opt/api/v2")
+	require.ErrorContains(t, err, "api.conf holds more than [program:api]")
+	require.Nil(t, report)
+	require.FileExists(t, filepath.Join(dir, "api.conf"))
+	require.NoFileExists(t, filepath.Join(dir, "api-blue.conf"))
+	require.Equal(t, []string{"api"}, client.active)
+}
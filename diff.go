@@ -0,0 +1,342 @@
+package supervisorkratos
+
+import (
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/yyle88/printgo"
+)
+
+// DiffChange kind of change of a section
+// 段的变更类型
+type DiffChange string
+
+const (
+	DiffAdded     DiffChange = "added"     // Section only in new config // 只存在于新配置的段
+	DiffRemoved   DiffChange = "removed"   // Section only in old config // 只存在于旧配置的段
+	DiffChanged   DiffChange = "changed"   // Section with changed keys // 键有变化的段
+	DiffUnchanged DiffChange = "unchanged" // Section restarted with its process group // 随进程组一起重启的段
+)
+
+// KeyDiff changed key with old and new values, empty when the key is absent
+// 有变化的键及其新旧值，键不存在时为空
+type KeyDiff struct {
+	Key string `json:"key"`
+	Old string `json:"old"`
+	New string `json:"new"`
+}
+
+// SectionDiff change of one INI section
+// Restart is true when "supervisorctl update" stops and starts the running processes of the section
+//
+// 单个 INI 段的变更
+// 当 "supervisorctl update" 会停止并重新启动该段正在运行的进程时 Restart 为 true
+type SectionDiff struct {
+	Section string     `json:"section"`        // Section name, e.g. "program:api" // 段名称，例如 "program:api"
+	Group   string     `json:"group"`          // Process group, empty for sections update does not apply // 进程组，update 不处理的段为空
+	Change  DiffChange `json:"change"`         // Kind of change // 变更类型
+	Keys    []*KeyDiff `json:"keys,omitempty"` // Changed keys, sorted // 有变化的键，已排序
+	Restart bool       `json:"restart"`        // Processes restart on update // update 时进程会重启
+}
+
+// ConfigDiff semantic diff between two configs
+// Supervisor compares whole process groups, any change in a group restarts every process of that group
+//
+// 两份配置之间的语义差异
+// supervisor 按整个进程组比较，组内任何变化都会重启该组的所有进程
+type ConfigDiff struct {
+	Sections      []*SectionDiff `json:"sections"`       // Changed and restarted sections // 有变化和会重启的段
+	AddedGroups   []string       `json:"added_groups"`   // Process groups update adds // update 新增的进程组
+	RemovedGroups []string       `json:"removed_groups"` // Process groups update removes // update 删除的进程组
+	RestartGroups []string       `json:"restart_groups"` // Process groups update restarts // update 重启的进程组
+}
+
+// HasChanges check whether any section differs
+// 检查是否有段存在差异
+func (d *ConfigDiff) HasChanges() bool {
+	return len(d.Sections) > 0
+}
+
+// String render diff as human readable text
+// 将差异渲染为可读文本
+func (d *ConfigDiff) String() string {
+	ptx := printgo.NewPTX()
+	marks := map[DiffChange]string{DiffAdded: "+", DiffRemoved: "-", DiffChanged: "~", DiffUnchanged: " "}
+	for _, section := range d.Sections {
+		var notes []string
+		if section.Group != "" {
+			notes = append(notes, "group "+section.Group)
+		} else {
+			notes = append(notes, "not applied by update")
+		}
+		if section.Restart {
+			notes = append(notes, "restart")
+		}
+		ptx.Println(marks[section.Change] + " [" + section.Section + "] (" + strings.Join(notes, ", ") + ")")
+		for _, key := range section.Keys {
+			ptx.Println(fmt.Sprintf("    %s: %q -> %q", key.Key, key.Old, key.New))
+		}
+	}
+	for _, item := range []struct {
+		title  string
+		groups []string
+	}{
+		{"added groups", d.AddedGroups},
+		{"removed groups", d.RemovedGroups},
+		{"restart groups", d.RestartGroups},
+	} {
+		if len(item.groups) > 0 {
+			ptx.Println(item.title + ": " + strings.Join(item.groups, ", "))
+		}
+	}
+	return ptx.String()
+}
+
+// DiffGroups compare two sets of groups, nil or empty old means a fresh install
+// Returns *ValidationError when any config is invalid
+//
+// 比较两组 GroupConfig，旧配置为 nil 或空表示全新安装
+// 任何配置无效时返回 *ValidationError
+func DiffGroups(oldGroups []*GroupConfig, newGroups []*GroupConfig) (*ConfigDiff, error) {
+	oldContent, err := renderGroups(oldGroups)
+	if err != nil {
+		return nil, err
+	}
+	newContent, err := renderGroups(newGroups)
+	if err != nil {
+		return nil, err
+	}
+	return DiffConfig(oldContent, newContent)
+}
+
+// DiffConfig compare two supervisor INI texts, e.g. the deployed file and a newly generated one
+// Absent keys are compared as supervisor defaults, so "autostart = true" equals no autostart key
+//
+// 比较两份 supervisor INI 文本，例如已部署的文件和新生成的文件
+// 缺失的键按 supervisor 默认值比较，因此 "autostart = true" 与没有 autostart 键相同
+func DiffConfig(oldContent string, newContent string) (*ConfigDiff, error) {
+	oldSections, err := ParseIni(oldContent)
+	if err != nil {
+		return nil, err
+	}
+	newSections, err := ParseIni(newContent)
+	if err != nil {
+		return nil, err
+	}
+	oldGroups := processGroupNames(oldSections)
+	newGroups := processGroupNames(newSections)
+
+	oldByName := make(map[string]*IniSection, len(oldSections))
+	for _, section := range oldSections {
+		oldByName[section.Name] = section
+	}
+	newByName := make(map[string]*IniSection, len(newSections))
+	for _, section := range newSections {
+		newByName[section.Name] = section
+	}
+
+	res := &ConfigDiff{}
+	changedGroups := make(map[string]bool)
+	var sections []*SectionDiff
+	for _, section := range newSections {
+		oldSection, ok := oldByName[section.Name]
+		if !ok {
+			sections = append(sections, &SectionDiff{Section: section.Name, Group: newGroups[section.Name], Change: DiffAdded})
+			continue
+		}
+		keys := diffSectionKeys(oldSection, section)
+		group := newGroups[section.Name]
+		if oldGroups[section.Name] != group {
+			// Moving between groups changes both groups
+			// 在组之间移动会改变两个组
+			changedGroups[oldGroups[section.Name]] = true
+			keys = append([]*KeyDiff{{Key: "(group)", Old: oldGroups[section.Name], New: group}}, keys...)
+		}
+		if len(keys) > 0 {
+			sections = append(sections, &SectionDiff{Section: section.Name, Group: group, Change: DiffChanged, Keys: keys})
+			changedGroups[group] = true
+		}
+	}
+	for _, section := range oldSections {
+		if _, ok := newByName[section.Name]; !ok {
+			sections = append(sections, &SectionDiff{Section: section.Name, Group: oldGroups[section.Name], Change: DiffRemoved})
+			changedGroups[oldGroups[section.Name]] = true
+		}
+	}
+
+	// Groups in both configs with any change are removed and added back by update
+	// 两份配置中都存在且有变化的组会被 update 删除后重新添加
+	oldGroupSet := valueSet(oldGroups)
+	newGroupSet := valueSet(newGroups)
+	for _, group := range sortedKeys(newGroupSet) {
+		if !oldGroupSet[group] {
+			res.AddedGroups = append(res.AddedGroups, group)
+		} else if changedGroups[group] {
+			res.RestartGroups = append(res.RestartGroups, group)
+		}
+	}
+	for _, group := range sortedKeys(oldGroupSet) {
+		if !newGroupSet[group] {
+			res.RemovedGroups = append(res.RemovedGroups, group)
+		}
+	}
+	for _, section := range sections {
+		section.Restart = isProcessSection(section.Section) && section.Change == DiffChanged
+	}
+
+	// Unchanged members of restarted groups restart too
+	// 被重启组中未变化的成员也会重启
+	for _, section := range newSections {
+		if !isProcessSection(section.Name) || !slices.Contains(res.RestartGroups, newGroups[section.Name]) {
+			continue
+		}
+		if !slices.ContainsFunc(sections, func(s *SectionDiff) bool { return s.Section == section.Name }) {
+			sections = append(sections, &SectionDiff{Section: section.Name, Group: newGroups[section.Name], Change: DiffUnchanged, Restart: true})
+		}
+	}
+	res.Sections = sections
+	return res, nil
+}
+
+// renderGroups validate and render groups into one INI text
+// 校验并将多个组渲染为一份 INI 文本
+func renderGroups(groups []*GroupConfig) (string, error) {
+	v := &validator{}
+	for _, group := range groups {
+		if group == nil {
+			v.add("group", "GroupConfig", nil, ErrRequired, "nil config")
+			continue
+		}
+		group.validateFields(v)
+	}
+	if err := v.result(); err != nil {
+		return "", err
+	}
+	contents := make([]string, 0, len(groups))
+	for _, group := range groups {
+		contents = append(contents, renderGroupConfig(group))
+	}
+	return strings.Join(contents, "\n"), nil
+}
+
+// processGroupNames map each section name to its supervisor process group
+// Programs listed in [group:x] belong to x, other process sections are groups of their own
+//
+// 将每个段名映射到其 supervisor 进程组
+// [group:x] 中列出的程序属于 x，其他进程段各自是独立的进程组
+func processGroupNames(sections []*IniSection) map[string]string {
+	res := make(map[string]string, len(sections))
+	for _, section := range sections {
+		if section.Kind() != "group" {
+			continue
+		}
+		res[section.Name] = section.Title()
+		value, _ := section.Get("programs")
+		for _, name := range splitList(value) {
+			if _, ok := res["program:"+name]; !ok {
+				res["program:"+name] = section.Title()
+			}
+		}
+	}
+	for _, section := range sections {
+		if _, ok := res[section.Name]; !ok && isProcessSection(section.Name) {
+			res[section.Name] = section.Title()
+		}
+	}
+	return res
+}
+
+func isProcessSection(name string) bool {
+	kind, _, _ := strings.Cut(name, ":")
+	return kind == "program" || kind == "eventlistener" || kind == "fcgi-program"
+}
+
+func diffSectionKeys(oldSection *IniSection, newSection *IniSection) []*KeyDiff {
+	keys := make(map[string]bool, len(oldSection.Keys)+len(newSection.Keys))
+	for _, key := range oldSection.Keys {
+		keys[key] = true
+	}
+	for _, key := range newSection.Keys {
+		keys[key] = true
+	}
+	var res []*KeyDiff
+	for _, key := range sortedKeys(keys) {
+		oldValue, oldOK := oldSection.Get(key)
+		newValue, newOK := newSection.Get(key)
+		if oldOK && newOK && oldValue == newValue {
+			continue
+		}
+		if isProcessSection(newSection.Name) && normalizeIniValue(key, oldValue, oldOK) == normalizeIniValue(key, newValue, newOK) {
+			continue
+		}
+		res = append(res, &KeyDiff{Key: key, Old: oldValue, New: newValue})
+	}
+	return res
+}
+
+// iniDefaults supervisor default values of process section keys
+// supervisor 进程段各键的默认值
+var iniDefaults = map[string]string{
+	"autostart":               "true",
+	"autorestart":             "unexpected",
+	"startretries":            "3",
+	"startsecs":               "1",
+	"stdout_logfile_maxbytes": "50MB",
+	"stderr_logfile_maxbytes": "50MB",
+	"stdout_logfile_backups":  "10",
+	"stderr_logfile_backups":  "10",
+	"redirect_stderr":         "false",
+	"stopasgroup":             "false",
+	"stopwaitsecs":            "10",
+	"killasgroup":             "false",
+	"stopsignal":              "TERM",
+	"priority":                "999",
+	"exitcodes":               "0",
+	"numprocs":                "1",
+	"process_name":            "%(program_name)s",
+	"buffer_size":             "10",
+	"result_handler":          "supervisor.dispatchers:default_handler",
+}
+
+// normalizeIniValue fill absent key with its default and normalize spellings supervisor treats as equal
+// 用默认值填充缺失的键，并规范化 supervisor 视为相同的写法
+func normalizeIniValue(key string, value string, ok bool) string {
+	if !ok {
+		defaultValue, has := iniDefaults[key]
+		if !has {
+			return "\x00absent"
+		}
+		value = defaultValue
+	}
+	switch key {
+	case "autostart", "redirect_stderr", "stopasgroup", "killasgroup":
+		if res, err := parseBool(value); err == nil {
+			return strconv.FormatBool(res)
+		}
+	case "autorestart":
+		if res, err := parseAutoRestart(value); err == nil {
+			return fmt.Sprint(res)
+		}
+	case "stdout_logfile_maxbytes", "stderr_logfile_maxbytes":
+		if res, err := ParseByteSize(value); err == nil {
+			return strconv.FormatInt(res, 10)
+		}
+	case "stopsignal":
+		return signalName(value)
+	case "exitcodes":
+		if res, err := parseInts(value); err == nil {
+			return combineInts(res, ",")
+		}
+	}
+	return value
+}
+
+func valueSet(items map[string]string) map[string]bool {
+	res := make(map[string]bool, len(items))
+	for _, value := range items {
+		res[value] = true
+	}
+	return res
+}
@@ -0,0 +1,101 @@
+package supervisorkratos_test
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/orzkratos/supervisorkratos"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDiffGroups(t *testing.T) {
+	// Test a changed program restarts its whole group, added and removed groups are reported
+	// 测试程序变化会重启整个组，并报告新增和删除的组
+	newProgram := func(name string) *supervisorkratos.ProgramConfig {
+		return supervisorkratos.NewProgramConfig(name, "/opt/"+name, "deploy", "/var/log/services")
+	}
+	oldGroups := []*supervisorkratos.GroupConfig{
+		supervisorkratos.NewGroupConfig("services").AddProgram(newProgram("api")).AddProgram(newProgram("web")),
+		supervisorkratos.NewGroupConfig("legacy").AddProgram(newProgram("cron")),
+	}
+	newGroups := []*supervisorkratos.GroupConfig{
+		supervisorkratos.NewGroupConfig("services").AddProgram(newProgram("api").WithStartSecs(5)).AddProgram(newProgram("web")),
+		supervisorkratos.NewGroupConfig("jobs").AddProgram(newProgram("worker")),
+	}
+
+	diff, err := supervisorkratos.DiffGroups(oldGroups, newGroups)
+	require.NoError(t, err)
+	t.Log(diff.String())
+
+	require.True(t, diff.HasChanges())
+	require.Equal(t, []string{"jobs"}, diff.AddedGroups)
+	require.Equal(t, []string{"legacy"}, diff.RemovedGroups)
+	require.Equal(t, []string{"services"}, diff.RestartGroups)
+
+	const expected = `~ [program:api] (group services, restart)
+    startsecs: "" -> "5"
++ [group:jobs] (group jobs)
++ [program:worker] (group jobs)
+- [group:legacy] (group legacy)
+- [program:cron] (group legacy)
+  [program:web] (group services, restart)
+added groups: jobs
+removed groups: legacy
+restart groups: services
+`
+	require.Equal(t, expected, diff.String())
+
+	data, err := json.Marshal(diff)
+	require.NoError(t, err)
+	t.Log(string(data))
+	require.Contains(t, string(data), `{"section":"program:api","group":"services","change":"changed","keys":[{"key":"startsecs","old":"","new":"5"}],"restart":true}`)
+
+	// Same groups have no changes
+	// 相同的组没有变化
+	diff, err = supervisorkratos.DiffGroups(newGroups, newGroups)
+	require.NoError(t, err)
+	require.False(t, diff.HasChanges())
+	require.Empty(t, diff.String())
+
+	// Invalid configs are rejected
+	// 无效配置会被拒绝
+	_, err = supervisorkratos.DiffGroups(nil, []*supervisorkratos.GroupConfig{supervisorkratos.NewGroupConfig("empty")})
+	require.ErrorIs(t, err, supervisorkratos.ErrRequired)
+}
+
+func TestDiffConfig(t *testing.T) {
+	// Test parsed INI diff compares absent keys as supervisor defaults
+	// 测试解析的 INI 差异把缺失的键按 supervisor 默认值比较
+	const oldContent = `[program:api]
+command = /opt/api/bin/api
+autostart = yes
+stopsignal = SIGTERM
+stdout_logfile_maxbytes = 51200KB
+
+[program:web]
+command = /opt/web/bin/web
+
+[supervisord]
+logfile = /var/log/supervisord.log
+`
+	const newContent = `[program:api]
+command = /opt/api/bin/api
+
+[program:web]
+command = /opt/web/bin/web -port 8080
+
+[supervisord]
+logfile = /var/log/supervisor/supervisord.log
+`
+	diff, err := supervisorkratos.DiffConfig(oldContent, newContent)
+	require.NoError(t, err)
+	t.Log(diff.String())
+
+	require.Len(t, diff.Sections, 2)
+	require.Equal(t, "program:web", diff.Sections[0].Section)
+	require.True(t, diff.Sections[0].Restart)
+	require.Equal(t, "supervisord", diff.Sections[1].Section)
+	require.Empty(t, diff.Sections[1].Group)
+	require.False(t, diff.Sections[1].Restart)
+	require.Equal(t, []string{"web"}, diff.RestartGroups)
+}
@@ -0,0 +1,198 @@
+package supervisorkratos
+
+import (
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/yyle88/must"
+)
+
+// EventType supervisor event type name
+// supervisor 事件类型名称
+type EventType string
+
+// Supervisor event types, a listener subscribed to a parent type receives every subtype
+// supervisor 事件类型，订阅父类型的监听器会收到所有子类型
+const (
+	EventAll                           EventType = "EVENT"
+	EventProcessState                  EventType = "PROCESS_STATE"
+	EventProcessStateStarting          EventType = "PROCESS_STATE_STARTING"
+	EventProcessStateRunning           EventType = "PROCESS_STATE_RUNNING"
+	EventProcessStateBackoff           EventType = "PROCESS_STATE_BACKOFF"
+	EventProcessStateStopping          EventType = "PROCESS_STATE_STOPPING"
+	EventProcessStateExited            EventType = "PROCESS_STATE_EXITED"
+	EventProcessStateStopped           EventType = "PROCESS_STATE_STOPPED"
+	EventProcessStateFatal             EventType = "PROCESS_STATE_FATAL"
+	EventProcessStateUnknown           EventType = "PROCESS_STATE_UNKNOWN"
+	EventRemoteCommunication           EventType = "REMOTE_COMMUNICATION"
+	EventProcessLog                    EventType = "PROCESS_LOG"
+	EventProcessLogStdout              EventType = "PROCESS_LOG_STDOUT"
+	EventProcessLogStderr              EventType = "PROCESS_LOG_STDERR"
+	EventProcessCommunication          EventType = "PROCESS_COMMUNICATION"
+	EventProcessCommunicationStdout    EventType = "PROCESS_COMMUNICATION_STDOUT"
+	EventProcessCommunicationStderr    EventType = "PROCESS_COMMUNICATION_STDERR"
+	EventSupervisorStateChange         EventType = "SUPERVISOR_STATE_CHANGE"
+	EventSupervisorStateChangeRunning  EventType = "SUPERVISOR_STATE_CHANGE_RUNNING"
+	EventSupervisorStateChangeStopping EventType = "SUPERVISOR_STATE_CHANGE_STOPPING"
+	EventTick                          EventType = "TICK"
+	EventTick5                         EventType = "TICK_5"
+	EventTick60                        EventType = "TICK_60"
+	EventTick3600                      EventType = "TICK_3600"
+	EventProcessGroup                  EventType = "PROCESS_GROUP"
+	EventProcessGroupAdded             EventType = "PROCESS_GROUP_ADDED"
+	EventProcessGroupRemoved           EventType = "PROCESS_GROUP_REMOVED"
+)
+
+// EventTypes all event types supervisor accepts in events=
+// supervisor 在 events= 中接受的全部事件类型
+var EventTypes = []EventType{
+	EventAll,
+	EventProcessState,
+	EventProcessStateStarting,
+	EventProcessStateRunning,
+	EventProcessStateBackoff,
+	EventProcessStateStopping,
+	EventProcessStateExited,
+	EventProcessStateStopped,
+	EventProcessStateFatal,
+	EventProcessStateUnknown,
+	EventRemoteCommunication,
+	EventProcessLog,
+	EventProcessLogStdout,
+	EventProcessLogStderr,
+	EventProcessCommunication,
+	EventProcessCommunicationStdout,
+	EventProcessCommunicationStderr,
+	EventSupervisorStateChange,
+	EventSupervisorStateChangeRunning,
+	EventSupervisorStateChangeStopping,
+	EventTick,
+	EventTick5,
+	EventTick60,
+	EventTick3600,
+	EventProcessGroup,
+	EventProcessGroupAdded,
+	EventProcessGroupRemoved,
+}
+
+// IsValid check event type is known to supervisor
+// 检查事件类型是否为 supervisor 已知类型
+func (e EventType) IsValid() bool {
+	return slices.Contains(EventTypes, e)
+}
+
+// EventListenerConfig [eventlistener:x] section configuration
+// Shares the process control fields of ProgramConfig
+//
+// [eventlistener:x] 段配置
+// 共享 ProgramConfig 的进程控制字段
+type EventListenerConfig struct {
+	*ProgramConfig // Process control fields // 进程控制字段
+
+	Events        []EventType  // Subscribed event types // 订阅的事件类型
+	BufferSize    *Opt[int]    // Event queue buffer size // 事件队列缓冲大小
+	ResultHandler *Opt[string] // Result handler import path // 结果处理器导入路径
+}
+
+// NewEventListenerConfig create new EventListenerConfig with required fields and subscribed events
+// 创建新的 EventListenerConfig，需要提供必填字段和订阅的事件
+func NewEventListenerConfig(name string, root string, userName string, slogRoot string, events ...EventType) *EventListenerConfig {
+	return &EventListenerConfig{
+		ProgramConfig: NewProgramConfig(name, root, userName, slogRoot),
+		Events:        must.Have(events),
+		BufferSize:    NewOpt(10),
+		ResultHandler: NewOpt("supervisor.dispatchers:default_handler"),
+	}
+}
+
+// WithEvents set subscribed event types
+// 设置订阅的事件类型
+func (e *EventListenerConfig) WithEvents(events ...EventType) *EventListenerConfig {
+	e.Events = events
+	return e
+}
+
+// WithBufferSize set event queue buffer size
+// 设置事件队列缓冲大小
+func (e *EventListenerConfig) WithBufferSize(bufferSize int) *EventListenerConfig {
+	e.BufferSize.Set(bufferSize)
+	return e
+}
+
+// WithResultHandler set result handler import path, e.g. "supervisor.dispatchers:default_handler"
+// 设置结果处理器导入路径，例如 "supervisor.dispatchers:default_handler"
+func (e *EventListenerConfig) WithResultHandler(resultHandler string) *EventListenerConfig {
+	e.ResultHandler.Set(resultHandler)
+	return e
+}
+
+// Validate check event listener config and return *ValidationError listing every invalid field
+// 校验事件监听器配置，返回列出每个无效字段的 *ValidationError
+func (e *EventListenerConfig) Validate() error {
+	v := &validator{}
+	e.validateFields(v)
+	return v.result()
+}
+
+func (e *EventListenerConfig) validateFields(v *validator) {
+	if e == nil || e.ProgramConfig == nil {
+		v.add("eventlistener", "EventListenerConfig", nil, ErrRequired, "nil config")
+		return
+	}
+	section := "eventlistener:" + e.Name
+	e.ProgramConfig.validateFields(v, section)
+	if e.Ports != nil {
+		v.add(section, "Ports", nil, ErrInvalidValue, "ports are not allocated to event listeners")
+	}
+
+	if len(e.Events) == 0 {
+		v.add(section, "Events", nil, ErrRequired, "no events subscribed")
+	}
+	for _, event := range e.Events {
+		if !event.IsValid() {
+			v.add(section, "Events", event, ErrInvalidValue, "unknown event type %q", event)
+		}
+	}
+	if e.BufferSize == nil || e.ResultHandler == nil {
+		v.add(section, "EventListenerConfig", nil, ErrRequired, "option is nil, create config with NewEventListenerConfig")
+		return
+	}
+	checkMinInt(v, section, "BufferSize", e.BufferSize.Get(), 1)
+	if module, function, ok := strings.Cut(e.ResultHandler.Get(), ":"); !ok || module == "" || function == "" {
+		v.add(section, "ResultHandler", e.ResultHandler.Get(), ErrInvalidValue, "expect \"module:function\"")
+	}
+}
+
+// GenerateEventListenerConfig generate [eventlistener:x] section, panics on invalid config
+// 生成 [eventlistener:x] 段，配置无效时 panic
+func GenerateEventListenerConfig(listener *EventListenerConfig) string {
+	return must.V1(GenerateEventListenerConfigE(listener))
+}
+
+// GenerateEventListenerConfigE generate [eventlistener:x] section
+// Returns *ValidationError listing every invalid field
+//
+// 生成 [eventlistener:x] 段
+// 返回列出所有无效字段的 *ValidationError
+func GenerateEventListenerConfigE(listener *EventListenerConfig) (string, error) {
+	if err := listener.Validate(); err != nil {
+		return "", err
+	}
+	return renderEventListenerConfig(listener), nil
+}
+
+func renderEventListenerConfig(listener *EventListenerConfig) string {
+	events := make([]string, 0, len(listener.Events))
+	for _, event := range listener.Events {
+		events = append(events, string(event))
+	}
+	lines := []string{"events          = " + strings.Join(events, ",")}
+	if listener.BufferSize.IsSet() {
+		lines = append(lines, "buffer_size     = "+strconv.Itoa(listener.BufferSize.Get()))
+	}
+	if listener.ResultHandler.IsSet() {
+		lines = append(lines, "result_handler  = "+listener.ResultHandler.Get())
+	}
+	return renderProcessSection("eventlistener:"+listener.Name, listener.ProgramConfig, lines)
+}
@@ -0,0 +1,129 @@
+package supervisorkratos_test
+
+import (
+	"testing"
+
+	"github.com/orzkratos/supervisorkratos"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEventListenerConfig(t *testing.T) {
+	// Test crash notifier event listener
+	// 测试崩溃通知事件监听器
+	listener := supervisorkratos.NewEventListenerConfig(
+		"crash-notifier",
+		"/opt/crash-notifier",
+		"deploy",
+		"/var/log/services",
+		supervisorkratos.EventProcessStateFatal,
+		supervisorkratos.EventProcessStateExited,
+	).WithBufferSize(50)
+	listener.WithArgs("-webhook", "https://hooks.example.com/notify").
+		WithAutoRestart(true)
+
+	content := supervisorkratos.GenerateEventListenerConfig(listener)
+	t.Log("=== Event listener configuration ===")
+	t.Log(content)
+
+	const expected = `[eventlistener:crash-notifier]
+user            = deploy
+directory       = /opt/crash-notifier
+command         = /opt/crash-notifier/bin/crash-notifier -webhook https://hooks.example.com/notify
+events          = PROCESS_STATE_FATAL,PROCESS_STATE_EXITED
+buffer_size     = 50
+
+autorestart     = true
+
+stdout_logfile  = /var/log/services/crash-notifier.log
+
+stderr_logfile  = /var/log/services/crash-notifier.err
+
+`
+
+	require.Equal(t, expected, content)
+}
+
+func TestGroupWithEventListener(t *testing.T) {
+	// Test event listeners are rendered with the group but not listed in programs=
+	// 测试事件监听器随组渲染但不列入 programs=
+	program := supervisorkratos.NewProgramConfig(
+		"api",
+		"/opt/api",
+		"deploy",
+		"/var/log/services",
+	)
+	listener := supervisorkratos.NewEventListenerConfig(
+		"memmon",
+		"/opt/memmon",
+		"deploy",
+		"/var/log/services",
+		supervisorkratos.EventTick60,
+	).WithResultHandler("supervisor.dispatchers:default_handler")
+
+	group := supervisorkratos.NewGroupConfig("services").
+		AddProgram(program).
+		AddEventListener(listener)
+
+	content := supervisorkratos.GenerateGroupConfig(group)
+	t.Log(content)
+
+	const expected = `[group:services]
+programs=api
+
+
+[program:api]
+user            = deploy
+directory       = /opt/api
+command         = /opt/api/bin/api
+
+stdout_logfile  = /var/log/services/api.log
+
+stderr_logfile  = /var/log/services/api.err
+
+[eventlistener:memmon]
+user            = deploy
+directory       = /opt/memmon
+command         = /opt/memmon/bin/memmon
+events          = TICK_60
+result_handler  = supervisor.dispatchers:default_handler
+
+stdout_logfile  = /var/log/services/memmon.log
+
+stderr_logfile  = /var/log/services/memmon.err
+`
+
+	require.Equal(t, expected, content)
+
+	// Parse back keeps event listeners with the single group
+	// 解析回来时事件监听器仍属于唯一的组
+	res, err := supervisorkratos.ParseConfig(content)
+	require.NoError(t, err)
+	require.Len(t, res.EventListeners, 1)
+	require.Equal(t, []supervisorkratos.EventType{supervisorkratos.EventTick60}, res.EventListeners[0].Events)
+	require.Equal(t, content, supervisorkratos.GenerateGroupConfig(res.Groups[0]))
+}
+
+func TestEventListenerValidate(t *testing.T) {
+	// Test unknown events and bad listener settings are rejected
+	// 测试未知事件和错误的监听器设置会被拒绝
+	listener := supervisorkratos.NewEventListenerConfig(
+		"watcher",
+		"/opt/watcher",
+		"deploy",
+		"/var/log/services",
+		"PROCESS_CRASHED",
+	).WithBufferSize(0).
+		WithResultHandler("default_handler")
+	listener.WithStopSignal("BOOM")
+
+	_, err := supervisorkratos.GenerateEventListenerConfigE(listener)
+	require.ErrorIs(t, err, supervisorkratos.ErrInvalidValue)
+	require.ErrorIs(t, err, supervisorkratos.ErrOutOfRange)
+	t.Log(err)
+
+	group := supervisorkratos.NewGroupConfig("watcher").
+		AddProgram(supervisorkratos.NewProgramConfig("api", "/opt/api", "deploy", "/var/log/services")).
+		AddEventListener(supervisorkratos.NewEventListenerConfig("watcher", "/opt/watcher", "deploy", "/var/log/services", supervisorkratos.EventTick5))
+	_, err = supervisorkratos.GenerateGroupConfigE(group)
+	require.ErrorIs(t, err, supervisorkratos.ErrDuplicate)
+}
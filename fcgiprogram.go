@@ -0,0 +1,159 @@
+package supervisorkratos
+
+import (
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/yyle88/must"
+)
+
+// FcgiProgramConfig [fcgi-program:x] section configuration
+// Built on the same fields as ProgramConfig, supervisor creates the socket and passes it to each process
+//
+// [fcgi-program:x] 段配置
+// 基于与 ProgramConfig 相同的字段，supervisor 创建 socket 并传递给每个进程
+type FcgiProgramConfig struct {
+	*ProgramConfig // Process control fields // 进程控制字段
+
+	Socket        string       // Socket URL, unix:///path or tcp://host:port // socket 地址，unix:///path 或 tcp://host:port
+	SocketOwner   *Opt[string] // Unix socket owner, "user" or "user:group" // unix socket 属主，"user" 或 "user:group"
+	SocketMode    *Opt[string] // Unix socket file mode in octal // unix socket 文件的八进制权限
+	SocketBacklog *Opt[int]    // Socket listen backlog // socket 监听队列长度
+}
+
+// NewFcgiProgramConfig create new FcgiProgramConfig with required fields and socket URL
+// 创建新的 FcgiProgramConfig，需要提供必填字段和 socket 地址
+func NewFcgiProgramConfig(name string, root string, userName string, slogRoot string, socket string) *FcgiProgramConfig {
+	return &FcgiProgramConfig{
+		ProgramConfig: NewProgramConfig(name, root, userName, slogRoot),
+		Socket:        must.Nice(socket),
+		SocketOwner:   NewOpt(""),
+		SocketMode:    NewOpt("0700"),
+		SocketBacklog: NewOpt(128),
+	}
+}
+
+// WithSocketOwner set unix socket owner, "user" or "user:group"
+// 设置 unix socket 属主，"user" 或 "user:group"
+func (f *FcgiProgramConfig) WithSocketOwner(socketOwner string) *FcgiProgramConfig {
+	f.SocketOwner.Set(socketOwner)
+	return f
+}
+
+// WithSocketMode set unix socket file mode in octal, e.g. "0770"
+// 设置 unix socket 文件的八进制权限，例如 "0770"
+func (f *FcgiProgramConfig) WithSocketMode(socketMode string) *FcgiProgramConfig {
+	f.SocketMode.Set(socketMode)
+	return f
+}
+
+// WithSocketBacklog set socket listen backlog
+// 设置 socket 监听队列长度
+func (f *FcgiProgramConfig) WithSocketBacklog(socketBacklog int) *FcgiProgramConfig {
+	f.SocketBacklog.Set(socketBacklog)
+	return f
+}
+
+// Validate check fcgi program config and return *ValidationError listing every invalid field
+// 校验 fcgi 程序配置，返回列出每个无效字段的 *ValidationError
+func (f *FcgiProgramConfig) Validate() error {
+	v := &validator{}
+	f.validateFields(v)
+	return v.result()
+}
+
+func (f *FcgiProgramConfig) validateFields(v *validator) {
+	if f == nil || f.ProgramConfig == nil {
+		v.add("fcgi-program", "FcgiProgramConfig", nil, ErrRequired, "nil config")
+		return
+	}
+	section := "fcgi-program:" + f.Name
+	f.ProgramConfig.validateFields(v, section)
+	if f.Ports != nil {
+		v.add(section, "Ports", nil, ErrInvalidValue, "ports are not allocated to fcgi programs")
+	}
+
+	if f.SocketOwner == nil || f.SocketMode == nil || f.SocketBacklog == nil {
+		v.add(section, "FcgiProgramConfig", nil, ErrRequired, "option is nil, create config with NewFcgiProgramConfig")
+		return
+	}
+	scheme, err := parseFcgiSocket(f.Socket)
+	if err != nil {
+		v.add(section, "Socket", f.Socket, ErrInvalidValue, "expect unix:///path or tcp://host:port: %v", err)
+	}
+	if scheme == "tcp" {
+		// Owner and mode only apply to unix sockets
+		// 属主和权限只适用于 unix socket
+		if f.SocketOwner.IsSet() {
+			v.add(section, "SocketOwner", f.SocketOwner.Get(), ErrInvalidValue, "socket_owner only applies to unix:// sockets")
+		}
+		if f.SocketMode.IsSet() {
+			v.add(section, "SocketMode", f.SocketMode.Get(), ErrInvalidValue, "socket_mode only applies to unix:// sockets")
+		}
+	}
+	if f.SocketOwner.IsSet() {
+		userName, groupName, hasGroup := strings.Cut(f.SocketOwner.Get(), ":")
+		if userName == "" || (hasGroup && groupName == "") || strings.ContainsAny(f.SocketOwner.Get(), " \t\n") {
+			v.add(section, "SocketOwner", f.SocketOwner.Get(), ErrInvalidValue, "expect \"user\" or \"user:group\"")
+		}
+	}
+	if mode, err := strconv.ParseUint(f.SocketMode.Get(), 8, 32); err != nil || mode > 0o7777 {
+		v.add(section, "SocketMode", f.SocketMode.Get(), ErrInvalidValue, "expect octal mode like \"0700\"")
+	}
+	checkMinInt(v, section, "SocketBacklog", f.SocketBacklog.Get(), 1)
+}
+
+// parseFcgiSocket parse fcgi socket URL and return its scheme, "unix" or "tcp"
+// Unix socket path may use expansions like %(program_name)s
+//
+// 解析 fcgi socket 地址并返回其协议，"unix" 或 "tcp"
+// unix socket 路径可以使用 %(program_name)s 这类展开表达式
+func parseFcgiSocket(socket string) (string, error) {
+	if path, ok := strings.CutPrefix(socket, "unix://"); ok {
+		if !filepath.IsAbs(path) || strings.ContainsAny(path, " \t\n") {
+			return "unix", errors.Errorf("unix socket path %q is not absolute", path)
+		}
+		return "unix", checkExpansions(path)
+	}
+	if address, ok := strings.CutPrefix(socket, "tcp://"); ok {
+		if _, _, err := splitHostPort(address); err != nil {
+			return "tcp", err
+		}
+		return "tcp", nil
+	}
+	return "", errors.Errorf("unsupported socket %q", socket)
+}
+
+// GenerateFcgiProgramConfig generate [fcgi-program:x] section, panics on invalid config
+// 生成 [fcgi-program:x] 段，配置无效时 panic
+func GenerateFcgiProgramConfig(program *FcgiProgramConfig) string {
+	return must.V1(GenerateFcgiProgramConfigE(program))
+}
+
+// GenerateFcgiProgramConfigE generate [fcgi-program:x] section
+// Returns *ValidationError listing every invalid field
+//
+// 生成 [fcgi-program:x] 段
+// 返回列出所有无效字段的 *ValidationError
+func GenerateFcgiProgramConfigE(program *FcgiProgramConfig) (string, error) {
+	if err := program.Validate(); err != nil {
+		return "", err
+	}
+	return renderFcgiProgramConfig(program), nil
+}
+
+func renderFcgiProgramConfig(program *FcgiProgramConfig) string {
+	lines := []string{"socket          = " + program.Socket}
+	if program.SocketOwner.IsSet() {
+		lines = append(lines, "socket_owner    = "+program.SocketOwner.Get())
+	}
+	if program.SocketMode.IsSet() {
+		lines = append(lines, "socket_mode     = "+program.SocketMode.Get())
+	}
+	if program.SocketBacklog.IsSet() {
+		lines = append(lines, "socket_backlog  = "+strconv.Itoa(program.SocketBacklog.Get()))
+	}
+	return renderProcessSection("fcgi-program:"+program.Name, program.ProgramConfig, lines)
+}
@@ -0,0 +1,110 @@
+package supervisorkratos_test
+
+import (
+	"testing"
+
+	"github.com/orzkratos/supervisorkratos"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFcgiProgramConfig(t *testing.T) {
+	// Test legacy FastCGI service on a unix socket
+	// 测试使用 unix socket 的旧版 FastCGI 服务
+	program := supervisorkratos.NewFcgiProgramConfig(
+		"legacy-php",
+		"/opt/legacy-php",
+		"www-data",
+		"/var/log/services",
+		"unix:///var/run/%(program_name)s.sock",
+	).WithSocketOwner("www-data:nginx").
+		WithSocketMode("0770").
+		WithSocketBacklog(256)
+	program.WithNumProcs(4).
+		WithProcessName("%(program_name)s_%(process_num)02d")
+
+	content := supervisorkratos.GenerateFcgiProgramConfig(program)
+	t.Log("=== FastCGI program configuration ===")
+	t.Log(content)
+
+	const expected = `[fcgi-program:legacy-php]
+user            = www-data
+directory       = /opt/legacy-php
+command         = /opt/legacy-php/bin/legacy-php
+socket          = unix:///var/run/%(program_name)s.sock
+socket_owner    = www-data:nginx
+socket_mode     = 0770
+socket_backlog  = 256
+
+stdout_logfile  = /var/log/services/legacy-php.log
+
+stderr_logfile  = /var/log/services/legacy-php.err
+
+numprocs        = 4
+process_name    = %(program_name)s_%(process_num)02d
+`
+
+	require.Equal(t, expected, content)
+}
+
+func TestGroupWithFcgiProgram(t *testing.T) {
+	// Test fcgi programs are rendered with the group but not listed in programs=, and parse back
+	// 测试 fcgi 程序随组渲染但不列入 programs=，并能解析回来
+	group := supervisorkratos.NewGroupConfig("services").
+		AddProgram(supervisorkratos.NewProgramConfig("api", "/opt/api", "deploy", "/var/log/services")).
+		AddFcgiProgram(supervisorkratos.NewFcgiProgramConfig("legacy", "/opt/legacy", "deploy", "/var/log/services", "tcp://127.0.0.1:9000"))
+
+	content := supervisorkratos.GenerateGroupConfig(group)
+	t.Log(content)
+	require.Contains(t, content, "programs=api\n")
+	require.Contains(t, content, "[fcgi-program:legacy]\n")
+	require.Contains(t, content, "socket          = tcp://127.0.0.1:9000\n")
+
+	res, err := supervisorkratos.ParseConfig(content)
+	require.NoError(t, err)
+	require.Len(t, res.FcgiPrograms, 1)
+	require.Equal(t, "tcp://127.0.0.1:9000", res.FcgiPrograms[0].Socket)
+	require.Equal(t, content, supervisorkratos.GenerateGroupConfig(res.Groups[0]))
+}
+
+func TestFcgiProgramValidate(t *testing.T) {
+	// Test socket URL validation, unix:// vs tcp://
+	// 测试 socket 地址校验，unix:// 与 tcp://
+	newProgram := func(socket string) *supervisorkratos.FcgiProgramConfig {
+		return supervisorkratos.NewFcgiProgramConfig("legacy", "/opt/legacy", "deploy", "/var/log/services", socket)
+	}
+
+	require.NoError(t, newProgram("unix:///tmp/legacy.sock").Validate())
+	require.NoError(t, newProgram("tcp://localhost:9000").Validate())
+	require.NoError(t, newProgram("tcp://:9000").Validate())
+
+	for _, socket := range []string{
+		"unix://tmp/legacy.sock",
+		"unix:///tmp/%(unknown)s.sock",
+		"tcp://localhost",
+		"tcp://localhost:99999",
+		"http://localhost:9000",
+		"/tmp/legacy.sock",
+	} {
+		err := newProgram(socket).Validate()
+		require.ErrorIs(t, err, supervisorkratos.ErrInvalidValue, socket)
+	}
+
+	// Owner and mode only apply to unix sockets
+	// 属主和权限只适用于 unix socket
+	err := newProgram("tcp://127.0.0.1:9000").WithSocketOwner("deploy").WithSocketMode("0770").Validate()
+	var verr *supervisorkratos.ValidationError
+	require.ErrorAs(t, err, &verr)
+	require.Len(t, verr.Section("fcgi-program:legacy"), 2)
+
+	err = newProgram("unix:///tmp/legacy.sock").WithSocketMode("0999").WithSocketBacklog(0).Validate()
+	require.ErrorIs(t, err, supervisorkratos.ErrInvalidValue)
+	require.ErrorIs(t, err, supervisorkratos.ErrOutOfRange)
+
+	// Fcgi program name clashes with a program of the group
+	// fcgi 程序名称与组内程序冲突
+	group := supervisorkratos.NewGroupConfig("services").
+		AddProgram(supervisorkratos.NewProgramConfig("legacy", "/opt/legacy", "deploy", "/var/log/services")).
+		AddFcgiProgram(newProgram("tcp://127.0.0.1:9000"))
+	_, err = supervisorkratos.GenerateGroupConfigE(group)
+	require.ErrorIs(t, err, supervisorkratos.ErrDuplicate)
+}
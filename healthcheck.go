@@ -0,0 +1,370 @@
+package supervisorkratos
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"os/exec"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/yyle88/must"
+)
+
+// HealthCheckKind how a health check probes an instance
+// 健康检查探测实例的方式
+type HealthCheckKind string
+
+const (
+	HealthCheckHTTP HealthCheckKind = "http" // HTTP GET, 2xx is healthy // HTTP GET，2xx 表示健康
+	HealthCheckGRPC HealthCheckKind = "grpc" // grpc.health.v1.Health/Check, SERVING is healthy // SERVING 表示健康
+	HealthCheckTCP  HealthCheckKind = "tcp"  // TCP connect // TCP 连接
+	HealthCheckExec HealthCheckKind = "exec" // Command exits 0 // 命令退出码为 0
+)
+
+// HealthCheck readiness probe of a program's instances, supervisor itself only knows the process is alive
+// Address may use expansions like %(process_num)d, so each NumProcs instance gets its own address, e.g. "127.0.0.1:80%(process_num)02d"
+// When the program has Ports the allocated port of each instance is used instead
+//
+// 程序实例的就绪探测，supervisor 本身只知道进程是否存活
+// Address 可以使用 %(process_num)d 这类展开表达式，使每个 NumProcs 实例有自己的地址，例如 "127.0.0.1:80%(process_num)02d"
+// 程序设置了 Ports 时改用每个实例分配到的端口
+type HealthCheck struct {
+	Kind      HealthCheckKind // Probe kind // 探测方式
+	Address   string          // host:port of http, grpc and tcp checks // http、grpc 和 tcp 检查的 host:port
+	Path      string          // HTTP GET path // HTTP GET 路径
+	Service   string          // gRPC health service name, empty for the whole server // gRPC 健康服务名称，空表示整个服务
+	Command   []string        // Exec command // 执行的命令
+	Interval  time.Duration   // Interval between checks // 两次检查的间隔
+	Timeout   time.Duration   // Timeout of one check // 单次检查的超时时间
+	Threshold int             // Consecutive failures before unhealthy // 连续失败多少次判定为不健康
+}
+
+// NewHTTPHealthCheck create HTTP GET health check, e.g. ("127.0.0.1:8000", "/healthz")
+// 创建 HTTP GET 健康检查，例如 ("127.0.0.1:8000", "/healthz")
+func NewHTTPHealthCheck(address string, path string) *HealthCheck {
+	return newHealthCheck(HealthCheckHTTP, must.Nice(address)).withPath(must.Nice(path))
+}
+
+// NewGRPCHealthCheck create gRPC health check, empty service checks the whole server
+// 创建 gRPC 健康检查，service 为空时检查整个服务
+func NewGRPCHealthCheck(address string, service string) *HealthCheck {
+	res := newHealthCheck(HealthCheckGRPC, must.Nice(address))
+	res.Service = service
+	return res
+}
+
+// NewTCPHealthCheck create TCP connect health check
+// 创建 TCP 连接健康检查
+func NewTCPHealthCheck(address string) *HealthCheck {
+	return newHealthCheck(HealthCheckTCP, must.Nice(address))
+}
+
+// NewExecHealthCheck create exec health check, the command gets HEALTH_PROCESS and HEALTH_ADDRESS environment variables
+// 创建命令健康检查，命令可以读取 HEALTH_PROCESS 和 HEALTH_ADDRESS 环境变量
+func NewExecHealthCheck(command ...string) *HealthCheck {
+	res := newHealthCheck(HealthCheckExec, "")
+	res.Command = must.Have(command)
+	return res
+}
+
+func newHealthCheck(kind HealthCheckKind, address string) *HealthCheck {
+	return &HealthCheck{
+		Kind:      kind,
+		Address:   address,
+		Interval:  10 * time.Second,
+		Timeout:   5 * time.Second,
+		Threshold: 3,
+	}
+}
+
+func (h *HealthCheck) withPath(path string) *HealthCheck {
+	h.Path = path
+	return h
+}
+
+// WithAddress set instance address, e.g. "127.0.0.1:80%(process_num)02d"
+// 设置实例地址，例如 "127.0.0.1:80%(process_num)02d"
+func (h *HealthCheck) WithAddress(address string) *HealthCheck {
+	h.Address = address
+	return h
+}
+
+// WithInterval set interval between checks
+// 设置两次检查的间隔
+func (h *HealthCheck) WithInterval(interval time.Duration) *HealthCheck {
+	h.Interval = interval
+	return h
+}
+
+// WithTimeout set timeout of one check
+// 设置单次检查的超时时间
+func (h *HealthCheck) WithTimeout(timeout time.Duration) *HealthCheck {
+	h.Timeout = timeout
+	return h
+}
+
+// WithThreshold set consecutive failures before unhealthy
+// 设置连续失败多少次判定为不健康
+func (h *HealthCheck) WithThreshold(threshold int) *HealthCheck {
+	h.Threshold = threshold
+	return h
+}
+
+// validateFields check the health check, hasPorts means the address comes from the program port allocation
+// 校验健康检查，hasPorts 表示地址来自程序的端口分配
+func (h *HealthCheck) validateFields(v *validator, section string, hasPorts bool) {
+	switch h.Kind {
+	case HealthCheckHTTP, HealthCheckGRPC, HealthCheckTCP:
+		if hasPorts {
+			break
+		}
+		if err := checkExpansions(h.Address); err != nil {
+			v.add(section, "HealthCheck.Address", h.Address, ErrInvalidValue, "%s", err.Error())
+		} else if _, _, err := net.SplitHostPort(h.Address); err != nil {
+			v.add(section, "HealthCheck.Address", h.Address, ErrInvalidValue, "expect host:port")
+		}
+	case HealthCheckExec:
+		if len(h.Command) == 0 || h.Command[0] == "" {
+			v.add(section, "HealthCheck.Command", h.Command, ErrRequired, "exec health check has no command")
+		}
+	default:
+		v.add(section, "HealthCheck.Kind", h.Kind, ErrInvalidValue, "expect http, grpc, tcp or exec")
+	}
+	if h.Kind == HealthCheckHTTP && !strings.HasPrefix(h.Path, "/") {
+		v.add(section, "HealthCheck.Path", h.Path, ErrInvalidValue, "path must start with \"/\"")
+	}
+	if h.Interval <= 0 {
+		v.add(section, "HealthCheck.Interval", h.Interval, ErrOutOfRange, "interval must be positive")
+	}
+	if h.Timeout <= 0 || (h.Interval > 0 && h.Timeout > h.Interval) {
+		v.add(section, "HealthCheck.Timeout", h.Timeout, ErrOutOfRange, "timeout must be positive and not longer than interval")
+	}
+	checkMinInt(v, section, "HealthCheck.Threshold", h.Threshold, 1)
+}
+
+// HealthResult result of a program instance health check
+// 程序实例健康检查的结果
+type HealthResult struct {
+	Process  string // Process name "group:name" // 进程名称 "group:name"
+	Address  string // Expanded instance address // 展开后的实例地址
+	Attempts int    // Attempts made // 尝试次数
+	Err      error  // Nil when healthy // 健康时为 nil
+}
+
+// CheckHealth run the health check against every instance of the program locally
+// Each instance is healthy on its first passing attempt, up to Threshold attempts spaced by Interval
+//
+// 在本地对程序的每个实例执行健康检查
+// 每个实例第一次通过即为健康，最多尝试 Threshold 次，间隔 Interval
+func (p *ProgramConfig) CheckHealth(ctx context.Context, groupName string) ([]*HealthResult, error) {
+	if err := p.Validate(); err != nil {
+		return nil, err
+	}
+	if p.HealthCheck == nil {
+		return nil, errors.Errorf("program %s has no health check", p.Name)
+	}
+	names := p.ProcessNames(groupName)
+	results := make([]*HealthResult, 0, len(names))
+	for num, name := range names {
+		result := &HealthResult{Process: name, Address: p.healthAddress(groupName, num)}
+		result.Attempts, result.Err = p.HealthCheck.probe(ctx, name, result.Address)
+		results = append(results, result)
+	}
+	return results, nil
+}
+
+// HealthCheckFunc adapt the program health check to RollingRestart and BlueGreenDeploy gates, both use it when no gate is set
+// 将程序的健康检查适配为 RollingRestart 和 BlueGreenDeploy 的检查关卡，两者未设置关卡时都会使用它
+func (p *ProgramConfig) HealthCheckFunc(groupName string) HealthCheckFunc {
+	names := p.ProcessNames(groupName)
+	return func(ctx context.Context, name string) error {
+		if p.HealthCheck == nil {
+			return errors.Errorf("program %s has no health check", p.Name)
+		}
+		num := slices.Index(names, name)
+		if num < 0 {
+			return errors.Errorf("process %s is not an instance of program %s", name, p.Name)
+		}
+		_, err := p.HealthCheck.probe(ctx, name, p.healthAddress(groupName, num))
+		return err
+	}
+}
+
+// healthAddress expand health check address of instance num
+// Checks run at deploy time next to supervisord, so the local host name is the target's
+//
+// 展开第 num 个实例的健康检查地址
+// 检查在部署时于 supervisord 所在机器上运行，因此本机名称就是目标机器的名称
+func (p *ProgramConfig) healthAddress(groupName string, num int) string {
+	hostName, _ := os.Hostname()
+	return p.expandHealthAddress(groupName, num, hostName)
+}
+
+// expandHealthAddress expand health check address of instance num, %(host_node_name)s is kept when hostName is empty
+// 展开第 num 个实例的健康检查地址，hostName 为空时保留 %(host_node_name)s
+func (p *ProgramConfig) expandHealthAddress(groupName string, num int, hostName string) string {
+	if p.Ports != nil {
+		// Allocated ports win, gRPC checks prefer the gRPC port and the others the HTTP port
+		// 分配的端口优先，gRPC 检查优先使用 gRPC 端口，其他检查优先使用 HTTP 端口
+		port := p.Ports.HTTPPort(num)
+		if (p.HealthCheck.Kind == HealthCheckGRPC && p.Ports.GRPCBase != 0) || port == 0 {
+			port = p.Ports.GRPCPort(num)
+		}
+		return loopbackAddress(net.JoinHostPort(p.Ports.Host, strconv.Itoa(port)))
+	}
+	vars := p.instanceVars(groupName, num)
+	if hostName != "" {
+		vars["host_node_name"] = hostName
+	}
+	return expandExpressions(p.HealthCheck.Address, vars)
+}
+
+// probe check up to Threshold times spaced by Interval, returns attempts made and last error
+// 最多检查 Threshold 次，间隔 Interval，返回尝试次数和最后的错误
+func (h *HealthCheck) probe(ctx context.Context, process string, address string) (int, error) {
+	var err error
+	for attempt := 1; attempt <= h.Threshold; attempt++ {
+		if err = h.Check(ctx, process, address); err == nil {
+			return attempt, nil
+		}
+		if attempt == h.Threshold {
+			break
+		}
+		select {
+		case <-ctx.Done():
+			return attempt, errors.WithMessagef(ctx.Err(), "last error: %v", err)
+		case <-time.After(h.Interval):
+		}
+	}
+	return h.Threshold, err
+}
+
+// Check run one check against address with Timeout, process is passed to exec commands as HEALTH_PROCESS
+// 对 address 执行一次带 Timeout 的检查，process 作为 HEALTH_PROCESS 传给命令
+func (h *HealthCheck) Check(ctx context.Context, process string, address string) error {
+	ctx, cancel := context.WithTimeout(ctx, h.Timeout)
+	defer cancel()
+	switch h.Kind {
+	case HealthCheckHTTP:
+		return checkHTTP(ctx, address, h.Path)
+	case HealthCheckGRPC:
+		return checkGRPC(ctx, address, h.Service)
+	case HealthCheckTCP:
+		var dialer net.Dialer
+		conn, err := dialer.DialContext(ctx, "tcp", address)
+		if err != nil {
+			return err
+		}
+		return conn.Close()
+	case HealthCheckExec:
+		cmd := exec.CommandContext(ctx, h.Command[0], h.Command[1:]...)
+		cmd.Env = append(os.Environ(), "HEALTH_PROCESS="+process, "HEALTH_ADDRESS="+address)
+		if output, err := cmd.CombinedOutput(); err != nil {
+			return errors.WithMessagef(err, "exec %s: %s", h.Command[0], strings.TrimSpace(string(output)))
+		}
+		return nil
+	default:
+		return errors.Errorf("unknown health check kind %q", h.Kind)
+	}
+}
+
+func checkHTTP(ctx context.Context, address string, path string) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, "http://"+address+path, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, resp.Body)
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return errors.Errorf("GET %s: status %s", path, resp.Status)
+	}
+	return nil
+}
+
+// checkGRPC call grpc.health.v1.Health/Check over cleartext HTTP/2
+// The request and response messages are small enough to encode by hand
+//
+// 通过明文 HTTP/2 调用 grpc.health.v1.Health/Check
+// 请求和响应消息足够简单，可以手工编码
+func checkGRPC(ctx context.Context, address string, service string) error {
+	// HealthCheckRequest{service = 1}
+	message := []byte{}
+	if service != "" {
+		message = append([]byte{0x0a}, binary.AppendUvarint(nil, uint64(len(service)))...)
+		message = append(message, service...)
+	}
+	body := append([]byte{0}, binary.BigEndian.AppendUint32(nil, uint32(len(message)))...)
+	body = append(body, message...)
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, "http://"+address+"/grpc.health.v1.Health/Check", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/grpc")
+	req.Header.Set("TE", "trailers")
+
+	protocols := new(http.Protocols)
+	protocols.SetUnencryptedHTTP2(true)
+	transport := &http.Transport{Protocols: protocols}
+	defer transport.CloseIdleConnections()
+	resp, err := (&http.Client{Transport: transport}).Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return errors.Errorf("grpc health: http status %s", resp.Status)
+	}
+	grpcStatus := resp.Trailer.Get("Grpc-Status")
+	if grpcStatus == "" {
+		grpcStatus = resp.Header.Get("Grpc-Status") // Trailers-only response // 只有 trailers 的响应
+	}
+	if grpcStatus != "0" {
+		message := resp.Trailer.Get("Grpc-Message") + resp.Header.Get("Grpc-Message")
+		return errors.Errorf("grpc health: status %s %s", grpcStatus, message)
+	}
+	if len(data) < 5 || int(binary.BigEndian.Uint32(data[1:5])) != len(data)-5 {
+		return errors.Errorf("grpc health: malformed response")
+	}
+	// HealthCheckResponse{status = 1}, SERVING is 1
+	// HealthCheckResponse{status = 1}，SERVING 为 1
+	status := uint64(0)
+	if message := data[5:]; len(message) >= 2 && message[0] == 0x08 {
+		status, _ = binary.Uvarint(message[1:])
+	}
+	if status != 1 {
+		return errors.Errorf("grpc health: status %s", healthStatusName(status))
+	}
+	return nil
+}
+
+func healthStatusName(status uint64) string {
+	switch status {
+	case 0:
+		return "UNKNOWN"
+	case 1:
+		return "SERVING"
+	case 2:
+		return "NOT_SERVING"
+	case 3:
+		return "SERVICE_UNKNOWN"
+	default:
+		return strconv.FormatUint(status, 10)
+	}
+}
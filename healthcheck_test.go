@@ -0,0 +1,143 @@
+package supervisorkratos_test
+
+import (
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/orzkratos/supervisorkratos"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHealthCheckHTTP(t *testing.T) {
+	// Test HTTP check passes on 2xx and fails on other status
+	// 测试 HTTP 检查在 2xx 时通过，其他状态时失败
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/healthz" {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+	defer server.Close()
+	address := strings.TrimPrefix(server.URL, "http://")
+
+	check := supervisorkratos.NewHTTPHealthCheck(address, "/healthz")
+	require.NoError(t, check.Check(context.Background(), "api:api", address))
+
+	check = supervisorkratos.NewHTTPHealthCheck(address, "/broken")
+	require.ErrorContains(t, check.Check(context.Background(), "api:api", address), "503")
+}
+
+// grpcHealthHandler fake grpc.health.v1.Health/Check answering status to every service
+// 模拟 grpc.health.v1.Health/Check，对所有服务返回 status
+func grpcHealthHandler(t *testing.T, status byte) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		require.Equal(t, "/grpc.health.v1.Health/Check", r.URL.Path)
+		require.Equal(t, "application/grpc", r.Header.Get("Content-Type"))
+		body, err := io.ReadAll(r.Body)
+		require.NoError(t, err)
+		require.Equal(t, []byte{0, 0, 0, 0, 5, 0x0a, 3, 'a', 'p', 'i'}, body)
+
+		w.Header().Set("Content-Type", "application/grpc")
+		w.Header().Set("Trailer", "Grpc-Status")
+		_, _ = w.Write([]byte{0, 0, 0, 0, 2, 0x08, status})
+		w.Header().Set("Grpc-Status", "0")
+	}
+}
+
+func TestHealthCheckGRPC(t *testing.T) {
+	// Test gRPC check over cleartext HTTP/2 accepts SERVING only
+	// 测试基于明文 HTTP/2 的 gRPC 检查只接受 SERVING
+	for _, item := range []struct {
+		status byte
+		errMsg string
+	}{
+		{1, ""},
+		{2, "NOT_SERVING"},
+	} {
+		server := httptest.NewUnstartedServer(grpcHealthHandler(t, item.status))
+		server.Config.Protocols = new(http.Protocols)
+		server.Config.Protocols.SetUnencryptedHTTP2(true)
+		server.Start()
+		address := strings.TrimPrefix(server.URL, "http://")
+
+		err := supervisorkratos.NewGRPCHealthCheck(address, "api").Check(context.Background(), "api:api", address)
+		if item.errMsg == "" {
+			require.NoError(t, err)
+		} else {
+			require.ErrorContains(t, err, item.errMsg)
+		}
+		server.Close()
+	}
+}
+
+func TestHealthCheckTCPAndExec(t *testing.T) {
+	// Test TCP check needs a listener and exec check gets the process environment
+	// 测试 TCP 检查需要监听端口，命令检查能获取进程环境变量
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	address := listener.Addr().String()
+
+	check := supervisorkratos.NewTCPHealthCheck(address)
+	require.NoError(t, check.Check(context.Background(), "api:api", address))
+	require.NoError(t, listener.Close())
+	require.Error(t, check.Check(context.Background(), "api:api", address))
+
+	check = supervisorkratos.NewExecHealthCheck("sh", "-c", `test "$HEALTH_PROCESS" = api:api_1 && test "$HEALTH_ADDRESS" = 127.0.0.1:8001`)
+	require.NoError(t, check.Check(context.Background(), "api:api_1", "127.0.0.1:8001"))
+	require.Error(t, check.Check(context.Background(), "api:api_0", "127.0.0.1:8000"))
+}
+
+func TestProgramCheckHealth(t *testing.T) {
+	// Test every instance is checked at its own expanded address
+	// 测试每个实例在各自展开后的地址上进行检查
+	program := supervisorkratos.NewProgramConfig("api", "/opt/api", "deploy", "/var/log/services").
+		WithNumProcs(2).
+		WithProcessName("%(program_name)s_%(process_num)d").
+		WithHealthCheck(supervisorkratos.NewExecHealthCheck("sh", "-c", `test "$HEALTH_ADDRESS" = 127.0.0.1:8000`).
+			WithAddress("127.0.0.1:80%(process_num)02d").
+			WithInterval(time.Second).
+			WithTimeout(time.Second).
+			WithThreshold(2))
+	require.NoError(t, program.Validate())
+
+	results, err := program.CheckHealth(context.Background(), "")
+	require.NoError(t, err)
+	require.Len(t, results, 2)
+	require.Equal(t, "api:api_0", results[0].Process)
+	require.Equal(t, "127.0.0.1:8000", results[0].Address)
+	require.Equal(t, 1, results[0].Attempts)
+	require.NoError(t, results[0].Err)
+	require.Equal(t, "127.0.0.1:8001", results[1].Address)
+	require.Equal(t, 2, results[1].Attempts)
+	require.Error(t, results[1].Err)
+
+	healthCheck := program.HealthCheckFunc("")
+	require.NoError(t, healthCheck(context.Background(), "api:api_0"))
+	require.ErrorContains(t, healthCheck(context.Background(), "api:api_9"), "not an instance")
+
+	// Clone copies the health check
+	// Clone 会复制健康检查
+	clone := program.Clone()
+	clone.HealthCheck.Command[0] = "false"
+	require.Equal(t, "sh", program.HealthCheck.Command[0])
+}
+
+func TestHealthCheckValidate(t *testing.T) {
+	// Test invalid health checks fail program validation
+	// 测试无效的健康检查导致程序校验失败
+	newProgram := func(check *supervisorkratos.HealthCheck) *supervisorkratos.ProgramConfig {
+		return supervisorkratos.NewProgramConfig("api", "/opt/api", "deploy", "/var/log/services").WithHealthCheck(check)
+	}
+	require.NoError(t, newProgram(supervisorkratos.NewGRPCHealthCheck("127.0.0.1:9000", "")).Validate())
+
+	require.ErrorIs(t, newProgram(supervisorkratos.NewTCPHealthCheck("localhost")).Validate(), supervisorkratos.ErrInvalidValue)
+	require.ErrorIs(t, newProgram(supervisorkratos.NewHTTPHealthCheck("127.0.0.1:8000", "healthz")).Validate(), supervisorkratos.ErrInvalidValue)
+	require.ErrorIs(t, newProgram(supervisorkratos.NewTCPHealthCheck("127.0.0.1:8000").WithThreshold(0)).Validate(), supervisorkratos.ErrOutOfRange)
+	require.ErrorIs(t, newProgram(supervisorkratos.NewTCPHealthCheck("127.0.0.1:8000").WithTimeout(time.Minute)).Validate(), supervisorkratos.ErrOutOfRange)
+	require.ErrorIs(t, newProgram(&supervisorkratos.HealthCheck{Kind: supervisorkratos.HealthCheckExec, Interval: time.Second, Timeout: time.Second, Threshold: 1}).Validate(), supervisorkratos.ErrRequired)
+}
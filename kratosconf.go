@@ -0,0 +1,212 @@
+package supervisorkratos
+
+import (
+	"net"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"gopkg.in/yaml.v3"
+)
+
+// KratosConfigPath path of the config file in a Kratos project layout, relative to Root
+// Kratos 项目布局中配置文件的路径，相对于 Root
+const KratosConfigPath = "configs/config.yaml"
+
+// KratosConfig listen addresses and app metadata read from a Kratos configs/config.yaml
+// Kratos configs/config.yaml 中读取的监听地址和应用元数据
+type KratosConfig struct {
+	Path        string            // Config file path // 配置文件路径
+	HTTPAddr    string            // server.http.addr, e.g. "0.0.0.0:8000" // server.http.addr，例如 "0.0.0.0:8000"
+	HTTPTimeout time.Duration     // server.http.timeout // server.http.timeout
+	GRPCAddr    string            // server.grpc.addr, e.g. "0.0.0.0:9000" // server.grpc.addr，例如 "0.0.0.0:9000"
+	GRPCTimeout time.Duration     // server.grpc.timeout // server.grpc.timeout
+	AppName     string            // Optional app.name // 可选的 app.name
+	AppVersion  string            // Optional app.version // 可选的 app.version
+	Metadata    map[string]string // Optional app.metadata // 可选的 app.metadata
+}
+
+// kratosYaml the part of config.yaml the loader reads, other keys are ignored
+// 加载器读取的 config.yaml 部分，其他键会被忽略
+type kratosYaml struct {
+	Server struct {
+		HTTP kratosServerYaml `yaml:"http"`
+		GRPC kratosServerYaml `yaml:"grpc"`
+	} `yaml:"server"`
+	App struct {
+		Name     string            `yaml:"name"`
+		Version  string            `yaml:"version"`
+		Metadata map[string]string `yaml:"metadata"`
+	} `yaml:"app"`
+}
+
+type kratosServerYaml struct {
+	Addr    string `yaml:"addr"`
+	Timeout string `yaml:"timeout"`
+}
+
+// LoadKratosConfig read a Kratos config file, path may also be the project root or the configs DIR
+// ${NAME:default} placeholders resolve to their default value, the way Kratos does without the variable
+//
+// 读取 Kratos 配置文件，path 也可以是项目根目录或 configs 目录
+// ${NAME:default} 占位符解析为默认值，与 Kratos 在变量不存在时的行为一致
+func LoadKratosConfig(path string) (*KratosConfig, error) {
+	if info, err := os.Stat(path); err == nil && info.IsDir() {
+		if _, err := os.Stat(filepath.Join(path, KratosConfigPath)); err == nil {
+			path = filepath.Join(path, KratosConfigPath)
+		} else {
+			path = filepath.Join(path, filepath.Base(KratosConfigPath))
+		}
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, errors.WithMessagef(err, "read kratos config %s", path)
+	}
+	var content kratosYaml
+	if err := yaml.Unmarshal(data, &content); err != nil {
+		return nil, errors.WithMessagef(err, "parse kratos config %s", path)
+	}
+
+	res := &KratosConfig{
+		Path:       path,
+		HTTPAddr:   resolvePlaceholder(content.Server.HTTP.Addr),
+		GRPCAddr:   resolvePlaceholder(content.Server.GRPC.Addr),
+		AppName:    resolvePlaceholder(content.App.Name),
+		AppVersion: resolvePlaceholder(content.App.Version),
+		Metadata:   content.App.Metadata,
+	}
+	for _, item := range []struct {
+		key  string
+		addr string
+	}{
+		{"server.http.addr", res.HTTPAddr},
+		{"server.grpc.addr", res.GRPCAddr},
+	} {
+		if item.addr == "" {
+			continue
+		}
+		if _, _, err := net.SplitHostPort(item.addr); err != nil {
+			return nil, errors.Errorf("kratos config %s: %s %q is not host:port", path, item.key, item.addr)
+		}
+	}
+	if res.HTTPAddr == "" && res.GRPCAddr == "" {
+		return nil, errors.Errorf("kratos config %s has neither server.http.addr nor server.grpc.addr", path)
+	}
+	for _, item := range []struct {
+		key     string
+		value   string
+		timeout *time.Duration
+	}{
+		{"server.http.timeout", content.Server.HTTP.Timeout, &res.HTTPTimeout},
+		{"server.grpc.timeout", content.Server.GRPC.Timeout, &res.GRPCTimeout},
+	} {
+		if value := resolvePlaceholder(item.value); value != "" {
+			timeout, err := time.ParseDuration(value)
+			if err != nil {
+				return nil, errors.Errorf("kratos config %s: %s %q is not a duration", path, item.key, value)
+			}
+			*item.timeout = timeout
+		}
+	}
+	return res, nil
+}
+
+// LoadKratosConfig read <Root>/configs/config.yaml of the program
+// 读取程序的 <Root>/configs/config.yaml
+func (p *ProgramConfig) LoadKratosConfig() (*KratosConfig, error) {
+	return LoadKratosConfig(filepath.Join(p.Root, KratosConfigPath))
+}
+
+// NewKratosProgramConfig create new ProgramConfig from the Kratos project at root, see WithKratosConfig
+// 根据 root 处的 Kratos 项目创建新的 ProgramConfig，见 WithKratosConfig
+func NewKratosProgramConfig(name string, root string, userName string, slogRoot string) (*ProgramConfig, error) {
+	program := NewProgramConfig(name, root, userName, slogRoot)
+	kratos, err := program.LoadKratosConfig()
+	if err != nil {
+		return nil, err
+	}
+	return program.WithKratosConfig(kratos), nil
+}
+
+// WithKratosConfig pre-populate the program from a Kratos config, values set by hand are kept
+//   - Args gets "-conf <configs DIR>" unless a -conf argument is present
+//   - HealthCheck becomes a TCP check of the HTTP (or else gRPC) address on the loopback
+//   - Environment gets KRATOS_HTTP_ADDR, KRATOS_GRPC_ADDR, KRATOS_APP_NAME and KRATOS_APP_VERSION when known
+//
+// 使用 Kratos 配置预填充程序，手动设置的值会被保留
+//   - Args 添加 "-conf <configs 目录>"，已有 -conf 参数时除外
+//   - HealthCheck 设为对 HTTP（否则 gRPC）地址在回环地址上的 TCP 检查
+//   - Environment 在已知时添加 KRATOS_HTTP_ADDR、KRATOS_GRPC_ADDR、KRATOS_APP_NAME 和 KRATOS_APP_VERSION
+func (p *ProgramConfig) WithKratosConfig(kratos *KratosConfig) *ProgramConfig {
+	if !slices.ContainsFunc(p.Args.Get(), isConfFlag) {
+		p.Args.Set(append(slices.Clone(p.Args.Get()), "-conf", filepath.Dir(kratos.Path)))
+	}
+
+	if p.HealthCheck == nil {
+		if address := kratos.HTTPAddr; address != "" {
+			p.HealthCheck = NewTCPHealthCheck(loopbackAddress(address))
+		} else {
+			p.HealthCheck = NewTCPHealthCheck(loopbackAddress(kratos.GRPCAddr))
+		}
+	}
+
+	environment := make(map[string]string, len(p.Environment.Get())+4)
+	for _, item := range []struct {
+		key   string
+		value string
+	}{
+		{"KRATOS_HTTP_ADDR", kratos.HTTPAddr},
+		{"KRATOS_GRPC_ADDR", kratos.GRPCAddr},
+		{"KRATOS_APP_NAME", kratos.AppName},
+		{"KRATOS_APP_VERSION", kratos.AppVersion},
+	} {
+		if item.value != "" {
+			environment[item.key] = item.value
+		}
+	}
+	for key, value := range p.Environment.Get() {
+		environment[key] = value
+	}
+	if len(environment) > 0 {
+		p.Environment.Set(environment)
+	}
+	return p
+}
+
+// isConfFlag check arg is the Kratos -conf flag in any of the forms the flag package accepts
+// 检查参数是否为 flag 包接受的任意形式的 Kratos -conf 参数
+func isConfFlag(arg string) bool {
+	name, _, _ := strings.Cut(strings.TrimLeft(arg, "-"), "=")
+	return strings.HasPrefix(arg, "-") && name == "conf"
+}
+
+// loopbackAddress replace a wildcard listen host with the loopback, so the address can be dialed
+// 将通配监听地址替换为回环地址，使地址可以被连接
+func loopbackAddress(address string) string {
+	host, port, err := net.SplitHostPort(address)
+	if err != nil {
+		return address
+	}
+	switch host {
+	case "", "0.0.0.0":
+		host = "127.0.0.1"
+	case "::":
+		host = "::1"
+	}
+	return net.JoinHostPort(host, port)
+}
+
+// placeholderRegexp Kratos ${NAME} or ${NAME:default} placeholder taking a whole value
+// 占据整个值的 Kratos ${NAME} 或 ${NAME:default} 占位符
+var placeholderRegexp = regexp.MustCompile(`^\$\{([A-Za-z_][A-Za-z0-9_.]*)(?::(.*))?\}$`)
+
+func resolvePlaceholder(value string) string {
+	if match := placeholderRegexp.FindStringSubmatch(strings.TrimSpace(value)); match != nil {
+		return match[2]
+	}
+	return value
+}
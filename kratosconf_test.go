@@ -0,0 +1,93 @@
+package supervisorkratos_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/orzkratos/supervisorkratos"
+	"github.com/stretchr/testify/require"
+)
+
+// writeKratosProject write configs/config.yaml of a Kratos project and return its root
+// 写入 Kratos 项目的 configs/config.yaml 并返回项目根目录
+func writeKratosProject(t *testing.T, content string) string {
+	root := t.TempDir()
+	require.NoError(t, os.MkdirAll(filepath.Join(root, "configs"), 0755))
+	require.NoError(t, os.WriteFile(filepath.Join(root, "configs", "config.yaml"), []byte(content), 0644))
+	return root
+}
+
+func TestLoadKratosConfig(t *testing.T) {
+	// Test addresses, timeouts, placeholders and app metadata are read
+	// 测试读取地址、超时、占位符和应用元数据
+	root := writeKratosProject(t, `
+app:
+  name: demo
+  version: v1.2.0
+  metadata:
+    zone: sh
+server:
+  http:
+    addr: ${HTTP_ADDR:0.0.0.0:8000}
+    timeout: 1s
+  grpc:
+    addr: 0.0.0.0:9000
+    timeout: 2s
+data:
+  database:
+    driver: mysql
+`)
+	kratos, err := supervisorkratos.LoadKratosConfig(filepath.Join(root, "configs"))
+	require.NoError(t, err)
+	require.Equal(t, filepath.Join(root, "configs", "config.yaml"), kratos.Path)
+	require.Equal(t, "0.0.0.0:8000", kratos.HTTPAddr)
+	require.Equal(t, time.Second, kratos.HTTPTimeout)
+	require.Equal(t, "0.0.0.0:9000", kratos.GRPCAddr)
+	require.Equal(t, 2*time.Second, kratos.GRPCTimeout)
+	require.Equal(t, "demo", kratos.AppName)
+	require.Equal(t, "v1.2.0", kratos.AppVersion)
+	require.Equal(t, map[string]string{"zone": "sh"}, kratos.Metadata)
+
+	_, err = supervisorkratos.LoadKratosConfig(writeKratosProject(t, "server:\n  http:\n    addr: 8000\n"))
+	require.ErrorContains(t, err, "is not host:port")
+	_, err = supervisorkratos.LoadKratosConfig(writeKratosProject(t, "data: {}\n"))
+	require.ErrorContains(t, err, "neither")
+}
+
+func TestNewKratosProgramConfig(t *testing.T) {
+	// Test program is pre-populated with -conf, health check and environment
+	// 测试程序预填充 -conf、健康检查和环境变量
+	root := writeKratosProject(t, `
+server:
+  http:
+    addr: 0.0.0.0:8000
+  grpc:
+    addr: 0.0.0.0:9000
+`)
+	program, err := supervisorkratos.NewKratosProgramConfig("demo", root, "deploy", "/var/log/services")
+	require.NoError(t, err)
+	require.NoError(t, program.Validate())
+	require.Equal(t, []string{"-conf", filepath.Join(root, "configs")}, program.Args.Get())
+	require.Equal(t, supervisorkratos.HealthCheckTCP, program.HealthCheck.Kind)
+	require.Equal(t, "127.0.0.1:8000", program.HealthCheck.Address)
+	require.Equal(t, map[string]string{
+		"KRATOS_HTTP_ADDR": "0.0.0.0:8000",
+		"KRATOS_GRPC_ADDR": "0.0.0.0:9000",
+	}, program.Environment.Get())
+
+	// Values set by hand are kept
+	// 手动设置的值会被保留
+	kratos, err := program.LoadKratosConfig()
+	require.NoError(t, err)
+	program = supervisorkratos.NewProgramConfig("demo", root, "deploy", "/var/log/services").
+		WithArgs("--conf=/etc/demo").
+		WithEnvironment(map[string]string{"KRATOS_HTTP_ADDR": "127.0.0.1:8080"}).
+		WithHealthCheck(supervisorkratos.NewHTTPHealthCheck("127.0.0.1:8080", "/healthz")).
+		WithKratosConfig(kratos)
+	require.Equal(t, []string{"--conf=/etc/demo"}, program.Args.Get())
+	require.Equal(t, supervisorkratos.HealthCheckHTTP, program.HealthCheck.Kind)
+	require.Equal(t, "127.0.0.1:8080", program.Environment.Get()["KRATOS_HTTP_ADDR"])
+	require.Equal(t, "0.0.0.0:9000", program.Environment.Get()["KRATOS_GRPC_ADDR"])
+}
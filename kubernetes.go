@@ -0,0 +1,384 @@
+package supervisorkratos
+
+import (
+	"bytes"
+	"math"
+	"net"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/yyle88/must"
+	"gopkg.in/yaml.v3"
+)
+
+// KubernetesConfig Kubernetes Deployment rendering of a program, pure generation without cluster access
+// Settings needing a mapping only the caller knows, like the numeric UID of UserName, are supplied here
+//
+// 程序的 Kubernetes Deployment 渲染配置，纯生成，不访问集群
+// 需要只有调用方知道的映射的设置（例如 UserName 的数字 UID）在这里提供
+type KubernetesConfig struct {
+	Program    *ProgramConfig    // Program to render // 要渲染的程序
+	Image      string            // Container image // 容器镜像
+	Namespace  *Opt[string]      // Namespace of the Deployment // Deployment 的命名空间
+	RunAsUser  *Opt[int]         // UID of UserName in the image // UserName 在镜像中的 UID
+	RunAsGroup *Opt[int]         // GID of the process in the image // 进程在镜像中的 GID
+	Labels     map[string]string // Extra labels of the Deployment and pods // Deployment 和 pod 的额外标签
+}
+
+// NewKubernetesConfig create new KubernetesConfig with the program and image
+// 创建新的 KubernetesConfig，需要提供程序和镜像
+func NewKubernetesConfig(program *ProgramConfig, image string) *KubernetesConfig {
+	return &KubernetesConfig{
+		Program:    program,
+		Image:      must.Nice(image),
+		Namespace:  NewOpt(""),
+		RunAsUser:  NewOpt(0),
+		RunAsGroup: NewOpt(0),
+		Labels:     make(map[string]string),
+	}
+}
+
+// WithNamespace set namespace of the Deployment
+// 设置 Deployment 的命名空间
+func (k *KubernetesConfig) WithNamespace(namespace string) *KubernetesConfig {
+	k.Namespace.Set(namespace)
+	return k
+}
+
+// WithRunAsUser set UID that UserName has in the image, required since Kubernetes runs containers by UID
+// 设置 UserName 在镜像中的 UID，Kubernetes 按 UID 运行容器，因此必须设置
+func (k *KubernetesConfig) WithRunAsUser(uid int) *KubernetesConfig {
+	k.RunAsUser.Set(uid)
+	return k
+}
+
+// WithRunAsGroup set GID of the process in the image
+// 设置进程在镜像中的 GID
+func (k *KubernetesConfig) WithRunAsGroup(gid int) *KubernetesConfig {
+	k.RunAsGroup.Set(gid)
+	return k
+}
+
+// WithLabel add label to the Deployment and its pods
+// 为 Deployment 及其 pod 添加标签
+func (k *KubernetesConfig) WithLabel(key string, value string) *KubernetesConfig {
+	k.Labels[key] = value
+	return k
+}
+
+// kubernetesNameRegexp DNS-1123 label, the form of Deployment and container names
+// DNS-1123 标签，Deployment 和容器名称的格式
+var kubernetesNameRegexp = regexp.MustCompile(`^[a-z0-9]([-a-z0-9]{0,61}[a-z0-9])?$`)
+
+type kubernetesDeployment struct {
+	APIVersion string             `yaml:"apiVersion"`
+	Kind       string             `yaml:"kind"`
+	Metadata   kubernetesMetadata `yaml:"metadata"`
+	Spec       struct {
+		Replicas        int `yaml:"replicas"`
+		MinReadySeconds int `yaml:"minReadySeconds,omitempty"`
+		Selector        struct {
+			MatchLabels map[string]string `yaml:"matchLabels"`
+		} `yaml:"selector"`
+		Template struct {
+			Metadata struct {
+				Labels map[string]string `yaml:"labels"`
+			} `yaml:"metadata"`
+			Spec kubernetesPodSpec `yaml:"spec"`
+		} `yaml:"template"`
+	} `yaml:"spec"`
+}
+
+type kubernetesMetadata struct {
+	Name      string            `yaml:"name"`
+	Namespace string            `yaml:"namespace,omitempty"`
+	Labels    map[string]string `yaml:"labels"`
+}
+
+type kubernetesPodSpec struct {
+	RestartPolicy                 string                `yaml:"restartPolicy"`
+	TerminationGracePeriodSeconds int                   `yaml:"terminationGracePeriodSeconds"`
+	SecurityContext               map[string]int        `yaml:"securityContext"`
+	Containers                    []kubernetesContainer `yaml:"containers"`
+}
+
+type kubernetesContainer struct {
+	Name           string             `yaml:"name"`
+	Image          string             `yaml:"image"`
+	Command        []string           `yaml:"command"`
+	WorkingDir     string             `yaml:"workingDir"`
+	Env            []kubernetesEnvVar `yaml:"env,omitempty"`
+	Ports          []kubernetesPort   `yaml:"ports,omitempty"`
+	ReadinessProbe *kubernetesProbe   `yaml:"readinessProbe,omitempty"`
+	LivenessProbe  *kubernetesProbe   `yaml:"livenessProbe,omitempty"`
+}
+
+type kubernetesEnvVar struct {
+	Name  string `yaml:"name"`
+	Value string `yaml:"value"`
+}
+
+type kubernetesPort struct {
+	Name          string `yaml:"name"`
+	ContainerPort int    `yaml:"containerPort"`
+}
+
+type kubernetesProbe struct {
+	HTTPGet *struct {
+		Path string `yaml:"path"`
+		Port int    `yaml:"port"`
+	} `yaml:"httpGet,omitempty"`
+	GRPC *struct {
+		Port    int    `yaml:"port"`
+		Service string `yaml:"service,omitempty"`
+	} `yaml:"grpc,omitempty"`
+	TCPSocket *struct {
+		Port int `yaml:"port"`
+	} `yaml:"tcpSocket,omitempty"`
+	Exec *struct {
+		Command []string `yaml:"command"`
+	} `yaml:"exec,omitempty"`
+	PeriodSeconds    int `yaml:"periodSeconds"`
+	TimeoutSeconds   int `yaml:"timeoutSeconds"`
+	FailureThreshold int `yaml:"failureThreshold"`
+}
+
+// GenerateKubernetesDeployment generate Kubernetes Deployment manifest of the program, panics on invalid config
+// 生成程序的 Kubernetes Deployment 清单，配置无效时 panic
+func GenerateKubernetesDeployment(kubernetes *KubernetesConfig) string {
+	return must.V1(GenerateKubernetesDeploymentE(kubernetes))
+}
+
+// GenerateKubernetesDeploymentE generate Kubernetes Deployment manifest of the program
+// Fields map as: NumProcs→replicas, command→command, Root→workingDir, Environment→env, StopWaitSecs→terminationGracePeriodSeconds,
+// AutoRestart→restartPolicy Always, StartSecs→minReadySeconds, UserName→securityContext.runAsUser from RunAsUser,
+// HealthCheck or else the Kratos gRPC (grpc probe) or HTTP (tcpSocket probe) address→readiness and liveness probes
+// Each pod has its own network, so every replica listens on the ports of instance 0
+// Rejected: UserName without RunAsUser, autorestart false (use a Job), a stop signal other than TERM,
+// addresses listening on loopback and expressions pods can't share, like %(process_num)d with replicas
+// Not mapped: StartRetries, ExitCodes, Priority, StopAsGroup, KillAsGroup, log files and rotation, ProcessName
+//
+// 生成程序的 Kubernetes Deployment 清单
+// 字段映射：NumProcs→replicas，命令→command，Root→workingDir，Environment→env，StopWaitSecs→terminationGracePeriodSeconds，
+// AutoRestart→restartPolicy Always，StartSecs→minReadySeconds，UserName→来自 RunAsUser 的 securityContext.runAsUser，
+// HealthCheck，否则 Kratos gRPC（grpc 探针）或 HTTP（tcpSocket 探针）地址→就绪和存活探针
+// 每个 pod 有独立的网络，因此每个副本都监听第 0 个实例的端口
+// 拒绝：没有 RunAsUser 的 UserName、autorestart false（应使用 Job）、TERM 以外的停止信号、
+// 监听回环地址的地址，以及 pod 之间无法共享的表达式，例如带副本的 %(process_num)d
+// 不映射：StartRetries、ExitCodes、Priority、StopAsGroup、KillAsGroup、日志文件及轮转、ProcessName
+func GenerateKubernetesDeploymentE(kubernetes *KubernetesConfig) (string, error) {
+	if kubernetes == nil || kubernetes.Program == nil {
+		return "", errors.New("kubernetes config and its program are required")
+	}
+	p := kubernetes.Program
+	if err := p.Validate(); err != nil {
+		return "", err
+	}
+	v := &validator{}
+	section := "program:" + p.Name
+	if !kubernetesNameRegexp.MatchString(p.Name) {
+		v.add(section, "Name", p.Name, ErrInvalidValue, "Kubernetes names are lowercase letters, digits and \"-\"")
+	}
+	if !kubernetes.RunAsUser.IsSet() {
+		v.add(section, "UserName", p.UserName, ErrRequired, "user %q needs a securityContext UID, set it with WithRunAsUser", p.UserName)
+	}
+	if autoRestart := p.AutoRestart.Get(); autoRestart == false || autoRestart == "false" {
+		v.add(section, "AutoRestart", autoRestart, ErrInvalidValue, "Deployment pods always restart, run programs that should not restart as a Job")
+	}
+	if signalName(p.StopSignal.Get()) != "TERM" {
+		v.add(section, "StopSignal", p.StopSignal.Get(), ErrInvalidValue, "Kubernetes stops containers with TERM, set STOPSIGNAL in the image instead")
+	}
+
+	vars := p.instanceVars("", 0)
+	expand := func(field string, value string) string {
+		res, err := kubernetesExpand(value, vars, p.NumProcs.Get())
+		if err != nil {
+			v.add(section, field, value, ErrInvalidValue, "%s", err.Error())
+		}
+		return res
+	}
+
+	labels := map[string]string{"app": p.Name}
+	for key, value := range kubernetes.Labels {
+		labels[key] = value
+	}
+	res := &kubernetesDeployment{
+		APIVersion: "apps/v1",
+		Kind:       "Deployment",
+		Metadata:   kubernetesMetadata{Name: p.Name, Namespace: kubernetes.Namespace.Get(), Labels: labels},
+	}
+	res.Spec.Replicas = p.NumProcs.Get()
+	if p.StartSecs.IsSet() {
+		res.Spec.MinReadySeconds = p.StartSecs.Get()
+	}
+	res.Spec.Selector.MatchLabels = map[string]string{"app": p.Name}
+	res.Spec.Template.Metadata.Labels = labels
+
+	pod := &res.Spec.Template.Spec
+	pod.RestartPolicy = "Always"
+	pod.TerminationGracePeriodSeconds = p.StopWaitSecs.Get()
+	pod.SecurityContext = map[string]int{"runAsUser": kubernetes.RunAsUser.Get()}
+	if kubernetes.RunAsGroup.IsSet() {
+		pod.SecurityContext["runAsGroup"] = kubernetes.RunAsGroup.Get()
+	}
+
+	container := kubernetesContainer{Name: p.Name, Image: kubernetes.Image, WorkingDir: expand("Root", p.Root)}
+	for _, arg := range p.CommandArgs() {
+		container.Command = append(container.Command, expand("Command", arg))
+	}
+	environment := p.Environment.Get()
+	if p.Ports != nil {
+		addresses, _ := p.Ports.portEnvironment(1, 0)
+		environment = mergeEnvironment(environment, addresses)
+	}
+	for _, key := range sortedKeys(environment) {
+		container.Env = append(container.Env, kubernetesEnvVar{Name: key, Value: expand("Environment", environment[key])})
+	}
+
+	httpPort, grpcPort := p.kubernetesPorts(v, section, environment)
+	for _, item := range []kubernetesPort{{"http", httpPort}, {"grpc", grpcPort}} {
+		if item.ContainerPort != 0 {
+			container.Ports = append(container.Ports, item)
+		}
+	}
+	container.ReadinessProbe = p.kubernetesProbe(v, section, httpPort, grpcPort)
+	container.LivenessProbe = container.ReadinessProbe
+	pod.Containers = []kubernetesContainer{container}
+
+	if err := v.result(); err != nil {
+		return "", err
+	}
+	var buffer bytes.Buffer
+	encoder := yaml.NewEncoder(&buffer)
+	encoder.SetIndent(2)
+	must.Done(encoder.Encode(res))
+	must.Done(encoder.Close())
+	return buffer.String(), nil
+}
+
+// kubernetesPorts HTTP and gRPC ports from Ports or the Kratos address variables, 0 when unknown
+// Addresses listening on loopback are rejected since neither probes nor services can reach them
+//
+// 来自 Ports 或 Kratos 地址变量的 HTTP 和 gRPC 端口，未知时为 0
+// 监听回环地址的地址会被拒绝，因为探针和 service 都无法访问
+func (p *ProgramConfig) kubernetesPorts(v *validator, section string, environment map[string]string) (int, int) {
+	httpEnv, grpcEnv := "KRATOS_HTTP_ADDR", "KRATOS_GRPC_ADDR"
+	if p.Ports != nil {
+		httpEnv, grpcEnv = p.Ports.HTTPEnv, p.Ports.GRPCEnv
+	}
+	ports := make([]int, 0, 2)
+	for _, key := range []string{httpEnv, grpcEnv} {
+		address, ok := environment[key]
+		if !ok {
+			ports = append(ports, 0)
+			continue
+		}
+		host, port, err := splitHostPort(address)
+		if err != nil {
+			v.add(section, "Environment", address, ErrInvalidValue, "%s is not a host:port address", key)
+		} else if ip := net.ParseIP(host); host == "localhost" || (ip != nil && ip.IsLoopback()) {
+			v.add(section, "Environment", address, ErrInvalidValue, "%s listens on loopback, pods must listen on all interfaces", key)
+		}
+		ports = append(ports, port)
+	}
+	return ports[0], ports[1]
+}
+
+// kubernetesProbe probe from HealthCheck, otherwise a grpc probe of the gRPC port or a tcpSocket probe of the HTTP port
+// 来自 HealthCheck 的探针，否则为 gRPC 端口的 grpc 探针或 HTTP 端口的 tcpSocket 探针
+func (p *ProgramConfig) kubernetesProbe(v *validator, section string, httpPort int, grpcPort int) *kubernetesProbe {
+	check := p.HealthCheck
+	if check == nil {
+		switch {
+		case grpcPort != 0:
+			check = newHealthCheck(HealthCheckGRPC, "")
+		case httpPort != 0:
+			check = newHealthCheck(HealthCheckTCP, "")
+		default:
+			return nil
+		}
+	}
+	res := &kubernetesProbe{
+		PeriodSeconds:    kubernetesSeconds(check.Interval),
+		TimeoutSeconds:   kubernetesSeconds(check.Timeout),
+		FailureThreshold: check.Threshold,
+	}
+	if check.Kind == HealthCheckExec {
+		res.Exec = &struct {
+			Command []string `yaml:"command"`
+		}{Command: slices.Clone(check.Command)}
+		return res
+	}
+
+	port := httpPort
+	if (check.Kind == HealthCheckGRPC && grpcPort != 0) || port == 0 {
+		port = grpcPort
+	}
+	if p.HealthCheck != nil && p.Ports == nil {
+		_, checkPort, err := splitHostPort(p.healthAddress("", 0))
+		if err != nil {
+			v.add(section, "HealthCheck.Address", check.Address, ErrInvalidValue, "probes need a host:port address")
+		}
+		port = checkPort
+	}
+	switch check.Kind {
+	case HealthCheckHTTP:
+		res.HTTPGet = &struct {
+			Path string `yaml:"path"`
+			Port int    `yaml:"port"`
+		}{Path: check.Path, Port: port}
+	case HealthCheckGRPC:
+		res.GRPC = &struct {
+			Port    int    `yaml:"port"`
+			Service string `yaml:"service,omitempty"`
+		}{Port: port, Service: check.Service}
+	default:
+		res.TCPSocket = &struct {
+			Port int `yaml:"port"`
+		}{Port: port}
+	}
+	return res
+}
+
+// kubernetesSeconds round duration up to whole seconds, probes take at least 1
+// 将时长向上取整为秒，探针至少为 1
+func kubernetesSeconds(duration time.Duration) int {
+	return max(1, int(math.Ceil(duration.Seconds())))
+}
+
+// kubernetesExpand expand supervisor expressions of value the same in every pod, "$(" is escaped as "$$(" to skip Kubernetes expansion
+// %(process_num) is 0 with a single replica, names without a pod wide value are reported as errors
+//
+// 按每个 pod 相同的值展开 value 中的 supervisor 表达式，"$(" 转义为 "$$(" 以跳过 Kubernetes 的展开
+// 单副本时 %(process_num) 为 0，没有 pod 通用值的名称会作为错误报告
+func kubernetesExpand(value string, vars map[string]string, replicas int) (string, error) {
+	var res strings.Builder
+	for i := 0; i < len(value); i++ {
+		if value[i] != '%' {
+			if strings.HasPrefix(value[i:], "$(") {
+				res.WriteByte('$')
+			}
+			res.WriteByte(value[i])
+			continue
+		}
+		name, size, ok := scanExpansion(value[i:])
+		if !ok || (!slices.Contains(expansionNames, name) && !strings.HasPrefix(name, "ENV_")) {
+			res.WriteByte('%')
+			continue
+		}
+		expression := value[i : i+size]
+		switch {
+		case name == "process_num" && replicas > 1:
+			return "", errors.Errorf("%s differs between replicas, Deployment pods share one template", expression)
+		case name == "program_name" || name == "group_name" || name == "numprocs" || name == "process_num":
+			res.WriteString(expandExpressions(expression, vars))
+		default:
+			return "", errors.Errorf("%s has no Kubernetes equivalent", expression)
+		}
+		i += size - 1
+	}
+	return res.String(), nil
+}
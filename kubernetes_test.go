@@ -0,0 +1,93 @@
+package supervisorkratos_test
+
+import (
+	"flag"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/orzkratos/supervisorkratos"
+	"github.com/stretchr/testify/require"
+)
+
+var updateGolden = flag.Bool("update", false, "rewrite golden files in testdata")
+
+// requireGolden compare content with testdata/<name>, rewrite the file when -update is passed
+// 将 content 与 testdata/<name> 比较，传入 -update 时重写该文件
+func requireGolden(t *testing.T, name string, content string) {
+	path := filepath.Join("testdata", name)
+	if *updateGolden {
+		require.NoError(t, os.WriteFile(path, []byte(content), 0644))
+	}
+	expected, err := os.ReadFile(path)
+	require.NoError(t, err)
+	require.Equal(t, string(expected), content)
+}
+
+func TestKubernetesDeploymentKratos(t *testing.T) {
+	// Test a Kratos program renders replicas, env, grace period and a grpc probe of its gRPC address
+	// 测试 Kratos 程序渲染出副本数、环境变量、优雅停止时间以及其 gRPC 地址的 grpc 探针
+	program := supervisorkratos.NewProgramConfig("api", "/app", "app", "/var/log/services").
+		WithArgs("-conf", "/app/configs", "-name", "%(program_name)s").
+		WithEnvironment(map[string]string{"APP_ENV": "prod", "GREETING": "$(HOME)"}).
+		WithNumProcs(3).
+		WithProcessName("%(program_name)s_%(process_num)d").
+		WithStartSecs(5).
+		WithStopWaitSecs(30).
+		WithPorts(supervisorkratos.NewPortAllocation(8000, 9000))
+
+	content := supervisorkratos.GenerateKubernetesDeployment(supervisorkratos.NewKubernetesConfig(program, "example/api:v1.0.0").
+		WithNamespace("services").
+		WithRunAsUser(1000).
+		WithRunAsGroup(1000).
+		WithLabel("tier", "backend"))
+	requireGolden(t, "kubernetes/api.golden.yaml", content)
+}
+
+func TestKubernetesDeploymentHealthCheck(t *testing.T) {
+	// Test an HTTP health check becomes an httpGet probe on the port of its address, and %(group_name)s is the program name
+	// 测试 HTTP 健康检查成为其地址端口上的 httpGet 探针，且 %(group_name)s 为程序名称
+	program := supervisorkratos.NewProgramConfig("gateway", "/app", "app", "/var/log/services").
+		WithArgs("-group", "%(group_name)s").
+		WithEnvironment(map[string]string{"KRATOS_HTTP_ADDR": "0.0.0.0:8080"}).
+		WithHealthCheck(supervisorkratos.NewHTTPHealthCheck("127.0.0.1:8080", "/healthz").
+			WithInterval(15 * time.Second).
+			WithTimeout(1500 * time.Millisecond))
+
+	content := supervisorkratos.GenerateKubernetesDeployment(supervisorkratos.NewKubernetesConfig(program, "example/gateway:v1.0.0").
+		WithRunAsUser(1000))
+	requireGolden(t, "kubernetes/gateway.golden.yaml", content)
+}
+
+func TestKubernetesDeploymentRejects(t *testing.T) {
+	// Test settings needing a mapping from the caller are rejected
+	// 测试需要调用方提供映射的设置会被拒绝
+	program := supervisorkratos.NewProgramConfig("api", "/app", "app", "/var/log/services").
+		WithNumProcs(2).
+		WithProcessName("%(program_name)s_%(process_num)d").
+		WithArgs("-id", "%(process_num)d").
+		WithEnvironment(map[string]string{"KRATOS_HTTP_ADDR": "127.0.0.1:8000"}).
+		WithAutoRestart(false).
+		WithStopSignal("INT")
+
+	_, err := supervisorkratos.GenerateKubernetesDeploymentE(supervisorkratos.NewKubernetesConfig(program, "example/api:v1.0.0"))
+	require.ErrorIs(t, err, supervisorkratos.ErrRequired)
+	require.ErrorIs(t, err, supervisorkratos.ErrInvalidValue)
+	var validationErr *supervisorkratos.ValidationError
+	require.ErrorAs(t, err, &validationErr)
+	fields := make([]string, 0, len(validationErr.Errors))
+	for _, fieldErr := range validationErr.Errors {
+		fields = append(fields, fieldErr.Field)
+	}
+	require.Equal(t, []string{"UserName", "AutoRestart", "StopSignal", "Command", "Environment"}, fields)
+	require.ErrorContains(t, err, "WithRunAsUser")
+
+	// TERM is accepted in any case with or without the "SIG" prefix
+	// TERM 可以是任意大小写，带或不带 "SIG" 前缀
+	for _, signal := range []string{"SIGTERM", "term"} {
+		program := supervisorkratos.NewProgramConfig("api", "/app", "app", "/var/log/services").WithStopSignal(signal)
+		_, err := supervisorkratos.GenerateKubernetesDeploymentE(supervisorkratos.NewKubernetesConfig(program, "example/api:v1.0.0").WithRunAsUser(1000))
+		require.NoError(t, err, signal)
+	}
+}
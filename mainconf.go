@@ -0,0 +1,190 @@
+package supervisorkratos
+
+import (
+	"path/filepath"
+	"strings"
+
+	"github.com/yyle88/must"
+	"github.com/yyle88/printgo"
+)
+
+// MainConfig complete supervisord.conf with main and control-plane sections
+// 包含主段和控制面各段的完整 supervisord.conf
+type MainConfig struct {
+	Supervisord    *SupervisordConfig    // [supervisord] section // [supervisord] 段
+	UnixHTTPServer *UnixHTTPServerConfig // Optional [unix_http_server] section // 可选的 [unix_http_server] 段
+	InetHTTPServer *InetHTTPServerConfig // Optional [inet_http_server] section // 可选的 [inet_http_server] 段
+	RPCInterface   *RPCInterfaceConfig   // Optional [rpcinterface:x] section // 可选的 [rpcinterface:x] 段
+	Supervisorctl  *SupervisorctlConfig  // Optional [supervisorctl] section // 可选的 [supervisorctl] 段
+	IncludeFiles   []string              // Optional [include] file globs // 可选的 [include] 文件通配
+}
+
+// NewMainConfig create new MainConfig with [supervisord] section and the standard rpc interface
+// 创建新的 MainConfig，包含 [supervisord] 段和标准 rpc interface
+func NewMainConfig(supervisord *SupervisordConfig) *MainConfig {
+	return &MainConfig{
+		Supervisord:  must.Full(supervisord),
+		RPCInterface: NewRPCInterfaceConfig(),
+		IncludeFiles: make([]string, 0),
+	}
+}
+
+// WithUnixHTTPServer set [unix_http_server] section
+// 设置 [unix_http_server] 段
+func (m *MainConfig) WithUnixHTTPServer(config *UnixHTTPServerConfig) *MainConfig {
+	m.UnixHTTPServer = config
+	return m
+}
+
+// WithInetHTTPServer set [inet_http_server] section
+// 设置 [inet_http_server] 段
+func (m *MainConfig) WithInetHTTPServer(config *InetHTTPServerConfig) *MainConfig {
+	m.InetHTTPServer = config
+	return m
+}
+
+// WithRPCInterface set [rpcinterface:x] section
+// 设置 [rpcinterface:x] 段
+func (m *MainConfig) WithRPCInterface(config *RPCInterfaceConfig) *MainConfig {
+	m.RPCInterface = config
+	return m
+}
+
+// WithSupervisorctl set [supervisorctl] section
+// 设置 [supervisorctl] 段
+func (m *MainConfig) WithSupervisorctl(config *SupervisorctlConfig) *MainConfig {
+	m.Supervisorctl = config
+	return m
+}
+
+// WithInclude set [include] file globs, e.g. "/etc/supervisor/conf.d/*.conf"
+// 设置 [include] 文件通配，例如 "/etc/supervisor/conf.d/*.conf"
+func (m *MainConfig) WithInclude(files ...string) *MainConfig {
+	m.IncludeFiles = files
+	return m
+}
+
+// Validate check every section and that supervisorctl serverurl matches a configured server
+// 校验每个段，并检查 supervisorctl 的 serverurl 与已配置的服务端一致
+func (m *MainConfig) Validate() error {
+	v := &validator{}
+	if m == nil {
+		v.add("main", "MainConfig", nil, ErrRequired, "nil config")
+		return v.result()
+	}
+	m.validateFields(v)
+	return v.result()
+}
+
+func (m *MainConfig) validateFields(v *validator) {
+	m.Supervisord.validateFields(v)
+	if m.UnixHTTPServer != nil {
+		m.UnixHTTPServer.validateFields(v)
+	}
+	if m.InetHTTPServer != nil {
+		m.InetHTTPServer.validateFields(v)
+	}
+	if m.RPCInterface != nil {
+		m.RPCInterface.validateFields(v)
+	}
+	if m.Supervisorctl != nil {
+		m.Supervisorctl.validateFields(v)
+		m.validateServerURL(v)
+	}
+	for _, file := range m.IncludeFiles {
+		if strings.TrimSpace(file) == "" || strings.ContainsAny(file, " \t\n") {
+			v.add("include", "IncludeFiles", file, ErrInvalidValue, "include glob must be non-empty without blanks")
+		}
+	}
+}
+
+// validateServerURL check supervisorctl can reach one of the configured servers
+// 检查 supervisorctl 能连接到已配置的某个服务端
+func (m *MainConfig) validateServerURL(v *validator) {
+	const section = "supervisorctl"
+	if m.UnixHTTPServer == nil && m.InetHTTPServer == nil {
+		v.add(section, "ServerURL", m.Supervisorctl.ServerURL, ErrInvalidValue, "no [unix_http_server] or [inet_http_server] is configured")
+		return
+	}
+	if m.RPCInterface == nil || m.RPCInterface.Name != "supervisor" {
+		v.add(section, "RPCInterface", nil, ErrRequired, "supervisorctl requires [rpcinterface:supervisor]")
+	}
+	serverURL, err := parseServerURL(m.Supervisorctl.ServerURL)
+	if err != nil {
+		return // Reported by SupervisorctlConfig // 已由 SupervisorctlConfig 报告
+	}
+	switch serverURL.Scheme {
+	case "unix":
+		if m.UnixHTTPServer == nil || filepath.Clean(serverURL.Path) != filepath.Clean(m.UnixHTTPServer.File) {
+			v.add(section, "ServerURL", m.Supervisorctl.ServerURL, ErrInvalidValue, "does not match [unix_http_server] file")
+		}
+	case "http":
+		if m.InetHTTPServer == nil || !matchInetServer(serverURL.Host, m.InetHTTPServer.Port) {
+			v.add(section, "ServerURL", m.Supervisorctl.ServerURL, ErrInvalidValue, "does not match [inet_http_server] port")
+		}
+	}
+}
+
+// matchInetServer check supervisorctl host:port reaches server listen address
+// Server host "*" or empty listens on all interfaces
+//
+// 检查 supervisorctl 的 host:port 能否到达服务端监听地址
+// 服务端 host 为 "*" 或空时监听所有网卡
+func matchInetServer(clientAddress string, serverAddress string) bool {
+	clientHost, clientPort, err := splitHostPort(clientAddress)
+	if err != nil {
+		return false
+	}
+	serverHost, serverPort, err := inetAddress(serverAddress)
+	if err != nil || clientPort != serverPort {
+		return false
+	}
+	if serverHost == "" || serverHost == "*" || serverHost == "0.0.0.0" || serverHost == "::" {
+		return true
+	}
+	if serverHost == clientHost {
+		return true
+	}
+	isLocal := func(host string) bool {
+		return host == "localhost" || host == "127.0.0.1" || host == "::1"
+	}
+	return isLocal(serverHost) && isLocal(clientHost)
+}
+
+// GenerateMainConfig generate complete supervisord.conf, panics on invalid config
+// 生成完整的 supervisord.conf，配置无效时 panic
+func GenerateMainConfig(config *MainConfig) string {
+	return must.V1(GenerateMainConfigE(config))
+}
+
+// GenerateMainConfigE generate complete supervisord.conf
+// Returns *ValidationError listing every invalid field of every section
+//
+// 生成完整的 supervisord.conf
+// 返回列出每个段所有无效字段的 *ValidationError
+func GenerateMainConfigE(config *MainConfig) (string, error) {
+	if err := config.Validate(); err != nil {
+		return "", err
+	}
+
+	sections := []string{renderSupervisordConfig(config.Supervisord)}
+	if config.UnixHTTPServer != nil {
+		sections = append(sections, renderUnixHTTPServerConfig(config.UnixHTTPServer))
+	}
+	if config.InetHTTPServer != nil {
+		sections = append(sections, renderInetHTTPServerConfig(config.InetHTTPServer))
+	}
+	if config.RPCInterface != nil {
+		sections = append(sections, renderRPCInterfaceConfig(config.RPCInterface))
+	}
+	if config.Supervisorctl != nil {
+		sections = append(sections, renderSupervisorctlConfig(config.Supervisorctl))
+	}
+	if len(config.IncludeFiles) > 0 {
+		ptx := printgo.NewPTX()
+		ptx.Println("[include]")
+		ptx.Println(iniLine("files", strings.Join(config.IncludeFiles, " ")))
+		sections = append(sections, ptx.String())
+	}
+	return strings.Join(sections, "\n"), nil
+}
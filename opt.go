@@ -21,3 +21,11 @@ func (sv *Opt[T]) Set(v T) {
 func (sv *Opt[T]) IsSet() bool {
 	return sv.isSet
 }
+
+func (sv *Opt[T]) clone() *Opt[T] {
+	if sv == nil {
+		return nil
+	}
+	res := *sv
+	return &res
+}
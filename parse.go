@@ -0,0 +1,682 @@
+package supervisorkratos
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/pkg/errors"
+)
+
+// ErrUnsupported parse error kind of text supervisor accepts but the configs of this package can't hold
+// ErrUnsupported 解析错误类型，表示 supervisor 接受但本包的配置无法表示的文本
+var ErrUnsupported = errors.New("unsupported")
+
+// ParseError error of supervisor INI text pointing at the line it comes from
+// 指向出错所在行的 supervisor INI 文本错误
+type ParseError struct {
+	Line    int    // Line number, of the key when Key is set // 行号，设置了 Key 时为该键所在行
+	Section string // Section name, empty before the first section // 段名称，在第一个段之前为空
+	Key     string // Key name, empty for errors of the whole section // 键名称，整个段的错误为空
+	Err     error  // Error kind, ErrUnsupported or one of the validation kinds // 错误类型，ErrUnsupported 或校验错误类型之一
+	Reason  string // Human readable reason // 可读的原因
+}
+
+// Error implements error
+// 实现 error 接口
+func (e *ParseError) Error() string {
+	msg := fmt.Sprintf("line %d", e.Line)
+	if e.Section != "" {
+		msg += ": [" + e.Section + "]"
+	}
+	if e.Key != "" {
+		msg += fmt.Sprintf(": key %q", e.Key)
+	}
+	return msg + ": " + e.Err.Error() + ": " + e.Reason
+}
+
+// Unwrap returns the error kind so errors.Is works
+// 返回错误类型，以便 errors.Is 生效
+func (e *ParseError) Unwrap() error {
+	return e.Err
+}
+
+// IniSection single section parsed from supervisor INI text
+// 从 supervisor INI 文本解析出的单个段
+type IniSection struct {
+	Name   string            // Section name, e.g. "program:myapp" // 段名称，例如 "program:myapp"
+	Line   int               // Line number of section header // 段头所在行号
+	Keys   []string          // Keys in source order // 按源顺序排列的键
+	Values map[string]string // Key values // 键值
+	Lines  map[string]int    // Line number of each key // 每个键所在行号
+}
+
+// Get get value of key and whether key is present
+// 获取键的值以及键是否存在
+func (s *IniSection) Get(key string) (string, bool) {
+	value, ok := s.Values[key]
+	return value, ok
+}
+
+// Kind get section kind, e.g. "program" of "program:myapp"
+// 获取段类型，例如 "program:myapp" 的 "program"
+func (s *IniSection) Kind() string {
+	kind, _, _ := strings.Cut(s.Name, ":")
+	return kind
+}
+
+// Title get section title, e.g. "myapp" of "program:myapp"
+// 获取段标题，例如 "program:myapp" 的 "myapp"
+func (s *IniSection) Title() string {
+	_, title, _ := strings.Cut(s.Name, ":")
+	return title
+}
+
+// ParsedConfig configs parsed from supervisor INI text
+// 从 supervisor INI 文本解析出的配置
+type ParsedConfig struct {
+	Sections []*IniSection    // All sections in source order // 按源顺序排列的所有段
+	Programs []*ProgramConfig // Parsed [program:x] sections // 解析出的 [program:x] 段
+	Groups   []*GroupConfig   // Parsed [group:x] sections // 解析出的 [group:x] 段
+
+	EventListeners []*EventListenerConfig // Parsed [eventlistener:x] sections // 解析出的 [eventlistener:x] 段
+	FcgiPrograms   []*FcgiProgramConfig   // Parsed [fcgi-program:x] sections // 解析出的 [fcgi-program:x] 段
+}
+
+// ParseConfigFile parse supervisor INI file into ProgramConfig and GroupConfig
+// 解析 supervisor INI 文件为 ProgramConfig 和 GroupConfig
+func ParseConfigFile(path string) (*ParsedConfig, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, errors.WithMessagef(err, "read %s", path)
+	}
+	res, err := ParseConfig(string(data))
+	if err != nil {
+		return nil, errors.WithMessagef(err, "parse %s", path)
+	}
+	return res, nil
+}
+
+// ParseConfig parse supervisor INI text into ProgramConfig and GroupConfig
+// Only keys present in the text are marked as set, so parse→generate round-trips are stable
+// Sections other than [program:x], [eventlistener:x], [fcgi-program:x] and [group:x] are kept in Sections only
+// Programs must follow the layout this package generates: user, directory and stdout_logfile are required,
+// logs are <SlogRoot>/<name>.log and .err, stdout_* and stderr_* log settings are set together with same value
+// and only keys with a config field are known, other text supervisor accepts is a *ParseError of ErrUnsupported
+// Errors are *ParseError values pointing at the line
+//
+// 解析 supervisor INI 文本为 ProgramConfig 和 GroupConfig
+// 只有文本中出现的键会被标记为已设置，因此 解析→生成 的往返结果是稳定的
+// 除 [program:x]、[eventlistener:x]、[fcgi-program:x] 和 [group:x] 以外的段只保留在 Sections 中
+// 程序必须符合本包生成的布局：user、directory 和 stdout_logfile 必填，
+// 日志为 <SlogRoot>/<name>.log 和 .err，stdout_* 和 stderr_* 日志设置需同时出现且值相同，
+// 并且只识别有对应配置字段的键，supervisor 接受的其他文本会报告为 ErrUnsupported 类型的 *ParseError
+// 错误均为指向出错行的 *ParseError
+func ParseConfig(content string) (*ParsedConfig, error) {
+	sections, err := ParseIni(content)
+	if err != nil {
+		return nil, err
+	}
+
+	res := &ParsedConfig{
+		Sections: sections,
+		Programs: make([]*ProgramConfig, 0),
+		Groups:   make([]*GroupConfig, 0),
+
+		EventListeners: make([]*EventListenerConfig, 0),
+		FcgiPrograms:   make([]*FcgiProgramConfig, 0),
+	}
+	programs := make(map[string]*ProgramConfig)
+	for _, section := range sections {
+		if section.Kind() != "program" {
+			continue
+		}
+		program, err := parseProgramSection(section)
+		if err != nil {
+			return nil, err
+		}
+		programs[program.Name] = program
+		res.Programs = append(res.Programs, program)
+	}
+	for _, section := range sections {
+		if section.Kind() != "eventlistener" {
+			continue
+		}
+		listener, err := parseEventListenerSection(section)
+		if err != nil {
+			return nil, err
+		}
+		res.EventListeners = append(res.EventListeners, listener)
+	}
+	for _, section := range sections {
+		if section.Kind() != "fcgi-program" {
+			continue
+		}
+		program, err := parseFcgiProgramSection(section)
+		if err != nil {
+			return nil, err
+		}
+		res.FcgiPrograms = append(res.FcgiPrograms, program)
+	}
+	for _, section := range sections {
+		if section.Kind() != "group" {
+			continue
+		}
+		group, err := parseGroupSection(section, programs)
+		if err != nil {
+			return nil, err
+		}
+		res.Groups = append(res.Groups, group)
+	}
+
+	// A file with a single group is the layout of GenerateGroupConfig, event listeners and fcgi programs belong to that group
+	// 只有一个组的文件即 GenerateGroupConfig 的布局，事件监听器和 fcgi 程序属于该组
+	if len(res.Groups) == 1 {
+		res.Groups[0].EventListeners = append(res.Groups[0].EventListeners, res.EventListeners...)
+		res.Groups[0].FcgiPrograms = append(res.Groups[0].FcgiPrograms, res.FcgiPrograms...)
+	}
+	return res, nil
+}
+
+// ParseIni parse INI text into sections
+// Supports ";" and "#" comments, inline ";" and "#" comments after whitespace, "=" and ":" delimiters and indented continuation lines
+// Like supervisor, a repeated section is merged into the first one and a repeated key replaces the earlier value
+//
+// 解析 INI 文本为段列表
+// 支持 ";" 和 "#" 注释、空白后的行内 ";" 和 "#" 注释、"=" 和 ":" 分隔符以及缩进的续行
+// 与 supervisor 一样，重复的段合并到第一个段中，重复的键替换之前的值
+func ParseIni(content string) ([]*IniSection, error) {
+	sections := make([]*IniSection, 0)
+	var section *IniSection
+	var lastKey string
+
+	for idx, line := range strings.Split(strings.ReplaceAll(content, "\r\n", "\n"), "\n") {
+		num := idx + 1
+		trimmed := strings.TrimSpace(line)
+		if trimmed == "" {
+			lastKey = ""
+			continue
+		}
+		if trimmed[0] == ';' || trimmed[0] == '#' {
+			continue
+		}
+		value := stripInlineComment(trimmed)
+		lineError := func(kind error, format string, args ...any) error {
+			res := &ParseError{Line: num, Err: kind, Reason: fmt.Sprintf(format, args...)}
+			if section != nil {
+				res.Section = section.Name
+			}
+			return res
+		}
+
+		// Continuation line belongs to previous key
+		// 续行属于前一个键
+		if line[0] == ' ' || line[0] == '\t' {
+			if section == nil || lastKey == "" {
+				return nil, lineError(ErrInvalidValue, "unexpected continuation line")
+			}
+			if value != "" {
+				section.Values[lastKey] = strings.TrimSpace(section.Values[lastKey] + "\n" + value)
+			}
+			continue
+		}
+
+		if value[0] == '[' {
+			section = nil // Header errors don't belong to the previous section // 段头错误不属于前一个段
+			if value[len(value)-1] != ']' {
+				return nil, lineError(ErrInvalidValue, "invalid section header %q", value)
+			}
+			name := strings.TrimSpace(value[1 : len(value)-1])
+			if name == "" {
+				return nil, lineError(ErrRequired, "empty section name")
+			}
+			lastKey = ""
+			if idx := slices.IndexFunc(sections, func(prev *IniSection) bool { return prev.Name == name }); idx >= 0 {
+				section = sections[idx]
+				continue
+			}
+			section = &IniSection{
+				Name:   name,
+				Line:   num,
+				Keys:   make([]string, 0),
+				Values: make(map[string]string),
+				Lines:  make(map[string]int),
+			}
+			sections = append(sections, section)
+			continue
+		}
+
+		if section == nil {
+			return nil, lineError(ErrInvalidValue, "key outside of section")
+		}
+		pos := strings.IndexAny(value, "=:")
+		if pos <= 0 {
+			return nil, lineError(ErrInvalidValue, "invalid line %q", value)
+		}
+		key := strings.ToLower(strings.TrimSpace(value[:pos]))
+		if _, exists := section.Lines[key]; !exists {
+			section.Keys = append(section.Keys, key)
+		}
+		section.Values[key] = strings.TrimSpace(value[pos+1:])
+		section.Lines[key] = num
+		lastKey = key
+	}
+	return sections, nil
+}
+
+// stripInlineComment remove inline comment starting with ";" or "#" after whitespace, the same as supervisor
+// 与 supervisor 相同，移除空白之后以 ";" 或 "#" 开头的行内注释
+func stripInlineComment(s string) string {
+	for i := 1; i < len(s); i++ {
+		if (s[i] == ';' || s[i] == '#') && (s[i-1] == ' ' || s[i-1] == '\t') {
+			return strings.TrimSpace(s[:i])
+		}
+	}
+	return s
+}
+
+// newParseError error of the section, at the line of key when key is set
+// 段的错误，设置了 key 时位于该键所在行
+func newParseError(section *IniSection, key string, kind error, format string, args ...any) *ParseError {
+	line := section.Line
+	if key != "" {
+		line = section.Lines[key]
+	}
+	return &ParseError{
+		Line:    line,
+		Section: section.Name,
+		Key:     key,
+		Err:     kind,
+		Reason:  fmt.Sprintf(format, args...),
+	}
+}
+
+// keyError error of key, a *ParseError is kept and other errors become ErrInvalidValue
+// 键的错误，*ParseError 保持不变，其他错误变为 ErrInvalidValue
+func keyError(section *IniSection, key string, err error) *ParseError {
+	var res *ParseError
+	if errors.As(err, &res) {
+		return res
+	}
+	return newParseError(section, key, ErrInvalidValue, "%s", err.Error())
+}
+
+func parseProgramSection(section *IniSection) (*ProgramConfig, error) {
+	return parseProcessSection(section, func(key string, value string) (bool, error) {
+		return false, nil
+	})
+}
+
+func parseEventListenerSection(section *IniSection) (*EventListenerConfig, error) {
+	listener := &EventListenerConfig{
+		BufferSize:    NewOpt(10),
+		ResultHandler: NewOpt("supervisor.dispatchers:default_handler"),
+	}
+	program, err := parseProcessSection(section, func(key string, value string) (bool, error) {
+		switch key {
+		case "events":
+			for _, event := range splitList(value) {
+				listener.Events = append(listener.Events, EventType(event))
+			}
+		case "buffer_size":
+			return true, parseIntOpt(listener.BufferSize, value)
+		case "result_handler":
+			listener.ResultHandler.Set(value)
+		default:
+			return false, nil
+		}
+		return true, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if len(listener.Events) == 0 {
+		return nil, newParseError(section, "", ErrRequired, "missing required key \"events\"")
+	}
+	listener.ProgramConfig = program
+	return listener, nil
+}
+
+func parseFcgiProgramSection(section *IniSection) (*FcgiProgramConfig, error) {
+	fcgiProgram := &FcgiProgramConfig{
+		SocketOwner:   NewOpt(""),
+		SocketMode:    NewOpt("0700"),
+		SocketBacklog: NewOpt(128),
+	}
+	program, err := parseProcessSection(section, func(key string, value string) (bool, error) {
+		switch key {
+		case "socket":
+			fcgiProgram.Socket = value
+		case "socket_owner":
+			fcgiProgram.SocketOwner.Set(value)
+		case "socket_mode":
+			fcgiProgram.SocketMode.Set(value)
+		case "socket_backlog":
+			return true, parseIntOpt(fcgiProgram.SocketBacklog, value)
+		default:
+			return false, nil
+		}
+		return true, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if fcgiProgram.Socket == "" {
+		return nil, newParseError(section, "", ErrRequired, "missing required key \"socket\"")
+	}
+	fcgiProgram.ProgramConfig = program
+	return fcgiProgram, nil
+}
+
+// parseProcessSection parse section with program keys, sectionKey handles section specific keys first
+// 解析带有程序键的段，sectionKey 优先处理段特有的键
+func parseProcessSection(section *IniSection, sectionKey func(key string, value string) (bool, error)) (*ProgramConfig, error) {
+	name := section.Title()
+	if name == "" {
+		return nil, newParseError(section, "", ErrRequired, "missing program name")
+	}
+
+	// Supervisor has defaults for these, ProgramConfig requires them
+	// supervisor 为这些键提供默认值，而 ProgramConfig 要求必填
+	for _, key := range []string{"user", "directory", "stdout_logfile"} {
+		if value, ok := section.Get(key); !ok || value == "" {
+			return nil, newParseError(section, "", ErrUnsupported, "missing key %q, which ProgramConfig requires", key)
+		}
+	}
+	userName, _ := section.Get("user")
+	root, _ := section.Get("directory")
+	stdoutLogfile, _ := section.Get("stdout_logfile")
+	slogRoot := filepath.Dir(stdoutLogfile)
+	program := NewProgramConfig(name, root, userName, slogRoot)
+
+	// supervisor rejects process sections without a command // supervisor 拒绝没有 command 的进程段
+	command, ok := section.Get("command")
+	if !ok || command == "" {
+		return nil, newParseError(section, "", ErrRequired, "missing required key \"command\"")
+	}
+	if err := parseCommand(program, command); err != nil {
+		return nil, keyError(section, "command", err)
+	}
+
+	// Keys derived from required fields must match the generated layout
+	// 由必填字段派生的键必须与生成的布局一致
+	if stdoutLogfile != filepath.Join(slogRoot, name+".log") {
+		return nil, newParseError(section, "stdout_logfile", ErrUnsupported, "%q is not <SlogRoot>/%s.log", stdoutLogfile, name)
+	}
+	if stderrLogfile, ok := section.Get("stderr_logfile"); ok {
+		if stderrLogfile != filepath.Join(slogRoot, name+".err") {
+			return nil, newParseError(section, "stderr_logfile", ErrUnsupported, "%q is not %q", stderrLogfile, filepath.Join(slogRoot, name+".err"))
+		}
+	}
+
+	for _, key := range section.Keys {
+		value := section.Values[key]
+		handled, err := sectionKey(key, value)
+		if err != nil {
+			return nil, keyError(section, key, err)
+		}
+		if handled {
+			continue
+		}
+		if err := parseProgramKey(program, section, key, value); err != nil {
+			return nil, keyError(section, key, err)
+		}
+	}
+	return program, nil
+}
+
+func parseProgramKey(program *ProgramConfig, section *IniSection, key string, value string) error {
+	switch key {
+	case "user", "directory", "command", "stdout_logfile", "stderr_logfile":
+		return nil // Handled as required fields // 已作为必填字段处理
+	case "environment":
+		environment, err := parseEnvironment(value)
+		if err != nil {
+			return err
+		}
+		program.Environment.Set(environment)
+	case "autostart":
+		return parseBoolOpt(program.AutoStart, value)
+	case "autorestart":
+		autoRestart, err := parseAutoRestart(value)
+		if err != nil {
+			return err
+		}
+		program.AutoRestart.Set(autoRestart)
+	case "startretries":
+		return parseIntOpt(program.StartRetries, value)
+	case "startsecs":
+		return parseIntOpt(program.StartSecs, value)
+	case "stdout_logfile_maxbytes", "stderr_logfile_maxbytes":
+		return parsePairedOpt(program.LogMaxBytes, section, key, value, func(v string) (string, error) { return v, nil })
+	case "stdout_logfile_backups", "stderr_logfile_backups":
+		return parsePairedOpt(program.LogBackups, section, key, value, strconv.Atoi)
+	case "redirect_stderr":
+		return parseBoolOpt(program.RedirectStderr, value)
+	case "stopasgroup":
+		return parseBoolOpt(program.StopAsGroup, value)
+	case "stopwaitsecs":
+		return parseIntOpt(program.StopWaitSecs, value)
+	case "killasgroup":
+		return parseBoolOpt(program.KillAsGroup, value)
+	case "stopsignal":
+		program.StopSignal.Set(value)
+	case "priority":
+		return parseIntOpt(program.Priority, value)
+	case "exitcodes":
+		exitCodes, err := parseInts(value)
+		if err != nil {
+			return err
+		}
+		program.ExitCodes.Set(exitCodes)
+	case "numprocs":
+		return parseIntOpt(program.NumProcs, value)
+	case "process_name":
+		program.ProcessName.Set(value)
+	default:
+		return newParseError(section, key, ErrUnsupported, "no config field for this key")
+	}
+	return nil
+}
+
+func parseGroupSection(section *IniSection, programs map[string]*ProgramConfig) (*GroupConfig, error) {
+	name := section.Title()
+	if name == "" {
+		return nil, newParseError(section, "", ErrRequired, "missing group name")
+	}
+	group := NewGroupConfig(name)
+	for _, key := range section.Keys {
+		if key != "programs" {
+			return nil, newParseError(section, key, ErrUnsupported, "no config field for this key")
+		}
+	}
+	value, ok := section.Get("programs")
+	if !ok {
+		return nil, newParseError(section, "", ErrRequired, "missing required key \"programs\"")
+	}
+	for _, programName := range splitList(value) {
+		program, ok := programs[programName]
+		if !ok {
+			return nil, newParseError(section, "programs", ErrInvalidValue, "program %q is not defined", programName)
+		}
+		group.AddProgram(program)
+	}
+	if len(group.Programs) == 0 {
+		return nil, newParseError(section, "programs", ErrRequired, "empty programs list")
+	}
+	return group, nil
+}
+
+// parsePairedOpt parse value shared by stdout_* and stderr_* keys
+// ProgramConfig holds one value for both, so a key without its pair or with a different value is unsupported
+//
+// 解析 stdout_* 和 stderr_* 共用的值
+// ProgramConfig 对两者只保存一个值，因此缺少配对键或值不同的键不受支持
+func parsePairedOpt[T comparable](opt *Opt[T], section *IniSection, key string, value string, parse func(string) (T, error)) error {
+	pairKey := "stderr_" + strings.TrimPrefix(key, "stdout_")
+	if strings.HasPrefix(key, "stderr_") {
+		pairKey = "stdout_" + strings.TrimPrefix(key, "stderr_")
+	}
+	pairValue, ok := section.Get(pairKey)
+	if !ok {
+		return newParseError(section, key, ErrUnsupported, "requires %q with same value, ProgramConfig sets both together", pairKey)
+	}
+	if pairValue != value {
+		return newParseError(section, key, ErrUnsupported, "value %q differs from %q value %q, ProgramConfig sets both together", value, pairKey, pairValue)
+	}
+	res, err := parse(value)
+	if err != nil {
+		return errors.Errorf("invalid value %q", value)
+	}
+	opt.Set(res)
+	return nil
+}
+
+func parseBoolOpt(opt *Opt[bool], value string) error {
+	res, err := parseBool(value)
+	if err != nil {
+		return err
+	}
+	opt.Set(res)
+	return nil
+}
+
+func parseIntOpt(opt *Opt[int], value string) error {
+	res, err := strconv.Atoi(value)
+	if err != nil {
+		return errors.Errorf("invalid integer %q", value)
+	}
+	opt.Set(res)
+	return nil
+}
+
+// parseBool parse boolean the same way as supervisor
+// 与 supervisor 相同的方式解析布尔值
+func parseBool(value string) (bool, error) {
+	switch strings.ToLower(value) {
+	case "true", "yes", "on", "1":
+		return true, nil
+	case "false", "no", "off", "0":
+		return false, nil
+	default:
+		return false, errors.Errorf("invalid boolean %q", value)
+	}
+}
+
+func parseAutoRestart(value string) (any, error) {
+	if strings.ToLower(value) == "unexpected" {
+		return "unexpected", nil
+	}
+	res, err := parseBool(value)
+	if err != nil {
+		return nil, errors.Errorf("invalid autorestart %q", value)
+	}
+	return res, nil
+}
+
+func parseInts(value string) ([]int, error) {
+	items := splitList(value)
+	results := make([]int, 0, len(items))
+	for _, item := range items {
+		num, err := strconv.Atoi(item)
+		if err != nil {
+			return nil, errors.Errorf("invalid integer %q", item)
+		}
+		results = append(results, num)
+	}
+	return results, nil
+}
+
+// splitList split comma separated list, newlines and blanks are separators too
+// 拆分逗号分隔的列表，换行和空白也作为分隔符
+func splitList(value string) []string {
+	return strings.FieldsFunc(value, func(r rune) bool {
+		return r == ',' || r == ' ' || r == '\t' || r == '\n'
+	})
+}
+
+// parseEnvironment parse supervisor environment value: KEY=val,KEY2="val,2"
+// Tokens are lexed the same way as supervisor's shlex and read in KEY = value groups, like supervisor
+// the token after each group is skipped as its separator, so A=foo bar reads as A=foo
+//
+// 解析 supervisor 环境变量值：KEY=val,KEY2="val,2"
+// 与 supervisor 的 shlex 相同地切分单词并按 KEY = value 分组读取，与 supervisor 一样
+// 每组之后的单词作为分隔符跳过，因此 A=foo bar 读作 A=foo
+func parseEnvironment(value string) (map[string]string, error) {
+	tokens, err := lexEnvironment(value)
+	if err != nil {
+		return nil, err
+	}
+	res := make(map[string]string)
+	for i := 0; i < len(tokens); i += 4 {
+		if i+2 >= len(tokens) || tokens[i+1] != "=" {
+			return nil, errors.Errorf("unexpected end of key/value pairs in environment %q", value)
+		}
+		name := tokens[i]
+		if _, exists := res[name]; exists {
+			return nil, errors.Errorf("duplicate environment key %q", name)
+		}
+		res[name] = unescapePercent(strings.Trim(tokens[i+2], `'"`))
+	}
+	return res, nil
+}
+
+// lexEnvironment split value into tokens like Python's shlex.shlex in non-posix mode with supervisor's extra word chars
+// Quoted tokens keep their quotes and have no escapes, "#" starts a comment running to the end of the line
+// "%" is a word char too, since supervisor expands %(name)s expressions before lexing
+//
+// 按 Python 非 posix 模式的 shlex.shlex 并加上 supervisor 额外的单词字符切分 value
+// 带引号的单词保留引号且没有转义，"#" 开始一个持续到行尾的注释
+// "%" 也是单词字符，因为 supervisor 在切分之前展开 %(name)s 表达式
+func lexEnvironment(value string) ([]string, error) {
+	isWord := func(c byte) bool {
+		return (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || (c >= '0' && c <= '9') || strings.IndexByte("_/.+-():%", c) >= 0
+	}
+	skipComment := func(i int) int {
+		if end := strings.IndexByte(value[i:], '\n'); end >= 0 {
+			return i + end
+		}
+		return len(value)
+	}
+	tokens := make([]string, 0)
+	for i := 0; i < len(value); {
+		c := value[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\r' || c == '\n':
+			i++
+		case c == '#':
+			i = skipComment(i)
+		case c == '"' || c == '\'':
+			end := strings.IndexByte(value[i+1:], c)
+			if end < 0 {
+				return nil, errors.Errorf("no closing quotation in environment %q", value)
+			}
+			tokens = append(tokens, value[i:i+end+2])
+			i += end + 2
+		case isWord(c):
+			var token strings.Builder
+			for i < len(value) {
+				if value[i] == '#' {
+					// shlex drops the rest of the line and carries on with the same word
+					// shlex 丢弃该行剩余部分并继续同一个单词
+					i = skipComment(i) + 1
+				} else if isWord(value[i]) || value[i] == '"' || value[i] == '\'' {
+					token.WriteByte(value[i])
+					i++
+				} else {
+					break
+				}
+			}
+			tokens = append(tokens, token.String())
+		default:
+			_, size := utf8.DecodeRuneInString(value[i:])
+			tokens = append(tokens, value[i:i+size])
+			i += size
+		}
+	}
+	return tokens, nil
+}
@@ -0,0 +1,210 @@
+package supervisorkratos_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/orzkratos/supervisorkratos"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseConfig(t *testing.T) {
+	// Test parsing hand-written config with comments and continuation lines
+	// 测试解析带注释和续行的手写配置
+	const content = `; managed by hand
+[group:cluster]
+programs = api,
+    worker
+
+[program:api]
+user        = deploy
+directory   = /opt/api
+command     = /opt/api/bin/api ; inline comment
+environment = APP_ENV=production,
+    LABEL="a,b"
+autorestart = unexpected
+startsecs   = 5
+stdout_logfile = /var/log/cluster/api.log
+stdout_logfile_maxbytes = 100MB
+stderr_logfile_maxbytes = 100MB
+# hash comment
+[program:worker]
+user: deploy
+directory: /opt/worker
+command: /opt/worker/bin/worker
+stdout_logfile: /var/log/cluster/worker.log
+autostart = no
+exitcodes = 0,2
+`
+	res, err := supervisorkratos.ParseConfig(content)
+	require.NoError(t, err)
+	require.Len(t, res.Sections, 3)
+	require.Len(t, res.Programs, 2)
+	require.Len(t, res.Groups, 1)
+
+	api := res.Programs[0]
+	require.Equal(t, "api", api.Name)
+	require.Equal(t, "/opt/api", api.Root)
+	require.Equal(t, "deploy", api.UserName)
+	require.Equal(t, "/var/log/cluster", api.SlogRoot)
+	require.True(t, api.Environment.IsSet())
+	require.Equal(t, map[string]string{"APP_ENV": "production", "LABEL": "a,b"}, api.Environment.Get())
+	require.True(t, api.AutoRestart.IsSet())
+	require.Equal(t, "unexpected", api.AutoRestart.Get())
+	require.True(t, api.StartSecs.IsSet())
+	require.Equal(t, 5, api.StartSecs.Get())
+	require.True(t, api.LogMaxBytes.IsSet())
+	require.Equal(t, "100MB", api.LogMaxBytes.Get())
+	require.False(t, api.AutoStart.IsSet())
+	require.False(t, api.StartRetries.IsSet())
+	require.False(t, api.LogBackups.IsSet())
+
+	worker := res.Programs[1]
+	require.True(t, worker.AutoStart.IsSet())
+	require.False(t, worker.AutoStart.Get())
+	require.Equal(t, []int{0, 2}, worker.ExitCodes.Get())
+	require.False(t, worker.Environment.IsSet())
+
+	group := res.Groups[0]
+	require.Equal(t, "cluster", group.Name)
+	require.Equal(t, []*supervisorkratos.ProgramConfig{api, worker}, group.Programs)
+}
+
+func TestParseConfigRoundTrip(t *testing.T) {
+	// Test generate→parse→generate gives identical text
+	// 测试 生成→解析→生成 得到相同的文本
+	gateway := supervisorkratos.NewProgramConfig(
+		"api-gateway",
+		"/opt/gateway",
+		"deploy",
+		"/var/log/cluster",
+	).WithPriority(1).
+		WithNumProcs(2).
+		WithProcessName("%(program_name)s-%(process_num)02d").
+		WithEnvironment(map[string]string{
+			"SERVICE_TYPE": "gateway",
+		})
+
+	userService := supervisorkratos.NewProgramConfig(
+		"user-service",
+		"/opt/user-service",
+		"deploy",
+		"/var/log/cluster",
+	).WithStartRetries(5).
+		WithStopWaitSecs(30).
+		WithStopSignal("INT").
+		WithKillAsGroup(true).
+		WithExitCodes([]int{0, 1, 2})
+
+	orderService := supervisorkratos.NewProgramConfig(
+		"order-service",
+		"/opt/order-service",
+		"deploy",
+		"/var/log/cluster",
+	).WithAutoRestart(false).
+		WithLogMaxBytes("200MB").
+		WithLogBackups(5).
+		WithRedirectStderr(true)
+
+	cluster := supervisorkratos.NewGroupConfig("microservice-cluster").
+		AddProgram(gateway).
+		AddProgram(userService).
+		AddProgram(orderService)
+
+	content := supervisorkratos.GenerateGroupConfig(cluster)
+
+	res, err := supervisorkratos.ParseConfig(content)
+	require.NoError(t, err)
+	require.Len(t, res.Groups, 1)
+	require.Equal(t, content, supervisorkratos.GenerateGroupConfig(res.Groups[0]))
+
+	for idx, program := range cluster.Programs {
+		require.Equal(t, supervisorkratos.GenerateProgramConfig(program), supervisorkratos.GenerateProgramConfig(res.Programs[idx]))
+	}
+}
+
+func TestParseConfigFile(t *testing.T) {
+	// Test parsing config from file
+	// 测试从文件解析配置
+	program := supervisorkratos.NewProgramConfig(
+		"myapp",
+		"/opt/myapp",
+		"deploy",
+		"/var/log/myapp",
+	).WithStartRetries(10)
+
+	path := filepath.Join(t.TempDir(), "myapp.conf")
+	require.NoError(t, os.WriteFile(path, []byte(supervisorkratos.GenerateProgramConfig(program)), 0644))
+
+	res, err := supervisorkratos.ParseConfigFile(path)
+	require.NoError(t, err)
+	require.Len(t, res.Programs, 1)
+	require.Equal(t, 10, res.Programs[0].StartRetries.Get())
+}
+
+func TestParseConfigErrors(t *testing.T) {
+	// Test parse errors are *ParseError values with the line, and text supervisor accepts but configs can't hold is ErrUnsupported
+	// 测试解析错误是带有行号的 *ParseError，supervisor 接受但配置无法表示的文本为 ErrUnsupported
+	const head = "[program:a]\nuser=u\ndirectory=/opt/a\ncommand=/opt/a/bin/a\nstdout_logfile=/var/log/a.log\n"
+	testCases := map[string]struct {
+		content string
+		kind    error
+		line    int
+	}{
+		"missing user":       {"[program:a]\ndirectory=/opt/a\ncommand=/opt/a/bin/a\nstdout_logfile=/var/log/a.log\n", supervisorkratos.ErrUnsupported, 1},
+		"missing command":    {"[program:a]\nuser=u\ndirectory=/opt/a\nstdout_logfile=/var/log/a.log\n", supervisorkratos.ErrRequired, 1},
+		"unknown key":        {head + "foo=bar\n", supervisorkratos.ErrUnsupported, 6},
+		"unpaired maxbytes":  {head + "stdout_logfile_maxbytes=1MB\n", supervisorkratos.ErrUnsupported, 6},
+		"raw log path":       {"[program:a]\nuser=u\ndirectory=/opt/a\ncommand=/opt/a/bin/a\nstdout_logfile=/var/log/app.log\n", supervisorkratos.ErrUnsupported, 5},
+		"group priority":     {head + "[group:g]\nprograms=a\npriority=1\n", supervisorkratos.ErrUnsupported, 8},
+		"bad integer":        {head + "startsecs=x\n", supervisorkratos.ErrInvalidValue, 6},
+		"unclosed quote":     {head + "environment=A=\"x\n", supervisorkratos.ErrInvalidValue, 6},
+		"word between pairs": {head + "environment=A=foo bar,B=x\n", supervisorkratos.ErrInvalidValue, 6},
+		"undefined program":  {"[group:g]\nprograms=a\n", supervisorkratos.ErrInvalidValue, 2},
+		"key before section": {"user=u\n", supervisorkratos.ErrInvalidValue, 1},
+		"bad header":         {"[program:a\n", supervisorkratos.ErrInvalidValue, 1},
+	}
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			_, err := supervisorkratos.ParseConfig(tc.content)
+			t.Log(err)
+			require.ErrorIs(t, err, tc.kind)
+			var parseErr *supervisorkratos.ParseError
+			require.ErrorAs(t, err, &parseErr)
+			require.Equal(t, tc.line, parseErr.Line)
+		})
+	}
+}
+
+func TestParseConfigLikeSupervisor(t *testing.T) {
+	// Test inline comments and environment values are read the way supervisor reads them
+	// 测试行内注释和环境变量值按 supervisor 的方式读取
+	const content = `[program:api]
+user        = deploy # hash comment
+directory   = /opt/api
+command     = /opt/api/bin/api -color #fff
+stdout_logfile = /var/log/cluster/api.log
+environment = B='say "hi" now',C=%(ENV_HOME)s/api,
+    D="x y",A=foo bar
+`
+	res, err := supervisorkratos.ParseConfig(content)
+	require.NoError(t, err)
+	api := res.Programs[0]
+	require.Equal(t, "deploy", api.UserName)
+	require.Equal(t, []string{"-color"}, api.Args.Get())
+	require.Equal(t, map[string]string{"A": "foo", "B": `say "hi" now`, "C": "%(ENV_HOME)s/api", "D": "x y"}, api.Environment.Get())
+}
+
+func TestParseIniMerge(t *testing.T) {
+	// Test repeated sections merge and repeated keys take the last value, the way supervisor reads them
+	// 测试重复的段会合并，重复的键取最后的值，与 supervisor 的读取方式一致
+	sections, err := supervisorkratos.ParseIni("[program:a]\nuser=u\ncommand=/bin/a\n[group:g]\nprograms=a\n[program:a]\nuser=root\ndirectory=/opt/a\n")
+	require.NoError(t, err)
+	require.Len(t, sections, 2)
+	require.Equal(t, "program:a", sections[0].Name)
+	require.Equal(t, 1, sections[0].Line)
+	require.Equal(t, []string{"user", "command", "directory"}, sections[0].Keys)
+	require.Equal(t, map[string]string{"user": "root", "command": "/bin/a", "directory": "/opt/a"}, sections[0].Values)
+	require.Equal(t, 7, sections[0].Lines["user"])
+}
@@ -0,0 +1,243 @@
+package supervisorkratos
+
+import (
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+)
+
+// PortAllocation HTTP and gRPC listen ports of NumProcs instances, instance num listens on base + num*Stride
+// The addresses reach each instance as environment variables, so a Kratos config can read them with ${KRATOS_HTTP_ADDR}
+//
+// NumProcs 个实例的 HTTP 和 gRPC 监听端口，第 num 个实例监听 base + num*Stride
+// 地址以环境变量的形式传给每个实例，因此 Kratos 配置可以使用 ${KRATOS_HTTP_ADDR} 读取
+type PortAllocation struct {
+	HTTPBase int    // HTTP port of instance 0, 0 means no HTTP port // 第 0 个实例的 HTTP 端口，0 表示没有 HTTP 端口
+	GRPCBase int    // gRPC port of instance 0, 0 means no gRPC port // 第 0 个实例的 gRPC 端口，0 表示没有 gRPC 端口
+	Stride   int    // Port step between instances // 实例之间的端口步长
+	Host     string // Listen host // 监听主机
+	HTTPEnv  string // Environment variable of the HTTP address // HTTP 地址的环境变量
+	GRPCEnv  string // Environment variable of the gRPC address // gRPC 地址的环境变量
+}
+
+// NewPortAllocation create new PortAllocation listening on all interfaces with stride 1, pass 0 to skip HTTP or gRPC
+// 创建新的 PortAllocation，监听所有网卡，步长为 1，传入 0 表示不分配 HTTP 或 gRPC 端口
+func NewPortAllocation(httpBase int, grpcBase int) *PortAllocation {
+	return &PortAllocation{
+		HTTPBase: httpBase,
+		GRPCBase: grpcBase,
+		Stride:   1,
+		Host:     "0.0.0.0",
+		HTTPEnv:  "KRATOS_HTTP_ADDR",
+		GRPCEnv:  "KRATOS_GRPC_ADDR",
+	}
+}
+
+// WithStride set port step between instances
+// 设置实例之间的端口步长
+func (a *PortAllocation) WithStride(stride int) *PortAllocation {
+	a.Stride = stride
+	return a
+}
+
+// WithHost set listen host
+// 设置监听主机
+func (a *PortAllocation) WithHost(host string) *PortAllocation {
+	a.Host = host
+	return a
+}
+
+// WithEnv set environment variable names of the HTTP and gRPC addresses
+// 设置 HTTP 和 gRPC 地址的环境变量名称
+func (a *PortAllocation) WithEnv(httpEnv string, grpcEnv string) *PortAllocation {
+	a.HTTPEnv = httpEnv
+	a.GRPCEnv = grpcEnv
+	return a
+}
+
+// HTTPPort HTTP port of instance num, 0 when no HTTP port is allocated
+// 第 num 个实例的 HTTP 端口，未分配 HTTP 端口时为 0
+func (a *PortAllocation) HTTPPort(num int) int {
+	return allocatedPort(a.HTTPBase, a.Stride, num)
+}
+
+// GRPCPort gRPC port of instance num, 0 when no gRPC port is allocated
+// 第 num 个实例的 gRPC 端口，未分配 gRPC 端口时为 0
+func (a *PortAllocation) GRPCPort(num int) int {
+	return allocatedPort(a.GRPCBase, a.Stride, num)
+}
+
+func allocatedPort(base int, stride int, num int) int {
+	if base == 0 {
+		return 0
+	}
+	return base + num*stride
+}
+
+// Ports all ports allocated to numProcs instances
+// numProcs 个实例分配到的全部端口
+func (a *PortAllocation) Ports(numProcs int) []int {
+	var res []int
+	for num := range numProcs {
+		for _, port := range []int{a.HTTPPort(num), a.GRPCPort(num)} {
+			if port != 0 {
+				res = append(res, port)
+			}
+		}
+	}
+	return res
+}
+
+func (a *PortAllocation) validateFields(v *validator, section string, numProcs int) {
+	if a.HTTPBase == 0 && a.GRPCBase == 0 {
+		v.add(section, "Ports", nil, ErrRequired, "neither HTTP nor gRPC base port is set")
+	}
+	checkMinInt(v, section, "Ports.Stride", a.Stride, 1)
+	for _, item := range []struct {
+		field string
+		base  int
+		env   string
+	}{
+		{"Ports.HTTPBase", a.HTTPBase, a.HTTPEnv},
+		{"Ports.GRPCBase", a.GRPCBase, a.GRPCEnv},
+	} {
+		if item.base == 0 {
+			continue
+		}
+		if last := allocatedPort(item.base, max(a.Stride, 1), numProcs-1); item.base < 1 || last > 65535 {
+			v.add(section, item.field, item.base, ErrOutOfRange, "ports %d-%d are not within 1-65535", item.base, last)
+		}
+		if !envNameRegexp.MatchString(item.env) {
+			v.add(section, item.field, item.env, ErrInvalidValue, "invalid variable name %q of the address", item.env)
+		}
+	}
+	if a.HTTPBase != 0 && a.GRPCBase != 0 && a.HTTPEnv == a.GRPCEnv {
+		v.add(section, "Ports.GRPCEnv", a.GRPCEnv, ErrDuplicate, "HTTP and gRPC addresses share variable %q", a.GRPCEnv)
+	}
+	if strings.ContainsAny(a.Host, " \t\n\r,\"'") {
+		v.add(section, "Ports.Host", a.Host, ErrInvalidValue, "host must not contain blanks, quotes or \",\"")
+	}
+	seen := make(map[int]bool)
+	for _, port := range a.Ports(numProcs) {
+		if seen[port] {
+			v.add(section, "Ports", port, ErrDuplicate, "HTTP and gRPC ports overlap at %d", port)
+			break
+		}
+		seen[port] = true
+	}
+}
+
+// checkPortCollisions report ports allocated to more than one program of the group
+// 报告组内被多个程序分配的端口
+func (g *GroupConfig) checkPortCollisions(v *validator) {
+	owners := make(map[int]string)
+	for _, program := range g.Programs {
+		if program == nil || program.Ports == nil || program.NumProcs == nil {
+			continue
+		}
+		for _, port := range program.Ports.Ports(program.NumProcs.Get()) {
+			if owner, ok := owners[port]; ok && owner != program.Name {
+				v.add("group:"+g.Name, "Ports", port, ErrDuplicate, "port %d is allocated to both %s and %s", port, owner, program.Name)
+				break
+			}
+			owners[port] = program.Name
+		}
+	}
+}
+
+// portTemplate render base + process_num*stride with supervisor expressions, which have no arithmetic
+// It works when the port is some leading digits, the zero padded process_num and the trailing zeros of a power of 10 stride
+// e.g. base 8000, stride 1 and 12 instances give "80%(process_num)02d"
+//
+// 使用 supervisor 表达式渲染 base + process_num*stride，表达式不支持算术
+// 只有当端口由前导数字、补零的 process_num 和 10 的幂步长的尾部零组成时才可行
+// 例如 base 8000、步长 1 和 12 个实例得到 "80%(process_num)02d"
+func portTemplate(base int, stride int, numProcs int) (string, bool) {
+	if numProcs <= 1 {
+		return strconv.Itoa(base), true
+	}
+	if stride < 1 {
+		return "", false
+	}
+	zeros := 0
+	for step := stride; step%10 == 0; step /= 10 {
+		zeros++
+	}
+	if stride != pow10(zeros) {
+		return "", false
+	}
+	width := len(strconv.Itoa(numProcs - 1))
+	unit := pow10(width + zeros)
+	if base%unit != 0 || base/unit == 0 {
+		return "", false
+	}
+	return fmt.Sprintf("%d%%(process_num)0%dd%s", base/unit, width, strings.Repeat("0", zeros)), true
+}
+
+func pow10(n int) int {
+	res := 1
+	for range n {
+		res *= 10
+	}
+	return res
+}
+
+// portEnvironment environment of the allocated addresses, num < 0 renders %(process_num) templates
+// 分配地址的环境变量，num < 0 时渲染 %(process_num) 模板
+func (a *PortAllocation) portEnvironment(numProcs int, num int) (map[string]string, bool) {
+	res := make(map[string]string, 2)
+	for _, item := range []struct {
+		base int
+		env  string
+	}{
+		{a.HTTPBase, a.HTTPEnv},
+		{a.GRPCBase, a.GRPCEnv},
+	} {
+		if item.base == 0 {
+			continue
+		}
+		port := strconv.Itoa(allocatedPort(item.base, a.Stride, num))
+		if num < 0 {
+			template, ok := portTemplate(item.base, a.Stride, numProcs)
+			if !ok {
+				return nil, false
+			}
+			port = template
+		}
+		res[item.env] = net.JoinHostPort(a.Host, port)
+	}
+	return res, true
+}
+
+// portSections program sections carrying the allocated ports of program in group groupName
+// A single section with %(process_num) templates when the ports can be written that way, otherwise instanceSections
+//
+// 携带 groupName 组中 program 分配端口的程序段
+// 端口能写成 %(process_num) 模板时为单个段，否则使用 instanceSections
+func (p *ProgramConfig) portSections(groupName string) []*ProgramConfig {
+	if p.Ports == nil {
+		return []*ProgramConfig{p}
+	}
+	numProcs := p.NumProcs.Get()
+	if environment, ok := p.Ports.portEnvironment(numProcs, -1); ok {
+		res := p.Clone()
+		res.Environment.Set(mergeEnvironment(p.Environment.Get(), environment))
+		return []*ProgramConfig{res}
+	}
+
+	return p.instanceSections(groupName)
+}
+
+// mergeEnvironment copy environment with the allocated addresses, which take precedence
+// 复制环境变量并加入分配的地址，分配的地址优先
+func mergeEnvironment(environment map[string]string, addresses map[string]string) map[string]string {
+	res := make(map[string]string, len(environment)+len(addresses))
+	for key, value := range environment {
+		res[key] = value
+	}
+	for key, value := range addresses {
+		res[key] = value
+	}
+	return res
+}
@@ -0,0 +1,84 @@
+package supervisorkratos_test
+
+import (
+	"testing"
+
+	"github.com/orzkratos/supervisorkratos"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPortsTemplate(t *testing.T) {
+	// Test ports that fit supervisor expressions render into one section
+	// 测试能用 supervisor 表达式表示的端口渲染为单个段
+	program := supervisorkratos.NewProgramConfig("api", "/opt/api", "deploy", "/var/log/services").
+		WithNumProcs(12).
+		WithProcessName("%(program_name)s_%(process_num)02d").
+		WithEnvironment(map[string]string{"APP_ENV": "prod"}).
+		WithPorts(supervisorkratos.NewPortAllocation(8000, 9000))
+
+	config := supervisorkratos.GenerateProgramConfig(program)
+	t.Log(config)
+	require.Contains(t, config, "[program:api]")
+	require.Contains(t, config, "environment     = APP_ENV=prod,KRATOS_GRPC_ADDR=\"0.0.0.0:90%(process_num)02d\",KRATOS_HTTP_ADDR=\"0.0.0.0:80%(process_num)02d\"")
+	require.NotContains(t, config, "[group:")
+	require.Equal(t, map[string]string{"APP_ENV": "prod"}, program.Environment.Get())
+
+	// Stride 10 keeps a trailing zero
+	// 步长 10 保留尾部的零
+	program.WithNumProcs(4).WithPorts(supervisorkratos.NewPortAllocation(8000, 0).WithStride(10))
+	require.Contains(t, supervisorkratos.GenerateProgramConfig(program), `KRATOS_HTTP_ADDR="0.0.0.0:80%(process_num)01d0"`)
+	require.Equal(t, []int{8000, 8010, 8020, 8030}, program.Ports.Ports(4))
+}
+
+func TestPortsSplitSections(t *testing.T) {
+	// Test ports without an expression form render one section per instance with the same process names
+	// 测试无法用表达式表示的端口按实例渲染为多个段，进程名称保持不变
+	program := supervisorkratos.NewProgramConfig("api", "/opt/api", "deploy", "/var/log/services").
+		WithNumProcs(2).
+		WithProcessName("%(program_name)s_%(process_num)d").
+		WithArgs("-id", "%(process_num)d").
+		WithPorts(supervisorkratos.NewPortAllocation(8001, 9001))
+
+	config := supervisorkratos.GenerateProgramConfig(program)
+	t.Log(config)
+	require.Contains(t, config, "[group:api]\nprograms=api_0,api_1")
+	require.Contains(t, config, "[program:api_1]")
+	require.Contains(t, config, "command         = /opt/api/bin/api -id 1")
+	require.Contains(t, config, "environment     = KRATOS_GRPC_ADDR=0.0.0.0:9002,KRATOS_HTTP_ADDR=0.0.0.0:8002")
+	require.NotContains(t, config, "numprocs")
+
+	sections, err := supervisorkratos.ParseIni(config)
+	require.NoError(t, err)
+	require.Len(t, sections, 3)
+	require.Equal(t, []string{"api:api_0", "api:api_1"}, program.ProcessNames(""))
+}
+
+func TestPortsValidate(t *testing.T) {
+	// Test port ranges, overlaps and collisions across programs of a group
+	// 测试端口范围、重叠以及组内程序之间的冲突
+	newProgram := func(name string, ports *supervisorkratos.PortAllocation) *supervisorkratos.ProgramConfig {
+		return supervisorkratos.NewProgramConfig(name, "/opt/"+name, "deploy", "/var/log/services").
+			WithNumProcs(4).
+			WithProcessName("%(program_name)s_%(process_num)d").
+			WithPorts(ports)
+	}
+	require.NoError(t, newProgram("api", supervisorkratos.NewPortAllocation(8000, 9000)).Validate())
+	require.ErrorIs(t, newProgram("api", supervisorkratos.NewPortAllocation(65534, 0)).Validate(), supervisorkratos.ErrOutOfRange)
+	require.ErrorIs(t, newProgram("api", supervisorkratos.NewPortAllocation(8000, 8002)).Validate(), supervisorkratos.ErrDuplicate)
+	require.ErrorIs(t, newProgram("api", supervisorkratos.NewPortAllocation(0, 0)).Validate(), supervisorkratos.ErrRequired)
+
+	group := supervisorkratos.NewGroupConfig("services").
+		AddProgram(newProgram("api", supervisorkratos.NewPortAllocation(8000, 9000))).
+		AddProgram(newProgram("admin", supervisorkratos.NewPortAllocation(8003, 0)))
+	err := group.Validate()
+	require.ErrorIs(t, err, supervisorkratos.ErrDuplicate)
+	require.ErrorContains(t, err, "port 8003 is allocated to both api and admin")
+
+	// Health checks use the allocated ports
+	// 健康检查使用分配的端口
+	program := newProgram("api", supervisorkratos.NewPortAllocation(8000, 9000).WithHost("::")).
+		WithHealthCheck(supervisorkratos.NewGRPCHealthCheck("localhost:1", ""))
+	listener, err := program.WatchdogListener("", "/opt/watchdog/bin/watchdog")
+	require.NoError(t, err)
+	require.Contains(t, listener.Args.Get(), "api:api_3=[::1]:9003")
+}
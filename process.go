@@ -0,0 +1,164 @@
+package supervisorkratos
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// ProcessNames supervisor process names of the program instances, "group:name" as used by XML-RPC process methods
+// groupName is the [group:x] name, empty for a standalone program whose process group is named after the program
+//
+// 程序各实例的 supervisor 进程名称，即 XML-RPC 进程方法使用的 "group:name"
+// groupName 是 [group:x] 的名称，独立程序为空，此时进程组以程序名称命名
+func (p *ProgramConfig) ProcessNames(groupName string) []string {
+	if groupName == "" {
+		groupName = p.Name
+	}
+	numProcs := p.NumProcs.Get()
+	names := make([]string, 0, numProcs)
+	for num := range numProcs {
+		names = append(names, groupName+":"+p.processName(groupName, num))
+	}
+	return names
+}
+
+// ProcessNames map each program, event listener and fcgi program name to its "group:name" process names
+// Event listeners and fcgi programs are process groups of their own
+//
+// 将每个程序、事件监听器和 fcgi 程序的名称映射到其 "group:name" 进程名称
+// 事件监听器和 fcgi 程序各自是独立的进程组
+func (g *GroupConfig) ProcessNames() map[string][]string {
+	res := make(map[string][]string, len(g.Programs)+len(g.EventListeners)+len(g.FcgiPrograms))
+	for _, program := range g.Programs {
+		res[program.Name] = program.ProcessNames(g.Name)
+	}
+	for _, listener := range g.EventListeners {
+		res[listener.Name] = listener.ProcessNames("")
+	}
+	for _, program := range g.FcgiPrograms {
+		res[program.Name] = program.ProcessNames("")
+	}
+	return res
+}
+
+// processName expand process_name of instance num, the way supervisor does
+// process_name is written for supervisor as is, so "%%" in it is a literal "%"
+//
+// 按 supervisor 的方式展开第 num 个实例的 process_name
+// process_name 原样写给 supervisor，因此其中的 "%%" 表示字面量 "%"
+func (p *ProgramConfig) processName(groupName string, num int) string {
+	vars := p.instanceVars(groupName, num)
+	parts := strings.Split(p.ProcessName.Get(), "%%")
+	for idx, part := range parts {
+		parts[idx] = expandExpressions(part, vars)
+	}
+	return strings.Join(parts, "%")
+}
+
+// instanceVars expansion vars of instance num, the ones supervisor provides to process_name
+// An empty groupName is a program of its own, which supervisor puts in a group of its name
+// host_node_name is left out, configs are often generated on another machine, so %(host_node_name)s is kept for the target to expand
+//
+// 第 num 个实例的展开变量，即 supervisor 提供给 process_name 的变量
+// groupName 为空表示独立的程序，supervisor 会将其放入以其名称命名的组
+// 不包含 host_node_name，配置常在其他机器上生成，因此保留 %(host_node_name)s 由目标机器展开
+func (p *ProgramConfig) instanceVars(groupName string, num int) map[string]string {
+	if groupName == "" {
+		groupName = p.Name
+	}
+	return map[string]string{
+		"program_name": p.Name,
+		"process_num":  strconv.Itoa(num),
+		"group_name":   groupName,
+		"numprocs":     strconv.Itoa(p.NumProcs.Get()),
+	}
+}
+
+// instanceSections one section per instance of program in group groupName, named by its process name so "group:name" stays the same
+// Expressions in the command, directory and environment are expanded with the instance values, allocated ports become literal
+// Each section writes its own <SlogRoot>/<process name>.log
+//
+// groupName 组中 program 的每个实例一个段，以进程名称命名，使 "group:name" 保持不变
+// 命令、目录和环境变量中的表达式按实例的值展开，分配的端口变为字面值
+// 每个段写入各自的 <SlogRoot>/<进程名称>.log
+func (p *ProgramConfig) instanceSections(groupName string) []*ProgramConfig {
+	numProcs := p.NumProcs.Get()
+	res := make([]*ProgramConfig, 0, numProcs)
+	for num := range numProcs {
+		vars := p.instanceVars(groupName, num)
+		environment := make(map[string]string, len(p.Environment.Get())+2)
+		if p.Ports != nil {
+			environment, _ = p.Ports.portEnvironment(numProcs, num)
+		}
+		for key, value := range p.Environment.Get() {
+			if _, ok := environment[key]; !ok {
+				environment[key] = expandExpressions(value, vars)
+			}
+		}
+
+		instance := p.Clone()
+		instance.Name = p.processName(groupName, num)
+		instance.Root = expandExpressions(p.Root, vars)
+		if !instance.BinName.IsSet() {
+			instance.BinName.Set(p.Name) // Binary keeps the program name // 二进制文件保持程序名称
+		}
+		instance.NumProcs = NewOpt(1)
+		instance.ProcessName = NewOpt("%(program_name)s")
+		if len(environment) > 0 {
+			instance.Environment.Set(environment)
+		}
+		if instance.Executable.IsSet() {
+			instance.Executable.Set(expandExpressions(instance.Executable.Get(), vars))
+		}
+		for _, option := range []*Opt[[]string]{instance.Args, instance.Wrapper} {
+			if option.IsSet() {
+				for idx, arg := range option.Value {
+					option.Value[idx] = expandExpressions(arg, vars)
+				}
+			}
+		}
+		res = append(res, instance)
+	}
+	return res
+}
+
+// expandExpressions expand %(name)<flags><conv> expressions with vars, unknown names are kept as written
+// Integer conversions format the value as a number, so %(process_num)02d gives "01"
+// Other "%" are literal, like everywhere user values are rendered, so "%%" stays "%%"
+//
+// 使用 vars 展开 %(name)<flags><conv> 表达式，未知名称保持原样
+// 整数转换按数字格式化，因此 %(process_num)02d 得到 "01"
+// 其他 "%" 与渲染用户值的其他地方一样按字面处理，因此 "%%" 仍为 "%%"
+func expandExpressions(value string, vars map[string]string) string {
+	var res strings.Builder
+	for i := 0; i < len(value); i++ {
+		if value[i] != '%' {
+			res.WriteByte(value[i])
+			continue
+		}
+		name, size, ok := scanExpansion(value[i:])
+		varValue, has := vars[name]
+		if !ok || !has {
+			res.WriteByte(value[i])
+			continue
+		}
+		spec := value[i+len(name)+3 : i+size] // Flags and conversion after ")" // ")" 之后的标志和转换符
+		flags, conv := spec[:len(spec)-1], spec[len(spec)-1]
+		switch conv {
+		case 'd', 'i', 'x', 'X', 'o':
+			if num, err := strconv.Atoi(varValue); err == nil {
+				if conv == 'i' {
+					conv = 'd'
+				}
+				res.WriteString(fmt.Sprintf("%"+flags+string(conv), num))
+				break
+			}
+			res.WriteString(varValue)
+		default:
+			res.WriteString(fmt.Sprintf("%"+flags+"s", varValue))
+		}
+		i += size - 1
+	}
+	return res.String()
+}
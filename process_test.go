@@ -0,0 +1,56 @@
+package supervisorkratos_test
+
+import (
+	"testing"
+
+	"github.com/orzkratos/supervisorkratos"
+	"github.com/stretchr/testify/require"
+)
+
+func TestProcessNames(t *testing.T) {
+	// Test process names match the "group:name" names supervisor reports
+	// 测试进程名称与 supervisor 报告的 "group:name" 名称一致
+	web := supervisorkratos.NewProgramConfig("web", "/opt/web", "deploy", "/var/log/services").
+		WithNumProcs(3).
+		WithProcessName("%(program_name)s_%(process_num)02d")
+	api := supervisorkratos.NewProgramConfig("api", "/opt/api", "deploy", "/var/log/services")
+	listener := supervisorkratos.NewEventListenerConfig("memmon", "/opt/memmon", "deploy", "/var/log/services", supervisorkratos.EventTick60)
+
+	require.Equal(t, []string{"web:web_00", "web:web_01", "web:web_02"}, web.ProcessNames(""))
+	require.Equal(t, []string{"api:api"}, api.ProcessNames(""))
+
+	group := supervisorkratos.NewGroupConfig("services").AddProgram(web).AddProgram(api).AddEventListener(listener)
+	require.Equal(t, map[string][]string{
+		"web":    {"services:web_00", "services:web_01", "services:web_02"},
+		"api":    {"services:api"},
+		"memmon": {"memmon:memmon"},
+	}, group.ProcessNames())
+
+	web.WithProcessName("%(group_name)s-%(program_name)s-%(process_num)d-of-%(numprocs)d-100%%")
+	require.Equal(t, "services:services-web-2-of-3-100%", web.ProcessNames("services")[2])
+}
+
+func TestInstancesKeepPercent(t *testing.T) {
+	// Test a literal "%%" renders the same whether instances are expanded or not
+	// 测试无论实例是否展开，字面量 "%%" 的渲染结果都相同
+	newGroup := func(expand bool) *supervisorkratos.GroupConfig {
+		return supervisorkratos.NewGroupConfig("services").WithExpandNumProcs(expand).
+			AddProgram(supervisorkratos.NewProgramConfig("api", "/opt/api", "deploy", "/var/log/services").
+				WithNumProcs(2).
+				WithProcessName("%(program_name)s_%(process_num)d").
+				WithEnvironment(map[string]string{"RATIO": "100%%", "LABEL": "%%(program_name)s"}))
+	}
+
+	// supervisor reads both as "%api" and "100%%"
+	// supervisor 将两者都读作 "%api" 和 "100%%"
+	config := supervisorkratos.GenerateGroupConfig(newGroup(false))
+	require.Contains(t, config, `LABEL="%%%(program_name)s",RATIO="100%%%%"`)
+	config = supervisorkratos.GenerateGroupConfig(newGroup(true))
+	require.Contains(t, config, `LABEL="%%api",RATIO="100%%%%"`)
+
+	for _, expand := range []bool{false, true} {
+		compose := supervisorkratos.GenerateComposeFile(supervisorkratos.NewComposeConfig(newGroup(expand), "example/api:dev"))
+		require.Contains(t, compose, "LABEL: '%api'", expand)
+		require.Contains(t, compose, "RATIO: 100%%", expand)
+	}
+}
@@ -0,0 +1,464 @@
+package supervisorkratos
+
+import (
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/yyle88/must"
+	"github.com/yyle88/printgo"
+)
+
+// ProcfileFiles Procfile rendering of a group for foreman and honcho, the files go next to each other in the working DIR
+// ProcfileFiles 组的 Procfile 渲染结果，供 foreman 和 honcho 使用，这些文件放在同一个工作目录中
+type ProcfileFiles struct {
+	Procfile  string // Procfile, one "name: command" line per process type // Procfile，每个进程类型一行 "name: command"
+	Env       string // .env with the environment every process type shares // 所有进程类型共享的环境变量组成的 .env
+	Formation string // Process counts like "api=3,worker=1", for honcho -c and foreman -m // 进程数量，例如 "api=3,worker=1"，用于 honcho -c 和 foreman -m
+}
+
+// procfileNameRegexp process type names foreman and honcho accept
+// foreman 和 honcho 接受的进程类型名称
+var procfileNameRegexp = regexp.MustCompile(`^[A-Za-z0-9_-]+$`)
+
+// procfileLineRegexp a "name: command" line of a Procfile
+// Procfile 中的 "name: command" 行
+var procfileLineRegexp = regexp.MustCompile(`^([A-Za-z0-9_-]+):\s*(.+)$`)
+
+// shellVariableRegexp a $X or ${X} shell variable
+// shell 变量 $X 或 ${X}
+var shellVariableRegexp = regexp.MustCompile(`^\$(?:\{([A-Za-z_][A-Za-z0-9_]*)\}|([A-Za-z_][A-Za-z0-9_]*))`)
+
+// GenerateProcfile generate Procfile, .env and formation of the group, panics on invalid config
+// 生成组的 Procfile、.env 和进程数量，配置无效时 panic
+func GenerateProcfile(group *GroupConfig) *ProcfileFiles {
+	return must.V1(GenerateProcfileE(group))
+}
+
+// GenerateProcfileE generate Procfile, .env and formation of the group
+// Each program becomes "name: cd <Root> && [KEY=value ...] <command>", run by the shell of foreman or honcho
+// NumProcs becomes the formation count, unless instances differ by ports, %(process_num) expressions or ExpandNumProcs,
+// then each instance becomes a process type named by its process name, AutoStart false gives a count of 0
+// Environment keys every process type sets to the same value go into .env, the others stay inline in the command
+// %(ENV_X)s becomes "${X}" read from the shell running the Procfile, %(host_node_name)s becomes "$(hostname)" and %(here)s is reported as an error
+// Not mapped: UserName, AutoRestart, StartRetries, StartSecs, StopSignal, StopWaitSecs, ExitCodes, Priority, log files and HealthCheck
+//
+// 生成组的 Procfile、.env 和进程数量
+// 每个程序成为 "name: cd <Root> && [KEY=value ...] <命令>"，由 foreman 或 honcho 的 shell 运行
+// NumProcs 成为进程数量，除非实例因端口、%(process_num) 表达式或 ExpandNumProcs 而不同，
+// 此时每个实例成为以其进程名称命名的进程类型，AutoStart 为 false 时数量为 0
+// 所有进程类型都设置为相同值的环境变量写入 .env，其余的内联在命令中
+// %(ENV_X)s 变为从运行 Procfile 的 shell 读取的 "${X}"，%(host_node_name)s 变为 "$(hostname)"，%(here)s 会作为错误报告
+// 不映射：UserName、AutoRestart、StartRetries、StartSecs、StopSignal、StopWaitSecs、ExitCodes、Priority、日志文件和 HealthCheck
+func GenerateProcfileE(group *GroupConfig) (*ProcfileFiles, error) {
+	if group == nil {
+		return nil, errors.New("group is required")
+	}
+	if err := group.Validate(); err != nil {
+		return nil, err
+	}
+	v := &validator{}
+	section := "group:" + group.Name
+	if len(group.EventListeners) > 0 {
+		v.add(section, "EventListeners", len(group.EventListeners), ErrInvalidValue, "event listeners have no Procfile equivalent")
+	}
+	if len(group.FcgiPrograms) > 0 {
+		v.add(section, "FcgiPrograms", len(group.FcgiPrograms), ErrInvalidValue, "FastCGI programs have no Procfile equivalent")
+	}
+
+	var entries []*procfileEntry
+	for _, program := range group.Programs {
+		instances := program.portSections(group.Name)
+		count := program.NumProcs.Get()
+		if count > 1 && (group.ExpandNumProcs || program.Ports != nil || program.usesProcessNum()) {
+			instances = program.instanceSections(group.Name)
+			count = 1
+		}
+		if !program.AutoStart.Get() {
+			count = 0
+		}
+		for _, instance := range instances {
+			if !procfileNameRegexp.MatchString(instance.Name) {
+				v.add("program:"+program.Name, "Name", instance.Name, ErrInvalidValue, "process type names are letters, digits, \"_\" and \"-\"")
+				continue
+			}
+			if slices.ContainsFunc(entries, func(entry *procfileEntry) bool { return entry.name == instance.Name }) {
+				v.add("program:"+program.Name, "Name", instance.Name, ErrDuplicate, "process type %q is written twice", instance.Name)
+				continue
+			}
+			entries = append(entries, instance.procfileEntry(v, group.Name, count))
+		}
+	}
+	if err := v.result(); err != nil {
+		return nil, err
+	}
+
+	shared := sharedProcfileEnvironment(entries)
+	procfile := printgo.NewPTX()
+	formation := make([]string, 0, len(entries))
+	for _, entry := range entries {
+		words := []string{"cd", entry.root, "&&"}
+		for _, key := range sortedKeys(entry.environment) {
+			if _, ok := shared[key]; !ok {
+				words = append(words, key+"="+entry.environment[key].word)
+			}
+		}
+		words = append(words, entry.command...)
+		procfile.Println(entry.name + ": " + strings.Join(words, " "))
+		formation = append(formation, entry.name+"="+strconv.Itoa(entry.count))
+	}
+	env := printgo.NewPTX()
+	for _, key := range sortedKeys(shared) {
+		env.Println(key + "=" + quoteDotEnvValue(shared[key]))
+	}
+	return &ProcfileFiles{
+		Procfile:  procfile.String(),
+		Env:       env.String(),
+		Formation: strings.Join(formation, ","),
+	}, nil
+}
+
+// procfileEntry a process type of the Procfile, with its words already shell quoted
+// Procfile 中的进程类型，其中的单词已按 shell 规则加引号
+type procfileEntry struct {
+	name        string
+	root        string
+	command     []string
+	environment map[string]*shellValue
+	count       int
+}
+
+// shellValue a value rendered for a POSIX shell
+// 为 POSIX shell 渲染的值
+type shellValue struct {
+	word    string // Shell word of the value // 值的 shell 单词
+	literal string // Expanded value, meaningful when refs is false // 展开后的值，refs 为 false 时有意义
+	refs    bool   // Value is only known to the running shell, like its environment or host name // 值只有运行中的 shell 才知道，例如其环境变量或主机名
+}
+
+// procfileEntry map program to a process type running count copies
+// 将程序映射为运行 count 个副本的进程类型
+func (p *ProgramConfig) procfileEntry(v *validator, groupName string, count int) *procfileEntry {
+	section := "program:" + p.Name
+	vars := p.instanceVars(groupName, 0)
+	expand := func(field string, value string) *shellValue {
+		res, err := shellExpand(value, vars)
+		if err != nil {
+			v.add(section, field, value, ErrInvalidValue, "%s", err.Error())
+			return &shellValue{}
+		}
+		return res
+	}
+
+	entry := &procfileEntry{
+		name:        p.Name,
+		root:        expand("Root", p.Root).word,
+		environment: make(map[string]*shellValue, len(p.Environment.Get())),
+		count:       count,
+	}
+	for _, arg := range p.CommandArgs() {
+		entry.command = append(entry.command, expand("Command", arg).word)
+	}
+	for key, value := range p.Environment.Get() {
+		entry.environment[key] = expand("Environment", value)
+	}
+	return entry
+}
+
+// sharedProcfileEnvironment keys every entry sets to the same literal value, mapped to that value
+// 所有条目都设置为相同字面值的键，映射到该值
+func sharedProcfileEnvironment(entries []*procfileEntry) map[string]string {
+	res := make(map[string]string)
+	if len(entries) == 0 {
+		return res
+	}
+	for key, value := range entries[0].environment {
+		if !value.refs && !slices.ContainsFunc(entries[1:], func(entry *procfileEntry) bool {
+			other, ok := entry.environment[key]
+			return !ok || other.refs || other.literal != value.literal
+		}) {
+			res[key] = value.literal
+		}
+	}
+	return res
+}
+
+// shellExpand expand supervisor expressions of value into a shell word, %(ENV_X)s becomes "${X}" and %(host_node_name)s "$(hostname)"
+// shellExpand 将 value 中的 supervisor 表达式展开为 shell 单词，%(ENV_X)s 变为 "${X}"，%(host_node_name)s 变为 "$(hostname)"
+func shellExpand(value string, vars map[string]string) (*shellValue, error) {
+	var word, literal, part strings.Builder
+	refs := false
+	flush := func() {
+		if part.Len() > 0 {
+			word.WriteString(shellQuote(part.String()))
+			part.Reset()
+		}
+	}
+	for i := 0; i < len(value); i++ {
+		if value[i] != '%' {
+			part.WriteByte(value[i])
+			literal.WriteByte(value[i])
+			continue
+		}
+		name, size, ok := scanExpansion(value[i:])
+		if !ok || (!slices.Contains(expansionNames, name) && !strings.HasPrefix(name, "ENV_")) {
+			part.WriteByte('%')
+			literal.WriteByte('%')
+			continue
+		}
+		expression := value[i : i+size]
+		switch {
+		case strings.HasPrefix(name, "ENV_"):
+			if expression != "%("+name+")s" {
+				return nil, errors.Errorf("%s has no shell equivalent, only %%(ENV_X)s is supported", expression)
+			}
+			flush()
+			word.WriteString(`"${` + strings.TrimPrefix(name, "ENV_") + `}"`)
+			refs = true
+		case name == "host_node_name":
+			if expression != "%(host_node_name)s" {
+				return nil, errors.Errorf("%s has no shell equivalent, only %%(host_node_name)s is supported", expression)
+			}
+			flush()
+			word.WriteString(`"$(hostname)"`)
+			refs = true
+		case name == "here":
+			return nil, errors.Errorf("%s has no shell equivalent", expression)
+		default:
+			expanded := expandExpressions(expression, vars)
+			part.WriteString(expanded)
+			literal.WriteString(expanded)
+		}
+		i += size - 1
+	}
+	flush()
+	if word.Len() == 0 {
+		word.WriteString("''")
+	}
+	return &shellValue{word: word.String(), literal: literal.String(), refs: refs}, nil
+}
+
+// shellQuote quote value for a POSIX shell unless it only has safe characters
+// 除非值只包含安全字符，否则按 POSIX shell 规则为其加引号
+func shellQuote(value string) string {
+	if value != "" && !strings.ContainsFunc(value, func(c rune) bool { return !isSafeArgRune(c) || c == '(' || c == ')' }) {
+		return value
+	}
+	return "'" + strings.ReplaceAll(value, "'", `'\''`) + "'"
+}
+
+// quoteDotEnvValue quote .env value in double quotes unless it only has safe characters
+// 除非 .env 的值只包含安全字符，否则用双引号为其加引号
+func quoteDotEnvValue(value string) string {
+	if value != "" && !strings.ContainsFunc(value, func(c rune) bool { return !isSafeArgRune(c) }) {
+		return value
+	}
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(value) + `"`
+}
+
+// ParseProcfile parse Procfile into a group skeleton of programs named by the process types
+// A leading "cd <dir> &&" sets Root, otherwise root is used, leading KEY=value words become Environment
+// formation like "api=3,worker=0" (foreman -m, honcho -c) gives the counts, "all=N" sets the default,
+// a count above 1 sets NumProcs and a %(process_num) ProcessName, 0 sets AutoStart false
+// $X and ${X} outside single quotes become %(ENV_X)s read from the environment of supervisord,
+// other shell syntax like pipes, "&&" beyond the leading cd, $(...) or ${X:-default} is rejected, wrap it in sh -c
+//
+// 将 Procfile 解析为以进程类型命名的程序组成的组骨架
+// 开头的 "cd <dir> &&" 设置 Root，否则使用 root，开头的 KEY=value 单词成为 Environment
+// formation 例如 "api=3,worker=0"（foreman -m、honcho -c）给出进程数量，"all=N" 设置默认值，
+// 数量大于 1 时设置 NumProcs 和带 %(process_num) 的 ProcessName，为 0 时 AutoStart 为 false
+// 单引号之外的 $X 和 ${X} 变为从 supervisord 环境变量读取的 %(ENV_X)s，
+// 管道、开头 cd 之后的 "&&"、$(...) 或 ${X:-default} 等其他 shell 语法会被拒绝，请用 sh -c 包装
+func ParseProcfile(groupName string, procfile string, formation string, root string, userName string, slogRoot string) (*GroupConfig, error) {
+	counts, err := parseFormation(formation)
+	if err != nil {
+		return nil, errors.WithMessage(err, "formation")
+	}
+	group := NewGroupConfig(groupName)
+	for idx, line := range strings.Split(procfile, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		match := procfileLineRegexp.FindStringSubmatch(line)
+		if match == nil {
+			return nil, errors.Errorf("line %d: %q is not a \"name: command\" line", idx+1, line)
+		}
+		if slices.ContainsFunc(group.Programs, func(program *ProgramConfig) bool { return program.Name == match[1] }) {
+			return nil, errors.Errorf("line %d: duplicate process type %q", idx+1, match[1])
+		}
+		program, err := parseProcfileCommand(match[1], match[2], root, userName, slogRoot)
+		if err != nil {
+			return nil, errors.WithMessagef(err, "line %d", idx+1)
+		}
+		group.AddProgram(program)
+	}
+
+	for name := range counts {
+		if name != "all" && !slices.ContainsFunc(group.Programs, func(program *ProgramConfig) bool { return program.Name == name }) {
+			return nil, errors.Errorf("formation: unknown process type %q", name)
+		}
+	}
+	for _, program := range group.Programs {
+		count, ok := counts[program.Name]
+		if !ok {
+			count, ok = counts["all"]
+		}
+		switch {
+		case !ok || count == 1:
+		case count == 0:
+			program.WithAutoStart(false)
+		default:
+			program.WithNumProcs(count).WithProcessName("%(program_name)s_%(process_num)d")
+		}
+	}
+	return group, nil
+}
+
+// parseProcfileCommand parse command of a Procfile line into a program
+// 将 Procfile 行的命令解析为程序
+func parseProcfileCommand(name string, command string, root string, userName string, slogRoot string) (*ProgramConfig, error) {
+	tokens, err := splitShellWords(command)
+	if err != nil {
+		return nil, err
+	}
+	if len(tokens) >= 3 && tokens[0] == "cd" && tokens[2] == "&&" {
+		if filepath.IsAbs(tokens[1]) {
+			root = tokens[1]
+		} else {
+			root = filepath.Join(root, tokens[1])
+		}
+		tokens = tokens[3:]
+	}
+	environment := make(map[string]string)
+	for len(tokens) > 0 {
+		key, value, ok := strings.Cut(tokens[0], "=")
+		if !ok || !envNameRegexp.MatchString(key) {
+			break
+		}
+		environment[key] = value
+		tokens = tokens[1:]
+	}
+	if len(tokens) > 0 && tokens[0] == "exec" {
+		tokens = tokens[1:]
+	}
+	if len(tokens) == 0 {
+		return nil, errors.New("empty command")
+	}
+	if pos := slices.IndexFunc(tokens, func(token string) bool {
+		return slices.Contains([]string{"&&", "||", "|", ";", "&", ">", ">>", "<", "2>&1"}, token)
+	}); pos >= 0 {
+		return nil, errors.Errorf("shell operator %q is not supported, wrap the command in sh -c", tokens[pos])
+	}
+	if !filepath.IsAbs(tokens[0]) && strings.Contains(tokens[0], "/") {
+		tokens[0] = filepath.Join(root, tokens[0]) // Relative to the DIR the command runs in // 相对于命令运行的目录
+	}
+
+	program := NewProgramConfig(name, root, userName, slogRoot)
+	setCommandTokens(program, tokens)
+	if len(environment) > 0 {
+		program.WithEnvironment(environment)
+	}
+	return program, nil
+}
+
+// splitShellWords split command into words the way a POSIX shell does, $X and ${X} become %(ENV_X)s
+// Single quoted text is literal, other expansions have no supervisor equivalent and are reported
+//
+// 按 POSIX shell 的方式将命令拆分为单词，$X 和 ${X} 变为 %(ENV_X)s
+// 单引号内的文本按字面处理，其他展开没有 supervisor 对应物，会作为错误报告
+func splitShellWords(command string) ([]string, error) {
+	results := make([]string, 0)
+	var word strings.Builder
+	inWord := false
+	quote := byte(0)
+	for i := 0; i < len(command); i++ {
+		c := command[i]
+		switch {
+		case quote == '\'':
+			if c == '\'' {
+				quote = 0
+			} else {
+				word.WriteByte(c)
+			}
+		case c == '\\' && i+1 < len(command) && (quote == 0 || strings.IndexByte("$`\"\\", command[i+1]) >= 0):
+			i++
+			word.WriteByte(command[i])
+			inWord = true
+		case c == '$':
+			expression, size, err := shellVariable(command[i:])
+			if err != nil {
+				return nil, err
+			}
+			word.WriteString(expression)
+			i += size - 1
+			inWord = true
+		case c == '`':
+			return nil, errors.New("command substitution is not supported, wrap the command in sh -c")
+		case quote == '"':
+			if c == '"' {
+				quote = 0
+			} else {
+				word.WriteByte(c)
+			}
+		case c == '\'' || c == '"':
+			quote = c
+			inWord = true
+		case c == ' ' || c == '\t':
+			if inWord {
+				results = append(results, word.String())
+				word.Reset()
+				inWord = false
+			}
+		default:
+			word.WriteByte(c)
+			inWord = true
+		}
+	}
+	if quote != 0 {
+		return nil, errors.Errorf("unterminated quote in command %q", command)
+	}
+	if inWord {
+		results = append(results, word.String())
+	}
+	return results, nil
+}
+
+// shellVariable translate the shell expansion at the start of s, returns the text and the bytes it takes
+// $X and ${X} become %(ENV_X)s, a "$" not starting an expansion is literal
+//
+// 转换 s 开头的 shell 展开，返回转换后的文本和其占用的字节数
+// $X 和 ${X} 变为 %(ENV_X)s，不构成展开的 "$" 按字面处理
+func shellVariable(s string) (string, int, error) {
+	if match := shellVariableRegexp.FindStringSubmatch(s); match != nil {
+		return "%(ENV_" + match[1] + match[2] + ")s", len(match[0]), nil
+	}
+	if len(s) > 1 && strings.IndexByte("{(0123456789@*#?$!-", s[1]) >= 0 {
+		return "", 0, errors.Errorf("shell expansion %q is not supported, wrap the command in sh -c", s[:2])
+	}
+	return "$", 1, nil
+}
+
+// parseFormation parse process counts like "api=3,worker=0"
+// 解析进程数量，例如 "api=3,worker=0"
+func parseFormation(formation string) (map[string]int, error) {
+	res := make(map[string]int)
+	for _, item := range splitList(formation) {
+		name, value, ok := strings.Cut(item, "=")
+		if !ok || !procfileNameRegexp.MatchString(name) {
+			return nil, errors.Errorf("invalid item %q, want name=count", item)
+		}
+		count, err := strconv.Atoi(value)
+		if err != nil || count < 0 {
+			return nil, errors.Errorf("invalid count %q of %q", value, name)
+		}
+		if _, ok := res[name]; ok {
+			return nil, errors.Errorf("duplicate process type %q", name)
+		}
+		res[name] = count
+	}
+	return res, nil
+}
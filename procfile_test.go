@@ -0,0 +1,100 @@
+package supervisorkratos_test
+
+import (
+	"testing"
+
+	"github.com/orzkratos/supervisorkratos"
+	"github.com/stretchr/testify/require"
+)
+
+func TestProcfile(t *testing.T) {
+	// Test programs become process types with shared environment in .env and the rest inline
+	// 测试程序成为进程类型，共享的环境变量写入 .env，其余的内联在命令中
+	group := supervisorkratos.NewGroupConfig("services").
+		AddProgram(supervisorkratos.NewProgramConfig("api", "/opt/api", "deploy", "/var/log/services").
+			WithArgs("-conf", "/opt/api/configs", "-name", "it's %(program_name)s").
+			WithEnvironment(map[string]string{"APP_ENV": "dev", "TOKEN": "%(ENV_TOKEN)s", "ROLE": "api"}).
+			WithNumProcs(3).
+			WithProcessName("%(program_name)s_%(process_num)d")).
+		AddProgram(supervisorkratos.NewProgramConfig("worker", "/opt/worker", "deploy", "/var/log/services").
+			WithWrapper("nice", "-n", "10").
+			WithArgs("-host", "%(host_node_name)s").
+			WithEnvironment(map[string]string{"APP_ENV": "dev", "ROLE": "worker", "GREETING": "hello world"}).
+			WithAutoStart(false))
+
+	files := supervisorkratos.GenerateProcfile(group)
+	t.Log(files.Procfile)
+	require.Equal(t, "api: cd /opt/api && ROLE=api TOKEN=\"${TOKEN}\" /opt/api/bin/api -conf /opt/api/configs -name 'it'\\''s api'\n"+
+		"worker: cd /opt/worker && GREETING='hello world' ROLE=worker nice -n 10 /opt/worker/bin/worker -host \"$(hostname)\"\n", files.Procfile)
+	require.Equal(t, "APP_ENV=dev\n", files.Env)
+	require.Equal(t, "api=3,worker=0", files.Formation)
+}
+
+func TestProcfileInstances(t *testing.T) {
+	// Test instances with their own ports become one process type each
+	// 测试拥有各自端口的实例各自成为一个进程类型
+	group := supervisorkratos.NewGroupConfig("services").
+		AddProgram(supervisorkratos.NewProgramConfig("api", "/opt/api", "deploy", "/var/log/services").
+			WithNumProcs(2).
+			WithProcessName("%(program_name)s_%(process_num)d").
+			WithPorts(supervisorkratos.NewPortAllocation(8000, 0)))
+
+	files := supervisorkratos.GenerateProcfile(group)
+	t.Log(files.Procfile)
+	require.Contains(t, files.Procfile, "api_1: cd /opt/api && KRATOS_HTTP_ADDR=0.0.0.0:8001 /opt/api/bin/api\n")
+	require.Equal(t, "", files.Env)
+	require.Equal(t, "api_0=1,api_1=1", files.Formation)
+}
+
+func TestProcfileErrors(t *testing.T) {
+	// Test names foreman can't run and expressions without a shell equivalent are reported
+	// 测试报告 foreman 无法运行的名称和没有 shell 对应物的表达式
+	group := supervisorkratos.NewGroupConfig("services").
+		AddProgram(supervisorkratos.NewProgramConfig("api.v1", "/opt/api", "deploy", "/var/log/services")).
+		AddProgram(supervisorkratos.NewProgramConfig("worker", "/opt/worker", "deploy", "/var/log/services").
+			WithArgs("-conf", "%(here)s/worker.yaml"))
+	_, err := supervisorkratos.GenerateProcfileE(group)
+	require.ErrorIs(t, err, supervisorkratos.ErrInvalidValue)
+	require.ErrorContains(t, err, "api.v1")
+	require.ErrorContains(t, err, "%(here)s")
+}
+
+func TestParseProcfile(t *testing.T) {
+	// Test a Procfile and formation parse back into programs, and a generated Procfile round trips
+	// 测试 Procfile 和进程数量解析回程序，生成的 Procfile 可以往返转换
+	group, err := supervisorkratos.ParseProcfile("services", `
+# local processes
+web: cd /opt/web && exec bin/web -port $PORT -name "${APP}_web"
+worker: QUEUE=high python worker.py --queue 'high $priority'
+`, "all=2,worker=0", "/opt/app", "deploy", "/var/log/services")
+	require.NoError(t, err)
+	require.Len(t, group.Programs, 2)
+
+	web := group.Programs[0]
+	require.Equal(t, "/opt/web", web.Root)
+	require.False(t, web.Environment.IsSet())
+	require.Equal(t, []string{"/opt/web/bin/web", "-port", "%(ENV_PORT)s", "-name", "%(ENV_APP)s_web"}, web.CommandArgs())
+	require.Equal(t, 2, web.NumProcs.Get())
+	require.Equal(t, "%(program_name)s_%(process_num)d", web.ProcessName.Get())
+
+	worker := group.Programs[1]
+	require.Equal(t, "/opt/app", worker.Root)
+	require.Equal(t, "python", worker.Executable.Get())
+	require.Equal(t, []string{"worker.py", "--queue", "high $priority"}, worker.Args.Get())
+	require.Equal(t, map[string]string{"QUEUE": "high"}, worker.Environment.Get())
+	require.False(t, worker.AutoStart.Get())
+
+	files := supervisorkratos.GenerateProcfile(group)
+	res, err := supervisorkratos.ParseProcfile("services", files.Procfile, files.Formation, "/opt/app", "deploy", "/var/log/services")
+	require.NoError(t, err)
+	require.Equal(t, supervisorkratos.GenerateGroupConfig(group), supervisorkratos.GenerateGroupConfig(res))
+
+	_, err = supervisorkratos.ParseProcfile("services", "web: bin/web | tee web.log\n", "", "/opt/app", "deploy", "/var/log/services")
+	require.ErrorContains(t, err, "sh -c")
+	for _, command := range []string{"bin/web -date $(date)", "bin/web -port ${PORT:-5000}", "bin/web `hostname`"} {
+		_, err = supervisorkratos.ParseProcfile("services", "web: "+command+"\n", "", "/opt/app", "deploy", "/var/log/services")
+		require.ErrorContains(t, err, "sh -c", command)
+	}
+	_, err = supervisorkratos.ParseProcfile("services", "web: bin/web\n", "api=1", "/opt/app", "deploy", "/var/log/services")
+	require.ErrorContains(t, err, "api")
+}
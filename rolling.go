@@ -0,0 +1,175 @@
+package supervisorkratos
+
+import (
+	"context"
+	"time"
+
+	"github.com/orzkratos/supervisorkratos/supervisorrpc"
+	"github.com/pkg/errors"
+)
+
+// ProcessClient supervisord XML-RPC process methods, implemented by *supervisorrpc.Client
+// supervisord 的 XML-RPC 进程方法，由 *supervisorrpc.Client 实现
+type ProcessClient interface {
+	GetProcessInfo(ctx context.Context, name string) (*supervisorrpc.ProcessInfo, error)
+	StartProcess(ctx context.Context, name string, wait bool) error
+	StopProcess(ctx context.Context, name string, wait bool) error
+}
+
+// HealthCheckFunc user health check of a started process, name is "group:name"
+// 已启动进程的用户健康检查，name 为 "group:name"
+type HealthCheckFunc func(ctx context.Context, name string) error
+
+// RollingRestart restart NumProcs instances of a program a batch at a time, so capacity never drops to zero
+// 每次重启程序 NumProcs 实例中的一批，使服务能力不会降为零
+type RollingRestart struct {
+	BatchSize    int             // Instances restarted together // 同时重启的实例数
+	HealthCheck  HealthCheckFunc // Optional gate after each instance is RUNNING // 每个实例 RUNNING 后的可选检查
+	PollInterval time.Duration   // Interval of getProcessInfo polls // getProcessInfo 轮询间隔
+	Timeout      time.Duration   // Max wait of each batch, 0 derives it from the program // 每批的最长等待时间，0 表示根据程序推算
+}
+
+// NewRollingRestart create new RollingRestart restarting one instance at a time
+// 创建新的 RollingRestart，每次重启一个实例
+func NewRollingRestart() *RollingRestart {
+	return &RollingRestart{
+		BatchSize:    1,
+		HealthCheck:  nil,
+		PollInterval: 500 * time.Millisecond,
+		Timeout:      0,
+	}
+}
+
+// WithBatchSize set instances restarted together
+// 设置同时重启的实例数
+func (r *RollingRestart) WithBatchSize(batchSize int) *RollingRestart {
+	r.BatchSize = batchSize
+	return r
+}
+
+// WithHealthCheck set health check gate, a failing check aborts the rolling restart, nil falls back to ProgramConfig.HealthCheck
+// 设置健康检查关卡，检查失败会中止滚动重启，nil 时使用 ProgramConfig.HealthCheck
+func (r *RollingRestart) WithHealthCheck(healthCheck HealthCheckFunc) *RollingRestart {
+	r.HealthCheck = healthCheck
+	return r
+}
+
+// WithPollInterval set interval of getProcessInfo polls
+// 设置 getProcessInfo 轮询间隔
+func (r *RollingRestart) WithPollInterval(pollInterval time.Duration) *RollingRestart {
+	r.PollInterval = pollInterval
+	return r
+}
+
+// WithTimeout set max wait of each batch
+// 设置每批的最长等待时间
+func (r *RollingRestart) WithTimeout(timeout time.Duration) *RollingRestart {
+	r.Timeout = timeout
+	return r
+}
+
+// RollingReport result of RollingRestart.Run
+// RollingRestart.Run 的结果
+type RollingReport struct {
+	Restarted []string // Instances restarted and healthy, in order // 已重启且健康的实例，按顺序
+	Failed    []string // Instances of the aborted batch // 中止批次中的实例
+}
+
+// Run restart every instance of program in group groupName, batch by batch
+// Each instance must reach RUNNING for at least StartSecs and pass HealthCheck before the next batch starts
+// The first failure aborts, instances after it are left untouched
+//
+// 逐批重启 groupName 组中 program 的每个实例
+// 每个实例必须保持 RUNNING 至少 StartSecs 并通过 HealthCheck，下一批才会开始
+// 第一次失败即中止，之后的实例保持不变
+func (r *RollingRestart) Run(ctx context.Context, client ProcessClient, program *ProgramConfig, groupName string) (*RollingReport, error) {
+	if err := program.Validate(); err != nil {
+		return nil, err
+	}
+	if r.BatchSize < 1 {
+		return nil, errors.Errorf("batch size %d is less than 1", r.BatchSize)
+	}
+	if r.PollInterval <= 0 {
+		return nil, errors.Errorf("poll interval %v is not positive", r.PollInterval)
+	}
+	timeout := r.Timeout
+	if timeout <= 0 {
+		timeout = startTimeout(program)
+	}
+
+	healthCheck := r.HealthCheck
+	if healthCheck == nil && program.HealthCheck != nil {
+		healthCheck = program.HealthCheckFunc(groupName)
+	}
+
+	report := &RollingReport{}
+	names := program.ProcessNames(groupName)
+	for start := 0; start < len(names); start += r.BatchSize {
+		batch := names[start:min(start+r.BatchSize, len(names))]
+		if err := r.restartBatch(ctx, client, program, batch, timeout, healthCheck); err != nil {
+			report.Failed = batch
+			return report, err
+		}
+		report.Restarted = append(report.Restarted, batch...)
+	}
+	return report, nil
+}
+
+func (r *RollingRestart) restartBatch(ctx context.Context, client ProcessClient, program *ProgramConfig, batch []string, timeout time.Duration, healthCheck HealthCheckFunc) error {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	for _, name := range batch {
+		if err := client.StopProcess(ctx, name, true); err != nil && !supervisorrpc.IsFault(err, supervisorrpc.FaultNotRunning) {
+			return errors.WithMessagef(err, "stop %s", name)
+		}
+	}
+	for _, name := range batch {
+		if err := client.StartProcess(ctx, name, false); err != nil {
+			return errors.WithMessagef(err, "start %s", name)
+		}
+	}
+	for _, name := range batch {
+		if err := waitProcessRunning(ctx, client, name, program.StartSecs.Get(), r.PollInterval); err != nil {
+			return err
+		}
+		if healthCheck != nil {
+			if err := healthCheck(ctx, name); err != nil {
+				return errors.WithMessagef(err, "health check %s", name)
+			}
+		}
+	}
+	return nil
+}
+
+// startTimeout time enough for every start retry and a graceful stop of program
+// 足够程序完成所有启动重试和一次优雅停止的时间
+func startTimeout(program *ProgramConfig) time.Duration {
+	return time.Duration((program.StartRetries.Get()+1)*(program.StartSecs.Get()+1)+program.StopWaitSecs.Get()) * time.Second
+}
+
+// waitProcessRunning poll until process is RUNNING for at least startSecs, FATAL or EXITED fail at once
+// 轮询直到进程保持 RUNNING 至少 startSecs，FATAL 或 EXITED 立即失败
+func waitProcessRunning(ctx context.Context, client ProcessClient, name string, startSecs int, pollInterval time.Duration) error {
+	ticker := time.NewTicker(pollInterval)
+	defer ticker.Stop()
+	for {
+		info, err := client.GetProcessInfo(ctx, name)
+		if err != nil {
+			return errors.WithMessagef(err, "get process info %s", name)
+		}
+		switch info.State {
+		case supervisorrpc.ProcessRunning:
+			if info.Now.Sub(info.Start) >= time.Duration(startSecs)*time.Second {
+				return nil
+			}
+		case supervisorrpc.ProcessFatal, supervisorrpc.ProcessExited, supervisorrpc.ProcessStopped:
+			return errors.Errorf("process %s is %s: %s", name, info.State, info.SpawnErr)
+		}
+		select {
+		case <-ctx.Done():
+			return errors.WithMessagef(ctx.Err(), "wait %s RUNNING, last state %s", name, info.State)
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,109 @@
+package supervisorkratos_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/orzkratos/supervisorkratos"
+	"github.com/orzkratos/supervisorkratos/supervisorrpc"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeProcesses simulate processes that pass STARTING before RUNNING, names in fatal never start
+// fakeProcesses 模拟先经过 STARTING 再进入 RUNNING 的进程，fatal 中的名称永远无法启动
+type fakeProcesses struct {
+	calls   []string
+	polls   map[string]int
+	fatal   map[string]bool
+	running int
+	maxDown int
+}
+
+func (f *fakeProcesses) GetProcessInfo(ctx context.Context, name string) (*supervisorrpc.ProcessInfo, error) {
+	f.polls[name]++
+	now := time.Unix(1700000000, 0)
+	if f.fatal[name] {
+		return &supervisorrpc.ProcessInfo{State: supervisorrpc.ProcessFatal, SpawnErr: "Exited too quickly"}, nil
+	}
+	if f.polls[name] == 1 {
+		return &supervisorrpc.ProcessInfo{State: supervisorrpc.ProcessStarting, Start: now, Now: now}, nil
+	}
+	return &supervisorrpc.ProcessInfo{State: supervisorrpc.ProcessRunning, Start: now, Now: now.Add(5 * time.Second)}, nil
+}
+
+func (f *fakeProcesses) StartProcess(ctx context.Context, name string, wait bool) error {
+	f.calls = append(f.calls, "start "+name)
+	f.polls[name] = 0
+	f.running++
+	return nil
+}
+
+func (f *fakeProcesses) StopProcess(ctx context.Context, name string, wait bool) error {
+	f.calls = append(f.calls, "stop "+name)
+	f.running--
+	f.maxDown = max(f.maxDown, 4-f.running)
+	return nil
+}
+
+func newFakeProcesses() *fakeProcesses {
+	return &fakeProcesses{polls: map[string]int{}, fatal: map[string]bool{}, running: 4}
+}
+
+func TestRollingRestart(t *testing.T) {
+	// Test instances restart two at a time with health checks and capacity never drops to zero
+	// 测试实例每次重启两个并进行健康检查，服务能力不会降为零
+	program := supervisorkratos.NewProgramConfig("web", "/opt/web", "deploy", "/var/log/services").
+		WithNumProcs(4).
+		WithProcessName("%(program_name)s_%(process_num)d").
+		WithStartSecs(5)
+
+	client := newFakeProcesses()
+	var checked []string
+	rolling := supervisorkratos.NewRollingRestart().
+		WithBatchSize(2).
+		WithPollInterval(time.Millisecond).
+		WithHealthCheck(func(ctx context.Context, name string) error {
+			checked = append(checked, name)
+			return nil
+		})
+	report, err := rolling.Run(context.Background(), client, program, "services")
+	require.NoError(t, err)
+	require.Equal(t, []string{"services:web_0", "services:web_1", "services:web_2", "services:web_3"}, report.Restarted)
+	require.Equal(t, report.Restarted, checked)
+	require.Equal(t, 2, client.maxDown)
+	require.Equal(t, []string{
+		"stop services:web_0", "stop services:web_1", "start services:web_0", "start services:web_1",
+		"stop services:web_2", "stop services:web_3", "start services:web_2", "start services:web_3",
+	}, client.calls)
+}
+
+func TestRollingRestartAbort(t *testing.T) {
+	// Test a fatal instance or failing health check aborts, later instances are untouched
+	// 测试实例 FATAL 或健康检查失败会中止，后续实例保持不变
+	program := supervisorkratos.NewProgramConfig("web", "/opt/web", "deploy", "/var/log/services").
+		WithNumProcs(4).
+		WithProcessName("%(program_name)s_%(process_num)d")
+
+	client := newFakeProcesses()
+	client.fatal["web:web_1"] = true
+	report, err := supervisorkratos.NewRollingRestart().WithPollInterval(time.Millisecond).Run(context.Background(), client, program, "")
+	require.ErrorContains(t, err, "FATAL")
+	require.Equal(t, []string{"web:web_0"}, report.Restarted)
+	require.Equal(t, []string{"web:web_1"}, report.Failed)
+	require.NotContains(t, client.calls, "stop web:web_2")
+
+	errUnhealthy := errors.New("unhealthy")
+	report, err = supervisorkratos.NewRollingRestart().
+		WithPollInterval(time.Millisecond).
+		WithHealthCheck(func(ctx context.Context, name string) error { return errUnhealthy }).
+		Run(context.Background(), newFakeProcesses(), program, "")
+	require.ErrorIs(t, err, errUnhealthy)
+	require.Empty(t, report.Restarted)
+
+	// Invalid program is rejected before any call
+	// 无效程序在任何调用之前被拒绝
+	_, err = supervisorkratos.NewRollingRestart().Run(context.Background(), client, program.WithProcessName("web"), "")
+	require.ErrorIs(t, err, supervisorkratos.ErrInvalidValue)
+}
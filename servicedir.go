@@ -0,0 +1,253 @@
+package supervisorkratos
+
+import (
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/yyle88/must"
+	"github.com/yyle88/printgo"
+)
+
+// serviceSuite supervision suite a service DIR is written for
+// 服务目录所面向的监管套件
+type serviceSuite string
+
+const (
+	suiteRunit serviceSuite = "runit"
+	suiteS6    serviceSuite = "s6"
+)
+
+// s6LogMaxSize largest file size s6-log accepts
+// s6-log 接受的最大文件大小
+const s6LogMaxSize = 268435455
+
+// GenerateRunitServiceDirs generate runit service DIRs of the program keyed by path, panics on invalid config
+// 生成程序的 runit 服务目录，以路径为键，配置无效时 panic
+func GenerateRunitServiceDirs(program *ProgramConfig) map[string]string {
+	return must.V1(GenerateRunitServiceDirsE(program))
+}
+
+// GenerateRunitServiceDirsE generate runit service DIRs of the program keyed by path relative to the service scan DIR
+// Each instance gets "<name>/run", "<name>/log/run" and, when needed, "<name>/finish", "<name>/down", "<name>/env/<KEY>" and "<name>/control/t"
+// NumProcs > 1 gives one DIR per instance named by its process name, since runit has no templates
+// Fields map as: UserName→chpst -u, Root→cd, Environment→env/ read by chpst -e, AutoStart false→down,
+// AutoRestart and ExitCodes→finish running "sv down", StopSignal→control/t, RedirectStderr→exec 2>&1,
+// SlogRoot→svlogd DIR <SlogRoot>/<name> with LogMaxBytes and LogBackups as its s and n settings (at least one old file)
+// Not mapped: StartRetries, StartSecs, StopWaitSecs, StopAsGroup, KillAsGroup, Priority and HealthCheck
+//
+// 生成程序的 runit 服务目录，以相对于服务扫描目录的路径为键
+// 每个实例生成 "<name>/run"、"<name>/log/run"，以及按需生成的 "<name>/finish"、"<name>/down"、"<name>/env/<KEY>" 和 "<name>/control/t"
+// NumProcs > 1 时每个实例一个以其进程名称命名的目录，因为 runit 没有模板
+// 字段映射：UserName→chpst -u，Root→cd，Environment→由 chpst -e 读取的 env/，AutoStart false→down，
+// AutoRestart 和 ExitCodes→运行 "sv down" 的 finish，StopSignal→control/t，RedirectStderr→exec 2>&1，
+// SlogRoot→svlogd 目录 <SlogRoot>/<name>，LogMaxBytes 和 LogBackups 作为其 s 和 n 设置（至少保留一个旧文件）
+// 不映射：StartRetries、StartSecs、StopWaitSecs、StopAsGroup、KillAsGroup、Priority 和 HealthCheck
+func GenerateRunitServiceDirsE(program *ProgramConfig) (map[string]string, error) {
+	return program.serviceDirs(suiteRunit)
+}
+
+// GenerateS6ServiceDirs generate s6 service DIRs of the program keyed by path, panics on invalid config
+// 生成程序的 s6 服务目录，以路径为键，配置无效时 panic
+func GenerateS6ServiceDirs(program *ProgramConfig) map[string]string {
+	return must.V1(GenerateS6ServiceDirsE(program))
+}
+
+// GenerateS6ServiceDirsE generate s6 service DIRs of the program keyed by path relative to the scan DIR
+// Each instance gets "<name>/run", "<name>/log/run", "<name>/timeout-kill" and, when needed,
+// "<name>/finish", "<name>/down", "<name>/env/<KEY>" and "<name>/down-signal"
+// NumProcs > 1 gives one DIR per instance named by its process name
+// Fields map as: UserName→s6-setuidgid, Root→cd, Environment→env/ read by s6-envdir, AutoStart false→down,
+// AutoRestart and ExitCodes→finish exiting 125, StopSignal→down-signal, StopWaitSecs→timeout-kill, RedirectStderr→exec 2>&1,
+// SlogRoot→s6-log DIR <SlogRoot>/<name> with LogMaxBytes and LogBackups as its s and n settings (LogMaxBytes 0 gives the largest size)
+// Not mapped: StartRetries, StartSecs, StopAsGroup, KillAsGroup, Priority and HealthCheck
+//
+// 生成程序的 s6 服务目录，以相对于扫描目录的路径为键
+// 每个实例生成 "<name>/run"、"<name>/log/run"、"<name>/timeout-kill"，以及按需生成的
+// "<name>/finish"、"<name>/down"、"<name>/env/<KEY>" 和 "<name>/down-signal"
+// NumProcs > 1 时每个实例一个以其进程名称命名的目录
+// 字段映射：UserName→s6-setuidgid，Root→cd，Environment→由 s6-envdir 读取的 env/，AutoStart false→down，
+// AutoRestart 和 ExitCodes→退出码为 125 的 finish，StopSignal→down-signal，StopWaitSecs→timeout-kill，RedirectStderr→exec 2>&1，
+// SlogRoot→s6-log 目录 <SlogRoot>/<name>，LogMaxBytes 和 LogBackups 作为其 s 和 n 设置（LogMaxBytes 为 0 时使用最大值）
+// 不映射：StartRetries、StartSecs、StopAsGroup、KillAsGroup、Priority 和 HealthCheck
+func GenerateS6ServiceDirsE(program *ProgramConfig) (map[string]string, error) {
+	return program.serviceDirs(suiteS6)
+}
+
+// WriteServiceDirs write the files of GenerateRunitServiceDirs or GenerateS6ServiceDirs under scanDir
+// run, finish, log/run and control/ scripts are made executable
+//
+// 将 GenerateRunitServiceDirs 或 GenerateS6ServiceDirs 的文件写入 scanDir 下
+// run、finish、log/run 和 control/ 脚本会设为可执行
+func WriteServiceDirs(scanDir string, files map[string]string) error {
+	for _, name := range sortedKeys(files) {
+		filePath := filepath.Join(scanDir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(filePath), 0755); err != nil {
+			return errors.WithMessagef(err, "create DIR of %q", name)
+		}
+		mode := os.FileMode(0644)
+		if base := path.Base(name); base == "run" || base == "finish" || path.Base(path.Dir(name)) == "control" {
+			mode = 0755
+		}
+		if err := os.WriteFile(filePath, []byte(files[name]), mode); err != nil {
+			return errors.WithMessagef(err, "write %q", name)
+		}
+		if err := os.Chmod(filePath, mode); err != nil { // WriteFile keeps the mode of existing files // WriteFile 保留已有文件的权限
+			return errors.WithMessagef(err, "chmod %q", name)
+		}
+	}
+	return nil
+}
+
+// serviceDirs service DIRs of every instance of the program for the suite
+// 为监管套件生成程序每个实例的服务目录
+func (p *ProgramConfig) serviceDirs(suite serviceSuite) (map[string]string, error) {
+	if err := p.Validate(); err != nil {
+		return nil, err
+	}
+	v := &validator{}
+	instances := p.portSections("")
+	if p.NumProcs.Get() > 1 {
+		instances = p.instanceSections("")
+	}
+	files := make(map[string]string)
+	for _, instance := range instances {
+		instance.serviceDir(v, suite, files)
+	}
+	if err := v.result(); err != nil {
+		return nil, err
+	}
+	return files, nil
+}
+
+// serviceDir add the service DIR of an instance into files
+// 将实例的服务目录加入 files
+func (p *ProgramConfig) serviceDir(v *validator, suite serviceSuite, files map[string]string) {
+	section := "program:" + p.Name
+	vars := p.instanceVars("", 0)
+	expand := func(field string, value string) *shellValue {
+		res, err := shellExpand(value, vars)
+		if err != nil {
+			v.add(section, field, value, ErrInvalidValue, "%s", err.Error())
+			return &shellValue{}
+		}
+		return res
+	}
+
+	environment := p.Environment.Get()
+	for _, key := range sortedKeys(environment) {
+		value := expand("Environment", environment[key])
+		switch {
+		case value.refs:
+			v.add(section, "Environment", environment[key], ErrInvalidValue, "%s env/ files can't refer to other variables or the host name", suite)
+		case strings.HasSuffix(value.literal, " ") || strings.HasSuffix(value.literal, "\t"):
+			v.add(section, "Environment", environment[key], ErrInvalidValue, "%s env/ files drop trailing spaces and tabs", suite)
+		default:
+			files[p.Name+"/env/"+key] = strings.ReplaceAll(value.literal, "\n", "\x00") + "\n" // NUL reads back as newline // NUL 读回时为换行
+		}
+	}
+	command := []string{"exec"}
+	if suite == suiteRunit {
+		command = append(command, "chpst")
+		if len(environment) > 0 {
+			command = append(command, "-e", `"$env_dir"`)
+		}
+		command = append(command, "-u", shellQuote(p.UserName))
+	} else {
+		if len(environment) > 0 {
+			command = append(command, "s6-envdir", `"$env_dir"`)
+		}
+		command = append(command, "s6-setuidgid", shellQuote(p.UserName))
+	}
+	for _, arg := range p.CommandArgs() {
+		command = append(command, expand("Command", arg).word)
+	}
+
+	run := printgo.NewPTX()
+	run.Println("#!/bin/sh")
+	if p.RedirectStderr.Get() {
+		run.Println("exec 2>&1")
+	}
+	if len(environment) > 0 {
+		// env/ is read after cd, so its path is taken while still in the service DIR
+		// env/ 在 cd 之后读取，因此在仍处于服务目录时获取其路径
+		run.Println(`env_dir="$PWD/env"`)
+	}
+	run.Println("cd " + expand("Root", p.Root).word + " || exit 1")
+	run.Println(strings.Join(command, " "))
+	files[p.Name+"/run"] = run.String()
+
+	if finish := serviceFinish(suite, p.AutoRestart.Get(), p.ExitCodes.Get()); finish != "" {
+		files[p.Name+"/finish"] = finish
+	}
+	if !p.AutoStart.Get() {
+		files[p.Name+"/down"] = ""
+	}
+	if signal := signalName(p.StopSignal.Get()); signal != "TERM" {
+		if suite == suiteRunit {
+			files[p.Name+"/control/t"] = "#!/bin/sh\nexec kill -" + signal + " \"$(cat supervise/pid)\"\n"
+		} else {
+			files[p.Name+"/down-signal"] = "SIG" + signal + "\n"
+		}
+	}
+	if suite == suiteS6 {
+		files[p.Name+"/timeout-kill"] = strconv.Itoa(p.StopWaitSecs.Get()*1000) + "\n"
+	}
+	files[p.Name+"/log/run"] = p.serviceLogRun(v, suite)
+}
+
+// serviceFinish finish script stopping the service when supervisor would not restart it, empty when it always restarts
+// runit marks the service down with "sv down", s6 does it on exit code 125, $1 is the exit code of run in both
+//
+// 在 supervisor 不会重启时停止服务的 finish 脚本，总是重启时为空
+// runit 使用 "sv down" 标记服务为停止，s6 在退出码为 125 时标记，两者的 $1 都是 run 的退出码
+func serviceFinish(suite serviceSuite, autoRestart any, exitCodes []int) string {
+	stop := "exec sv down ."
+	if suite == suiteS6 {
+		stop = "exit 125"
+	}
+	ptx := printgo.NewPTX()
+	ptx.Println("#!/bin/sh")
+	switch autoRestart {
+	case true, "true":
+		return ""
+	case false, "false":
+		ptx.Println(stop)
+	default:
+		if len(exitCodes) == 0 {
+			return "" // Every exit is unexpected // 每次退出都是意外的
+		}
+		ptx.Println(`case "$1" in`)
+		ptx.Println(combineInts(exitCodes, "|") + ") " + stop + " ;;")
+		ptx.Println("esac")
+	}
+	return ptx.String()
+}
+
+// serviceLogRun log/run script writing the output into the <SlogRoot>/<name> DIR, rotated by svlogd or s6-log
+// log/run 脚本，将输出写入 <SlogRoot>/<name> 目录，由 svlogd 或 s6-log 轮转
+func (p *ProgramConfig) serviceLogRun(v *validator, suite serviceSuite) string {
+	logDir := shellQuote(filepath.Join(p.SlogRoot, p.Name))
+	size, _ := ParseByteSize(p.LogMaxBytes.Get())
+	backups := p.LogBackups.Get()
+
+	ptx := printgo.NewPTX()
+	ptx.Println("#!/bin/sh")
+	ptx.Println("mkdir -p " + logDir)
+	if suite == suiteRunit {
+		// svlogd keeps every old file when n is 0, so one is the fewest // n 为 0 时 svlogd 保留所有旧文件，因此最少为 1
+		ptx.Println("printf 's" + strconv.FormatInt(size, 10) + "\\nn" + strconv.Itoa(max(backups, 1)) + "\\n' > " + logDir + "/config")
+		ptx.Println("exec svlogd -tt " + logDir)
+		return ptx.String()
+	}
+	if size == 0 {
+		size = s6LogMaxSize
+	} else if size < 4096 || size > s6LogMaxSize {
+		v.add("program:"+p.Name, "LogMaxBytes", p.LogMaxBytes.Get(), ErrOutOfRange, "s6-log file size is not within 4096-%d", s6LogMaxSize)
+	}
+	ptx.Println("exec s6-log -b n" + strconv.Itoa(backups) + " s" + strconv.FormatInt(size, 10) + " T " + logDir)
+	return ptx.String()
+}
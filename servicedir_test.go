@@ -0,0 +1,97 @@
+package supervisorkratos_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/orzkratos/supervisorkratos"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRunitServiceDirs(t *testing.T) {
+	// Test a program renders run, finish, down, env/, control/t and an svlogd log/run
+	// 测试程序渲染为 run、finish、down、env/、control/t 以及使用 svlogd 的 log/run
+	program := supervisorkratos.NewProgramConfig("api", "/opt/api", "deploy", "/var/log/services").
+		WithArgs("-conf", "/opt/api/configs", "-name", "%(program_name)s app").
+		WithEnvironment(map[string]string{"APP_ENV": "prod", "EMPTY": ""}).
+		WithAutoStart(false).
+		WithAutoRestartMode("unexpected").
+		WithExitCodes([]int{0, 2}).
+		WithStopSignal("SIGINT").
+		WithRedirectStderr(true).
+		WithLogMaxBytes("10MB").
+		WithLogBackups(0)
+
+	files := supervisorkratos.GenerateRunitServiceDirs(program)
+	t.Log(files["api/run"])
+	require.Equal(t, "#!/bin/sh\nexec 2>&1\nenv_dir=\"$PWD/env\"\ncd /opt/api || exit 1\n"+
+		"exec chpst -e \"$env_dir\" -u deploy /opt/api/bin/api -conf /opt/api/configs -name 'api app'\n", files["api/run"])
+	require.Equal(t, "prod\n", files["api/env/APP_ENV"])
+	require.Equal(t, "\n", files["api/env/EMPTY"])
+	require.Equal(t, "#!/bin/sh\ncase \"$1\" in\n0|2) exec sv down . ;;\nesac\n", files["api/finish"])
+	require.Contains(t, files, "api/down")
+	require.Equal(t, "#!/bin/sh\nexec kill -INT \"$(cat supervise/pid)\"\n", files["api/control/t"])
+	require.Equal(t, "#!/bin/sh\nmkdir -p /var/log/services/api\nprintf 's10485760\\nn1\\n' > /var/log/services/api/config\n"+
+		"exec svlogd -tt /var/log/services/api\n", files["api/log/run"])
+	require.Len(t, files, 7)
+
+	// Programs that always restart and start on boot have neither finish nor down, %(group_name)s is the program name
+	// 总是重启且开机启动的程序既没有 finish 也没有 down，%(group_name)s 为程序名称
+	files = supervisorkratos.GenerateRunitServiceDirs(supervisorkratos.NewProgramConfig("worker", "/opt/worker", "deploy", "/var/log/services").
+		WithArgs("-group", "%(group_name)s").
+		WithAutoRestart(true).
+		WithStopSignal("SIGTERM"))
+	require.Len(t, files, 2)
+	require.Equal(t, "#!/bin/sh\ncd /opt/worker || exit 1\nexec chpst -u deploy /opt/worker/bin/worker -group worker\n", files["worker/run"])
+}
+
+func TestS6ServiceDirs(t *testing.T) {
+	// Test s6 maps the stop signal and wait to down-signal and timeout-kill, and NumProcs to one DIR per instance
+	// 测试 s6 将停止信号和等待时间映射为 down-signal 和 timeout-kill，并将 NumProcs 映射为每个实例一个目录
+	program := supervisorkratos.NewProgramConfig("api", "/opt/api", "deploy", "/var/log/services").
+		WithNumProcs(2).
+		WithProcessName("%(program_name)s_%(process_num)d").
+		WithArgs("-id", "%(process_num)d", "-group", "%(group_name)s").
+		WithAutoRestart(false).
+		WithStopSignal("sigquit").
+		WithStopWaitSecs(30).
+		WithPorts(supervisorkratos.NewPortAllocation(8000, 0))
+
+	files := supervisorkratos.GenerateS6ServiceDirs(program)
+	t.Log(files["api_1/run"])
+	require.Equal(t, "#!/bin/sh\nenv_dir=\"$PWD/env\"\ncd /opt/api || exit 1\n"+
+		"exec s6-envdir \"$env_dir\" s6-setuidgid deploy /opt/api/bin/api -id 1 -group api\n", files["api_1/run"])
+	require.Equal(t, "0.0.0.0:8001\n", files["api_1/env/KRATOS_HTTP_ADDR"])
+	require.Equal(t, "#!/bin/sh\nexit 125\n", files["api_1/finish"])
+	require.Equal(t, "SIGQUIT\n", files["api_1/down-signal"])
+	require.Equal(t, "30000\n", files["api_1/timeout-kill"])
+	require.Equal(t, "#!/bin/sh\nmkdir -p /var/log/services/api_1\nexec s6-log -b n10 s52428800 T /var/log/services/api_1\n", files["api_1/log/run"])
+	require.Contains(t, files, "api_0/run")
+	require.NotContains(t, files, "api_0/down")
+
+	// Values envdir can't hold and sizes s6-log rejects are reported
+	// 报告 envdir 无法保存的值和 s6-log 拒绝的大小
+	program = supervisorkratos.NewProgramConfig("worker", "/opt/worker", "deploy", "/var/log/services").
+		WithEnvironment(map[string]string{"TOKEN": "%(ENV_TOKEN)s"}).
+		WithLogMaxBytes("1KB")
+	_, err := supervisorkratos.GenerateS6ServiceDirsE(program)
+	require.ErrorIs(t, err, supervisorkratos.ErrInvalidValue)
+	require.ErrorIs(t, err, supervisorkratos.ErrOutOfRange)
+}
+
+func TestWriteServiceDirs(t *testing.T) {
+	// Test scripts are written executable and other files are not
+	// 测试脚本以可执行权限写入，其他文件则不是
+	program := supervisorkratos.NewProgramConfig("api", "/opt/api", "deploy", "/var/log/services").
+		WithEnvironment(map[string]string{"APP_ENV": "prod"}).
+		WithAutoStart(false)
+	root := t.TempDir()
+	require.NoError(t, supervisorkratos.WriteServiceDirs(root, supervisorkratos.GenerateRunitServiceDirs(program)))
+
+	for name, mode := range map[string]os.FileMode{"api/run": 0755, "api/finish": 0755, "api/log/run": 0755, "api/down": 0644, "api/env/APP_ENV": 0644} {
+		info, err := os.Stat(filepath.Join(root, name))
+		require.NoError(t, err)
+		require.Equal(t, mode, info.Mode().Perm(), name)
+	}
+}
@@ -0,0 +1,460 @@
+package supervisorkratos
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"gopkg.in/yaml.v3"
+)
+
+// Spec declarative deployment file, YAML or JSON, turned into supervisor configs with Build
+// Keys follow supervisor option names where one exists, an absent key keeps the supervisor default (Opt.IsSet() is false)
+//
+// 声明式部署文件，YAML 或 JSON 格式，使用 Build 转换为 supervisor 配置
+// 键名尽量与 supervisor 选项名一致，缺省的键保持 supervisor 默认值（Opt.IsSet() 为 false）
+type Spec struct {
+	Supervisord    *SupervisordSpec    `json:"supervisord,omitempty" yaml:"supervisord,omitempty"`           // [supervisord] section // [supervisord] 段
+	UnixHTTPServer *UnixHTTPServerSpec `json:"unix_http_server,omitempty" yaml:"unix_http_server,omitempty"` // [unix_http_server] section // [unix_http_server] 段
+	InetHTTPServer *InetHTTPServerSpec `json:"inet_http_server,omitempty" yaml:"inet_http_server,omitempty"` // [inet_http_server] section // [inet_http_server] 段
+	Supervisorctl  *SupervisorctlSpec  `json:"supervisorctl,omitempty" yaml:"supervisorctl,omitempty"`       // [supervisorctl] section // [supervisorctl] 段
+	Include        []string            `json:"include,omitempty" yaml:"include,omitempty"`                   // [include] file globs // [include] 文件通配
+	Groups         []*GroupSpec        `json:"groups,omitempty" yaml:"groups,omitempty"`                     // Process groups // 进程组
+	Programs       []*ProgramSpec      `json:"programs,omitempty" yaml:"programs,omitempty"`                 // Standalone programs // 独立程序
+}
+
+// ProgramSpec mirror of ProgramConfig
+// ProgramConfig 的镜像
+type ProgramSpec struct {
+	Name           string             `json:"name" yaml:"name"`
+	User           string             `json:"user" yaml:"user"`
+	Directory      string             `json:"directory" yaml:"directory"` // Program root DIR // 程序根目录
+	LogDir         string             `json:"log_dir" yaml:"log_dir"`     // Standard output log root DIR // 标准输出日志根目录
+	Executable     *string            `json:"executable,omitempty" yaml:"executable,omitempty"`
+	BinName        *string            `json:"bin_name,omitempty" yaml:"bin_name,omitempty"`
+	Args           *[]string          `json:"args,omitempty" yaml:"args,omitempty"`
+	Wrapper        *[]string          `json:"wrapper,omitempty" yaml:"wrapper,omitempty"`
+	Environment    *map[string]string `json:"environment,omitempty" yaml:"environment,omitempty"`
+	AutoStart      *bool              `json:"autostart,omitempty" yaml:"autostart,omitempty"`
+	AutoRestart    any                `json:"autorestart,omitempty" yaml:"autorestart,omitempty"` // true, false or "unexpected" // true、false 或 "unexpected"
+	StartRetries   *int               `json:"startretries,omitempty" yaml:"startretries,omitempty"`
+	StartSecs      *int               `json:"startsecs,omitempty" yaml:"startsecs,omitempty"`
+	LogMaxBytes    *string            `json:"logfile_maxbytes,omitempty" yaml:"logfile_maxbytes,omitempty"`
+	LogBackups     *int               `json:"logfile_backups,omitempty" yaml:"logfile_backups,omitempty"`
+	RedirectStderr *bool              `json:"redirect_stderr,omitempty" yaml:"redirect_stderr,omitempty"`
+	StopAsGroup    *bool              `json:"stopasgroup,omitempty" yaml:"stopasgroup,omitempty"`
+	StopWaitSecs   *int               `json:"stopwaitsecs,omitempty" yaml:"stopwaitsecs,omitempty"`
+	KillAsGroup    *bool              `json:"killasgroup,omitempty" yaml:"killasgroup,omitempty"`
+	StopSignal     *string            `json:"stopsignal,omitempty" yaml:"stopsignal,omitempty"`
+	Priority       *int               `json:"priority,omitempty" yaml:"priority,omitempty"`
+	ExitCodes      *[]int             `json:"exitcodes,omitempty" yaml:"exitcodes,omitempty"`
+	NumProcs       *int               `json:"numprocs,omitempty" yaml:"numprocs,omitempty"`
+	ProcessName    *string            `json:"process_name,omitempty" yaml:"process_name,omitempty"`
+	HealthCheck    *HealthCheckSpec   `json:"health_check,omitempty" yaml:"health_check,omitempty"`
+	Ports          *PortsSpec         `json:"ports,omitempty" yaml:"ports,omitempty"`
+}
+
+// HealthCheckSpec mirror of HealthCheck, durations are strings like "10s"
+// HealthCheck 的镜像，时长为 "10s" 这样的字符串
+type HealthCheckSpec struct {
+	Kind      string   `json:"kind" yaml:"kind"` // http, grpc, tcp or exec // http、grpc、tcp 或 exec
+	Address   string   `json:"address,omitempty" yaml:"address,omitempty"`
+	Path      string   `json:"path,omitempty" yaml:"path,omitempty"`
+	Service   string   `json:"service,omitempty" yaml:"service,omitempty"`
+	Command   []string `json:"command,omitempty" yaml:"command,omitempty"`
+	Interval  *string  `json:"interval,omitempty" yaml:"interval,omitempty"`
+	Timeout   *string  `json:"timeout,omitempty" yaml:"timeout,omitempty"`
+	Threshold *int     `json:"threshold,omitempty" yaml:"threshold,omitempty"`
+}
+
+// PortsSpec mirror of PortAllocation
+// PortAllocation 的镜像
+type PortsSpec struct {
+	HTTP    int     `json:"http,omitempty" yaml:"http,omitempty"` // HTTP base port // HTTP 起始端口
+	GRPC    int     `json:"grpc,omitempty" yaml:"grpc,omitempty"` // gRPC base port // gRPC 起始端口
+	Stride  *int    `json:"stride,omitempty" yaml:"stride,omitempty"`
+	Host    *string `json:"host,omitempty" yaml:"host,omitempty"`
+	HTTPEnv *string `json:"http_env,omitempty" yaml:"http_env,omitempty"`
+	GRPCEnv *string `json:"grpc_env,omitempty" yaml:"grpc_env,omitempty"`
+}
+
+// EventListenerSpec mirror of EventListenerConfig, program keys sit next to the listener keys
+// EventListenerConfig 的镜像，程序键与监听器键并列
+type EventListenerSpec struct {
+	ProgramSpec   `yaml:",inline"`
+	Events        []string `json:"events" yaml:"events"`
+	BufferSize    *int     `json:"buffer_size,omitempty" yaml:"buffer_size,omitempty"`
+	ResultHandler *string  `json:"result_handler,omitempty" yaml:"result_handler,omitempty"`
+}
+
+// FcgiProgramSpec mirror of FcgiProgramConfig, program keys sit next to the socket keys
+// FcgiProgramConfig 的镜像，程序键与 socket 键并列
+type FcgiProgramSpec struct {
+	ProgramSpec   `yaml:",inline"`
+	Socket        string  `json:"socket" yaml:"socket"`
+	SocketOwner   *string `json:"socket_owner,omitempty" yaml:"socket_owner,omitempty"`
+	SocketMode    *string `json:"socket_mode,omitempty" yaml:"socket_mode,omitempty"`
+	SocketBacklog *int    `json:"socket_backlog,omitempty" yaml:"socket_backlog,omitempty"`
+}
+
+// GroupSpec mirror of GroupConfig
+// GroupConfig 的镜像
+type GroupSpec struct {
+	Name           string               `json:"name" yaml:"name"`
+	Programs       []*ProgramSpec       `json:"programs" yaml:"programs"`
+	EventListeners []*EventListenerSpec `json:"event_listeners,omitempty" yaml:"event_listeners,omitempty"`
+	FcgiPrograms   []*FcgiProgramSpec   `json:"fcgi_programs,omitempty" yaml:"fcgi_programs,omitempty"`
+	ExpandNumProcs bool                 `json:"expand_numprocs,omitempty" yaml:"expand_numprocs,omitempty"`
+}
+
+// SupervisordSpec mirror of SupervisordConfig
+// SupervisordConfig 的镜像
+type SupervisordSpec struct {
+	Logfile         string             `json:"logfile" yaml:"logfile"`
+	Pidfile         string             `json:"pidfile" yaml:"pidfile"`
+	LogfileMaxBytes *string            `json:"logfile_maxbytes,omitempty" yaml:"logfile_maxbytes,omitempty"`
+	LogfileBackups  *int               `json:"logfile_backups,omitempty" yaml:"logfile_backups,omitempty"`
+	LogLevel        *string            `json:"loglevel,omitempty" yaml:"loglevel,omitempty"`
+	Silent          *bool              `json:"silent,omitempty" yaml:"silent,omitempty"`
+	Nodaemon        *bool              `json:"nodaemon,omitempty" yaml:"nodaemon,omitempty"`
+	Minfds          *int               `json:"minfds,omitempty" yaml:"minfds,omitempty"`
+	Minprocs        *int               `json:"minprocs,omitempty" yaml:"minprocs,omitempty"`
+	Umask           *string            `json:"umask,omitempty" yaml:"umask,omitempty"`
+	User            *string            `json:"user,omitempty" yaml:"user,omitempty"`
+	Identifier      *string            `json:"identifier,omitempty" yaml:"identifier,omitempty"`
+	Directory       *string            `json:"directory,omitempty" yaml:"directory,omitempty"`
+	Nocleanup       *bool              `json:"nocleanup,omitempty" yaml:"nocleanup,omitempty"`
+	Childlogdir     *string            `json:"childlogdir,omitempty" yaml:"childlogdir,omitempty"`
+	StripAnsi       *bool              `json:"strip_ansi,omitempty" yaml:"strip_ansi,omitempty"`
+	Environment     *map[string]string `json:"environment,omitempty" yaml:"environment,omitempty"`
+}
+
+// UnixHTTPServerSpec mirror of UnixHTTPServerConfig
+// UnixHTTPServerConfig 的镜像
+type UnixHTTPServerSpec struct {
+	File     string  `json:"file" yaml:"file"`
+	Chmod    *string `json:"chmod,omitempty" yaml:"chmod,omitempty"`
+	Chown    *string `json:"chown,omitempty" yaml:"chown,omitempty"`
+	Username *string `json:"username,omitempty" yaml:"username,omitempty"`
+	Password *string `json:"password,omitempty" yaml:"password,omitempty"`
+}
+
+// InetHTTPServerSpec mirror of InetHTTPServerConfig
+// InetHTTPServerConfig 的镜像
+type InetHTTPServerSpec struct {
+	Port     string  `json:"port" yaml:"port"`
+	Username *string `json:"username,omitempty" yaml:"username,omitempty"`
+	Password *string `json:"password,omitempty" yaml:"password,omitempty"`
+}
+
+// SupervisorctlSpec mirror of SupervisorctlConfig
+// SupervisorctlConfig 的镜像
+type SupervisorctlSpec struct {
+	ServerURL   string  `json:"serverurl" yaml:"serverurl"`
+	Username    *string `json:"username,omitempty" yaml:"username,omitempty"`
+	Password    *string `json:"password,omitempty" yaml:"password,omitempty"`
+	Prompt      *string `json:"prompt,omitempty" yaml:"prompt,omitempty"`
+	HistoryFile *string `json:"history_file,omitempty" yaml:"history_file,omitempty"`
+}
+
+// LoadSpec read a spec file, ".json" files are JSON and the others YAML
+// 读取 spec 文件，".json" 文件按 JSON 解析，其他按 YAML 解析
+func LoadSpec(path string) (*Spec, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, errors.WithMessagef(err, "read spec %s", path)
+	}
+	if strings.EqualFold(filepath.Ext(path), ".json") {
+		return ParseSpecJSON(data)
+	}
+	return ParseSpecYAML(data)
+}
+
+// ParseSpecYAML parse a YAML spec, unknown keys are errors so typos do not pass silently
+// 解析 YAML spec，未知键会报错，避免拼写错误被静默忽略
+func ParseSpecYAML(data []byte) (*Spec, error) {
+	decoder := yaml.NewDecoder(bytes.NewReader(data))
+	decoder.KnownFields(true)
+	spec := &Spec{}
+	if err := decoder.Decode(spec); err != nil && err != io.EOF {
+		return nil, errors.WithMessage(err, "parse yaml spec")
+	}
+	return spec, nil
+}
+
+// ParseSpecJSON parse a JSON spec, unknown keys are errors so typos do not pass silently
+// 解析 JSON spec，未知键会报错，避免拼写错误被静默忽略
+func ParseSpecJSON(data []byte) (*Spec, error) {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields()
+	spec := &Spec{}
+	if err := decoder.Decode(spec); err != nil {
+		return nil, errors.WithMessage(err, "parse json spec")
+	}
+	return spec, nil
+}
+
+// Deployment supervisor configs built from a Spec
+// 由 Spec 构建的 supervisor 配置
+type Deployment struct {
+	Main     *MainConfig      // supervisord.conf, nil without a supervisord key // supervisord.conf，没有 supervisord 键时为 nil
+	Groups   []*GroupConfig   // Process groups // 进程组
+	Programs []*ProgramConfig // Standalone programs // 独立程序
+}
+
+// Build turn the spec into configs and validate them, returns *ValidationError listing every invalid field
+// 将 spec 转换为配置并校验，返回列出所有无效字段的 *ValidationError
+func (s *Spec) Build() (*Deployment, error) {
+	v := &validator{}
+	res := &Deployment{}
+
+	if s.Supervisord != nil {
+		res.Main = s.buildMain(v)
+	} else if s.UnixHTTPServer != nil || s.InetHTTPServer != nil || s.Supervisorctl != nil || len(s.Include) > 0 {
+		v.add("supervisord", "supervisord", nil, ErrRequired, "supervisord key is required with the other main sections")
+	}
+	for idx, item := range s.Groups {
+		if group := item.build(v, fmt.Sprintf("groups[%d]", idx)); group != nil {
+			res.Groups = append(res.Groups, group)
+		}
+	}
+	for idx, item := range s.Programs {
+		if program := item.build(v, fmt.Sprintf("programs[%d]", idx)); program != nil {
+			res.Programs = append(res.Programs, program)
+		}
+	}
+	if err := v.result(); err != nil {
+		return nil, err
+	}
+
+	// Constructed configs go through the same validation as hand written ones
+	// 构建的配置与手写配置使用相同的校验
+	if res.Main != nil {
+		res.Main.validateFields(v)
+	}
+	for _, group := range res.Groups {
+		group.validateFields(v)
+	}
+	for _, program := range res.Programs {
+		program.validateFields(v, "program:"+program.Name)
+	}
+	if err := v.result(); err != nil {
+		return nil, err
+	}
+	checkConfCollisions(v, res.Groups, res.Programs)
+	if err := v.result(); err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+// checkRequired report empty required keys, the constructors panic on them
+// 报告为空的必填键，构造函数遇到空值会 panic
+func checkRequired(v *validator, section string, items map[string]string) bool {
+	res := true
+	for _, key := range sortedKeys(items) {
+		if items[key] == "" {
+			v.add(section, key, "", ErrRequired, "%s is required", key)
+			res = false
+		}
+	}
+	return res
+}
+
+func setOpt[T any](opt *Opt[T], value *T) {
+	if value != nil {
+		opt.Set(*value)
+	}
+}
+
+func (s *Spec) buildMain(v *validator) *MainConfig {
+	spec := s.Supervisord
+	if !checkRequired(v, "supervisord", map[string]string{"logfile": spec.Logfile, "pidfile": spec.Pidfile}) {
+		return nil
+	}
+	supervisord := NewSupervisordConfig(spec.Logfile, spec.Pidfile)
+	setOpt(supervisord.LogfileMaxBytes, spec.LogfileMaxBytes)
+	setOpt(supervisord.LogfileBackups, spec.LogfileBackups)
+	setOpt(supervisord.LogLevel, spec.LogLevel)
+	setOpt(supervisord.Silent, spec.Silent)
+	setOpt(supervisord.Nodaemon, spec.Nodaemon)
+	setOpt(supervisord.Minfds, spec.Minfds)
+	setOpt(supervisord.Minprocs, spec.Minprocs)
+	setOpt(supervisord.Umask, spec.Umask)
+	setOpt(supervisord.User, spec.User)
+	setOpt(supervisord.Identifier, spec.Identifier)
+	setOpt(supervisord.Directory, spec.Directory)
+	setOpt(supervisord.Nocleanup, spec.Nocleanup)
+	setOpt(supervisord.Childlogdir, spec.Childlogdir)
+	setOpt(supervisord.StripAnsi, spec.StripAnsi)
+	setOpt(supervisord.Environment, spec.Environment)
+	res := NewMainConfig(supervisord).WithInclude(s.Include...)
+
+	if spec := s.UnixHTTPServer; spec != nil && checkRequired(v, "unix_http_server", map[string]string{"file": spec.File}) {
+		config := NewUnixHTTPServerConfig(spec.File)
+		setOpt(config.Chmod, spec.Chmod)
+		setOpt(config.Chown, spec.Chown)
+		setOpt(config.Username, spec.Username)
+		setOpt(config.Password, spec.Password)
+		res.WithUnixHTTPServer(config)
+	}
+	if spec := s.InetHTTPServer; spec != nil && checkRequired(v, "inet_http_server", map[string]string{"port": spec.Port}) {
+		config := NewInetHTTPServerConfig(spec.Port)
+		setOpt(config.Username, spec.Username)
+		setOpt(config.Password, spec.Password)
+		res.WithInetHTTPServer(config)
+	}
+	if spec := s.Supervisorctl; spec != nil && checkRequired(v, "supervisorctl", map[string]string{"serverurl": spec.ServerURL}) {
+		config := NewSupervisorctlConfig(spec.ServerURL)
+		setOpt(config.Username, spec.Username)
+		setOpt(config.Password, spec.Password)
+		setOpt(config.Prompt, spec.Prompt)
+		setOpt(config.HistoryFile, spec.HistoryFile)
+		res.WithSupervisorctl(config)
+	}
+	return res
+}
+
+func (s *GroupSpec) build(v *validator, section string) *GroupConfig {
+	if s == nil {
+		v.add(section, "group", nil, ErrRequired, "group is empty")
+		return nil
+	}
+	if !checkRequired(v, section, map[string]string{"name": s.Name}) {
+		return nil
+	}
+	res := NewGroupConfig(s.Name).WithExpandNumProcs(s.ExpandNumProcs)
+	for idx, item := range s.Programs {
+		if program := item.build(v, fmt.Sprintf("%s.programs[%d]", section, idx)); program != nil {
+			res.AddProgram(program)
+		}
+	}
+	for idx, item := range s.EventListeners {
+		itemSection := fmt.Sprintf("%s.event_listeners[%d]", section, idx)
+		if item == nil {
+			v.add(itemSection, "event_listener", nil, ErrRequired, "event listener is empty")
+			continue
+		}
+		program := item.ProgramSpec.build(v, itemSection)
+		if len(item.Events) == 0 {
+			v.add(itemSection, "events", nil, ErrRequired, "events is required")
+			continue
+		}
+		if program == nil {
+			continue
+		}
+		events := make([]EventType, 0, len(item.Events))
+		for _, event := range item.Events {
+			events = append(events, EventType(event))
+		}
+		listener := &EventListenerConfig{ProgramConfig: program, Events: events, BufferSize: NewOpt(10), ResultHandler: NewOpt("supervisor.dispatchers:default_handler")}
+		setOpt(listener.BufferSize, item.BufferSize)
+		setOpt(listener.ResultHandler, item.ResultHandler)
+		res.AddEventListener(listener)
+	}
+	for idx, item := range s.FcgiPrograms {
+		itemSection := fmt.Sprintf("%s.fcgi_programs[%d]", section, idx)
+		if item == nil {
+			v.add(itemSection, "fcgi_program", nil, ErrRequired, "fcgi program is empty")
+			continue
+		}
+		program := item.ProgramSpec.build(v, itemSection)
+		if !checkRequired(v, itemSection, map[string]string{"socket": item.Socket}) || program == nil {
+			continue
+		}
+		fcgi := &FcgiProgramConfig{ProgramConfig: program, Socket: item.Socket, SocketOwner: NewOpt(""), SocketMode: NewOpt("0700"), SocketBacklog: NewOpt(128)}
+		setOpt(fcgi.SocketOwner, item.SocketOwner)
+		setOpt(fcgi.SocketMode, item.SocketMode)
+		setOpt(fcgi.SocketBacklog, item.SocketBacklog)
+		res.AddFcgiProgram(fcgi)
+	}
+	return res
+}
+
+func (s *ProgramSpec) build(v *validator, section string) *ProgramConfig {
+	if s == nil {
+		v.add(section, "program", nil, ErrRequired, "program is empty")
+		return nil
+	}
+	if !checkRequired(v, section, map[string]string{"name": s.Name, "user": s.User, "directory": s.Directory, "log_dir": s.LogDir}) {
+		return nil
+	}
+	res := NewProgramConfig(s.Name, s.Directory, s.User, s.LogDir)
+	setOpt(res.Executable, s.Executable)
+	setOpt(res.BinName, s.BinName)
+	setOpt(res.Args, s.Args)
+	setOpt(res.Wrapper, s.Wrapper)
+	setOpt(res.Environment, s.Environment)
+	setOpt(res.AutoStart, s.AutoStart)
+	if s.AutoRestart != nil {
+		res.AutoRestart.Set(s.AutoRestart)
+	}
+	setOpt(res.StartRetries, s.StartRetries)
+	setOpt(res.StartSecs, s.StartSecs)
+	setOpt(res.LogMaxBytes, s.LogMaxBytes)
+	setOpt(res.LogBackups, s.LogBackups)
+	setOpt(res.RedirectStderr, s.RedirectStderr)
+	setOpt(res.StopAsGroup, s.StopAsGroup)
+	setOpt(res.StopWaitSecs, s.StopWaitSecs)
+	setOpt(res.KillAsGroup, s.KillAsGroup)
+	setOpt(res.StopSignal, s.StopSignal)
+	setOpt(res.Priority, s.Priority)
+	setOpt(res.ExitCodes, s.ExitCodes)
+	setOpt(res.NumProcs, s.NumProcs)
+	setOpt(res.ProcessName, s.ProcessName)
+
+	if spec := s.HealthCheck; spec != nil {
+		check := newHealthCheck(HealthCheckKind(spec.Kind), spec.Address)
+		check.Path = spec.Path
+		check.Service = spec.Service
+		check.Command = spec.Command
+		for _, item := range []struct {
+			key   string
+			value *string
+			out   *time.Duration
+		}{
+			{"health_check.interval", spec.Interval, &check.Interval},
+			{"health_check.timeout", spec.Timeout, &check.Timeout},
+		} {
+			if item.value == nil {
+				continue
+			}
+			duration, err := time.ParseDuration(*item.value)
+			if err != nil {
+				v.add(section, item.key, *item.value, ErrInvalidValue, "expect a duration like \"10s\"")
+				continue
+			}
+			*item.out = duration
+		}
+		if spec.Threshold != nil {
+			check.Threshold = *spec.Threshold
+		}
+		res.HealthCheck = check
+	}
+	if spec := s.Ports; spec != nil {
+		ports := NewPortAllocation(spec.HTTP, spec.GRPC)
+		for _, item := range []struct {
+			value *string
+			out   *string
+		}{
+			{spec.Host, &ports.Host},
+			{spec.HTTPEnv, &ports.HTTPEnv},
+			{spec.GRPCEnv, &ports.GRPCEnv},
+		} {
+			if item.value != nil {
+				*item.out = *item.value
+			}
+		}
+		if spec.Stride != nil {
+			ports.Stride = *spec.Stride
+		}
+		res.Ports = ports
+	}
+	return res
+}
@@ -0,0 +1,171 @@
+package supervisorkratos_test
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/orzkratos/supervisorkratos"
+	"github.com/stretchr/testify/require"
+)
+
+const specYAML = `
+supervisord:
+  logfile: /var/log/supervisor/supervisord.log
+  pidfile: /var/run/supervisord.pid
+  nodaemon: true
+unix_http_server:
+  file: /var/run/supervisor.sock
+supervisorctl:
+  serverurl: unix:///var/run/supervisor.sock
+include:
+  - /etc/supervisor/conf.d/*.conf
+groups:
+  - name: services
+    programs:
+      - name: api
+        user: deploy
+        directory: /opt/api
+        log_dir: /var/log/services
+        args: [-conf, /opt/api/configs]
+        autorestart: unexpected
+        startsecs: 1
+        numprocs: 2
+        process_name: "%(program_name)s_%(process_num)d"
+        health_check:
+          kind: http
+          address: 127.0.0.1:8000
+          path: /healthz
+          interval: 30s
+        ports:
+          http: 8000
+          grpc: 9000
+    event_listeners:
+      - name: crashmail
+        user: deploy
+        directory: /opt/crashmail
+        log_dir: /var/log/services
+        events: [PROCESS_STATE_EXITED]
+programs:
+  - name: worker
+    user: deploy
+    directory: /opt/worker
+    log_dir: /var/log/services
+    autostart: false
+`
+
+func TestSpecYAML(t *testing.T) {
+	// Test a YAML spec builds into main, group and program configs with present keys marked as set
+	// 测试 YAML spec 构建为主配置、组配置和程序配置，存在的键被标记为已设置
+	spec, err := supervisorkratos.ParseSpecYAML([]byte(specYAML))
+	require.NoError(t, err)
+	deployment, err := spec.Build()
+	require.NoError(t, err)
+
+	require.NotNil(t, deployment.Main)
+	require.True(t, deployment.Main.Supervisord.Nodaemon.IsSet())
+	require.False(t, deployment.Main.Supervisord.Minfds.IsSet())
+	require.Equal(t, []string{"/etc/supervisor/conf.d/*.conf"}, deployment.Main.IncludeFiles)
+	require.Contains(t, supervisorkratos.GenerateMainConfig(deployment.Main), "nodaemon")
+
+	require.Len(t, deployment.Groups, 1)
+	api := deployment.Groups[0].Programs[0]
+	require.Equal(t, "unexpected", api.AutoRestart.Get())
+	require.True(t, api.StartSecs.IsSet()) // Present with the default value is still set // 值等于默认值时仍为已设置
+	require.False(t, api.StartRetries.IsSet())
+	require.Equal(t, 30*time.Second, api.HealthCheck.Interval)
+	require.Equal(t, 5*time.Second, api.HealthCheck.Timeout)
+	require.Equal(t, 9001, api.Ports.GRPCPort(1))
+	require.Equal(t, []supervisorkratos.EventType{supervisorkratos.EventProcessStateExited}, deployment.Groups[0].EventListeners[0].Events)
+
+	config := supervisorkratos.GenerateGroupConfig(deployment.Groups[0])
+	require.Contains(t, config, "command         = /opt/api/bin/api -conf /opt/api/configs")
+	require.Contains(t, config, "startsecs       = 1")
+	require.Contains(t, config, "[eventlistener:crashmail]")
+
+	require.Len(t, deployment.Programs, 1)
+	require.False(t, deployment.Programs[0].AutoStart.Get())
+	require.True(t, deployment.Programs[0].AutoStart.IsSet())
+}
+
+func TestSpecJSON(t *testing.T) {
+	// Test JSON specs load by extension and autorestart takes a boolean
+	// 测试 JSON spec 按扩展名加载，autorestart 可以是布尔值
+	path := filepath.Join(t.TempDir(), "deploy.json")
+	require.NoError(t, os.WriteFile(path, []byte(`{
+  "programs": [
+    {"name": "api", "user": "deploy", "directory": "/opt/api", "log_dir": "/var/log/services", "autorestart": false, "exitcodes": [0, 2]}
+  ]
+}`), 0644))
+	spec, err := supervisorkratos.LoadSpec(path)
+	require.NoError(t, err)
+	deployment, err := spec.Build()
+	require.NoError(t, err)
+	require.Nil(t, deployment.Main)
+	require.Equal(t, false, deployment.Programs[0].AutoRestart.Get())
+	require.Equal(t, []int{0, 2}, deployment.Programs[0].ExitCodes.Get())
+}
+
+func TestSpecErrors(t *testing.T) {
+	// Test unknown keys, missing required keys and invalid values are reported
+	// 测试报告未知键、缺少必填键和无效值
+	_, err := supervisorkratos.ParseSpecYAML([]byte("programs:\n  - name: api\n    autostrat: true\n"))
+	require.ErrorContains(t, err, "autostrat")
+	_, err = supervisorkratos.ParseSpecJSON([]byte(`{"program": []}`))
+	require.ErrorContains(t, err, "program")
+
+	spec, err := supervisorkratos.ParseSpecYAML([]byte("programs:\n  - name: api\n    user: deploy\n"))
+	require.NoError(t, err)
+	_, err = spec.Build()
+	require.ErrorIs(t, err, supervisorkratos.ErrRequired)
+	require.ErrorContains(t, err, "directory")
+
+	spec, err = supervisorkratos.ParseSpecYAML([]byte("programs:\n  - {name: api, user: deploy, directory: /opt/api, log_dir: /var/log, autorestart: 3, health_check: {kind: tcp, address: 127.0.0.1:80, interval: soon}}\n"))
+	require.NoError(t, err)
+	_, err = spec.Build()
+	require.ErrorIs(t, err, supervisorkratos.ErrInvalidValue)
+
+	spec, err = supervisorkratos.ParseSpecYAML([]byte("programs:\n  - {name: api, user: deploy, directory: /opt/api, log_dir: /var/log, autorestart: 3}\n"))
+	require.NoError(t, err)
+	_, err = spec.Build()
+	require.ErrorIs(t, err, supervisorkratos.ErrInvalidType)
+
+	// Errors of the main config and the programs are reported together
+	// 主配置和程序的错误会一起报告
+	spec, err = supervisorkratos.ParseSpecYAML([]byte("supervisord: {logfile: /var/log/supervisord.log, pidfile: /var/run/supervisord.pid, loglevel: loud}\n" +
+		"programs:\n  - {name: api, user: deploy, directory: /opt/api, log_dir: /var/log, stopsignal: BOOM}\n"))
+	require.NoError(t, err)
+	_, err = spec.Build()
+	var validationErr *supervisorkratos.ValidationError
+	require.ErrorAs(t, err, &validationErr)
+	require.Len(t, validationErr.Section("supervisord"), 1)
+	require.Len(t, validationErr.Section("program:api"), 1)
+
+	// A program in a group and on its own would be merged into one section by supervisor
+	// 同时位于组中和单独存在的程序会被 supervisor 合并为一个段
+	spec, err = supervisorkratos.ParseSpecYAML([]byte("groups:\n  - name: services\n    programs:\n      - {name: api, user: deploy, directory: /opt/api, log_dir: /var/log}\n" +
+		"programs:\n  - {name: api, user: deploy, directory: /opt/api, log_dir: /var/log}\n"))
+	require.NoError(t, err)
+	_, err = spec.Build()
+	require.ErrorIs(t, err, supervisorkratos.ErrDuplicate)
+	require.ErrorContains(t, err, "[program:api]")
+}
+
+func TestSpecJSONSchema(t *testing.T) {
+	// Test the schema is valid JSON with required keys and closed objects
+	// 测试 schema 是有效的 JSON，包含必填键且对象不允许额外键
+	var schema map[string]any
+	require.NoError(t, json.Unmarshal(supervisorkratos.SpecJSONSchema(), &schema))
+	require.Equal(t, false, schema["additionalProperties"])
+
+	properties := schema["properties"].(map[string]any)
+	program := properties["programs"].(map[string]any)["items"].(map[string]any)
+	require.Equal(t, []any{"name", "user", "directory", "log_dir"}, program["required"])
+	require.Contains(t, program["properties"], "health_check")
+
+	listener := properties["groups"].(map[string]any)["items"].(map[string]any)["properties"].(map[string]any)["event_listeners"].(map[string]any)["items"].(map[string]any)
+	require.Contains(t, listener["properties"], "numprocs")
+	require.Contains(t, listener["required"], "events")
+}
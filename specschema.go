@@ -0,0 +1,96 @@
+package supervisorkratos
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+
+	"github.com/yyle88/must"
+)
+
+// SpecJSONSchema JSON Schema (draft 2020-12) of spec files, point editors at it to validate YAML and JSON specs
+// Keys without omitempty are required, unknown keys are rejected the same way ParseSpecYAML and ParseSpecJSON do
+//
+// spec 文件的 JSON Schema（draft 2020-12），在编辑器中引用它来校验 YAML 和 JSON spec
+// 没有 omitempty 的键为必填，未知键会被拒绝，与 ParseSpecYAML 和 ParseSpecJSON 一致
+func SpecJSONSchema() []byte {
+	schema := jsonSchemaOf(reflect.TypeOf(Spec{}), "")
+	schema["$schema"] = "https://json-schema.org/draft/2020-12/schema"
+	schema["title"] = "supervisorkratos deployment spec"
+	return must.V1(json.MarshalIndent(schema, "", "  "))
+}
+
+// schemaEnums allowed values of spec fields, keyed by "Type.Field"
+// spec 字段的允许值，以 "类型.字段" 为键
+var schemaEnums = map[string][]any{
+	"HealthCheckSpec.Kind":     {string(HealthCheckHTTP), string(HealthCheckGRPC), string(HealthCheckTCP), string(HealthCheckExec)},
+	"EventListenerSpec.Events": eventTypeValues(),
+	"ProgramSpec.AutoRestart":  {true, false, "true", "false", "unexpected"},
+	"SupervisordSpec.LogLevel": {"critical", "error", "warn", "info", "debug", "trace", "blather"},
+}
+
+func eventTypeValues() []any {
+	res := make([]any, 0, len(EventTypes))
+	for _, event := range EventTypes {
+		res = append(res, string(event))
+	}
+	return res
+}
+
+// jsonSchemaOf schema of t, field is the "Type.Field" key of schemaEnums
+// t 的 schema，field 是 schemaEnums 的 "类型.字段" 键
+func jsonSchemaOf(t reflect.Type, field string) map[string]any {
+	if t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	var res map[string]any
+	switch t.Kind() {
+	case reflect.String:
+		res = map[string]any{"type": "string"}
+	case reflect.Int:
+		res = map[string]any{"type": "integer"}
+	case reflect.Bool:
+		res = map[string]any{"type": "boolean"}
+	case reflect.Interface:
+		res = map[string]any{"type": []string{"boolean", "string"}} // Only autorestart takes either // 只有 autorestart 两者皆可
+	case reflect.Slice:
+		return map[string]any{"type": "array", "items": jsonSchemaOf(t.Elem(), field)}
+	case reflect.Map:
+		return map[string]any{"type": "object", "additionalProperties": jsonSchemaOf(t.Elem(), "")}
+	case reflect.Struct:
+		properties := make(map[string]any)
+		var required []string
+		collectSchemaProperties(t, properties, &required)
+		res = map[string]any{"type": "object", "properties": properties, "additionalProperties": false}
+		if len(required) > 0 {
+			res["required"] = required
+		}
+		return res
+	default:
+		panic("unsupported spec field type " + t.String())
+	}
+	if values, ok := schemaEnums[field]; ok {
+		res["enum"] = values
+	}
+	return res
+}
+
+// collectSchemaProperties add the json keys of t, embedded structs add their keys inline
+// 添加 t 的 json 键，嵌入的结构体在同一层添加其键
+func collectSchemaProperties(t reflect.Type, properties map[string]any, required *[]string) {
+	for idx := range t.NumField() {
+		field := t.Field(idx)
+		if field.Anonymous {
+			collectSchemaProperties(field.Type, properties, required)
+			continue
+		}
+		name, options, _ := strings.Cut(field.Tag.Get("json"), ",")
+		if name == "" || name == "-" {
+			continue
+		}
+		properties[name] = jsonSchemaOf(field.Type, t.Name()+"."+field.Name)
+		if !strings.Contains(options, "omitempty") {
+			*required = append(*required, name)
+		}
+	}
+}
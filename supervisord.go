@@ -0,0 +1,353 @@
+package supervisorkratos
+
+import (
+	"fmt"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/yyle88/must"
+	"github.com/yyle88/printgo"
+)
+
+// SupervisordConfig [supervisord] main section configuration
+// [supervisord] 主段配置
+type SupervisordConfig struct {
+	// Required paths // 必填路径
+	Logfile string // Activity log file path // 活动日志文件路径
+	Pidfile string // Pid file path // pid 文件路径
+
+	// Log settings // 日志设置
+	LogfileMaxBytes *Opt[string] // Max activity log file size // 活动日志文件最大大小
+	LogfileBackups  *Opt[int]    // Activity log backup files count // 活动日志备份文件数量
+	LogLevel        *Opt[string] // Log level: critical/error/warn/info/debug/trace/blather // 日志级别
+	Silent          *Opt[bool]   // Do not print log to stdout in foreground // 前台运行时不输出日志到 stdout
+
+	// Process settings // 进程设置
+	Nodaemon   *Opt[bool]   // Run in foreground // 在前台运行
+	Minfds     *Opt[int]    // Min file descriptors available // 最少可用文件描述符数量
+	Minprocs   *Opt[int]    // Min process descriptors available // 最少可用进程描述符数量
+	Umask      *Opt[string] // Umask in octal // 八进制 umask
+	User       *Opt[string] // Switch to this user after start // 启动后切换到的用户
+	Identifier *Opt[string] // Identifier string for RPC interface // RPC 接口的标识字符串
+	Directory  *Opt[string] // Chdir to this DIR when daemonized // 守护进程化时切换到的目录
+
+	// Child process settings // 子进程设置
+	Nocleanup   *Opt[bool]              // Do not clear AUTO child log files on start // 启动时不清理 AUTO 子进程日志文件
+	Childlogdir *Opt[string]            // DIR for AUTO child log files // AUTO 子进程日志文件目录
+	StripAnsi   *Opt[bool]              // Strip ANSI escape sequences from child logs // 去除子进程日志中的 ANSI 转义序列
+	Environment *Opt[map[string]string] // Environment variables for child processes // 子进程的环境变量
+}
+
+// NewSupervisordConfig create new SupervisordConfig with required log and pid file paths
+// 创建新的 SupervisordConfig，需要提供日志文件和 pid 文件路径
+func NewSupervisordConfig(logfile string, pidfile string) *SupervisordConfig {
+	return &SupervisordConfig{
+		// Required paths // 必填路径
+		Logfile: must.Nice(logfile),
+		Pidfile: must.Nice(pidfile),
+
+		// Set supervisor official default values
+		// 设置 supervisor 官方默认值
+
+		// Log settings // 日志设置
+		LogfileMaxBytes: NewOpt("50MB"),
+		LogfileBackups:  NewOpt(10),
+		LogLevel:        NewOpt("info"),
+		Silent:          NewOpt(false),
+
+		// Process settings // 进程设置
+		Nodaemon:   NewOpt(false),
+		Minfds:     NewOpt(1024),
+		Minprocs:   NewOpt(200),
+		Umask:      NewOpt("022"),
+		User:       NewOpt(""),
+		Identifier: NewOpt("supervisor"),
+		Directory:  NewOpt(""),
+
+		// Child process settings // 子进程设置
+		Nocleanup:   NewOpt(false),
+		Childlogdir: NewOpt(""),
+		StripAnsi:   NewOpt(false),
+		Environment: NewOpt(make(map[string]string)),
+	}
+}
+
+// SupervisordConfig chain methods for configuration customization
+// SupervisordConfig 链式配置方法
+
+// WithLogfileMaxBytes set activity log file max bytes
+// 设置活动日志文件最大字节数
+func (c *SupervisordConfig) WithLogfileMaxBytes(logfileMaxBytes string) *SupervisordConfig {
+	c.LogfileMaxBytes.Set(logfileMaxBytes)
+	return c
+}
+
+// WithLogfileBackups set activity log backup count
+// 设置活动日志备份文件数量
+func (c *SupervisordConfig) WithLogfileBackups(logfileBackups int) *SupervisordConfig {
+	c.LogfileBackups.Set(logfileBackups)
+	return c
+}
+
+// WithLogLevel set log level
+// 设置日志级别
+func (c *SupervisordConfig) WithLogLevel(logLevel string) *SupervisordConfig {
+	c.LogLevel.Set(logLevel)
+	return c
+}
+
+// WithSilent set silent flag
+// 设置静默标志
+func (c *SupervisordConfig) WithSilent(silent bool) *SupervisordConfig {
+	c.Silent.Set(silent)
+	return c
+}
+
+// WithNodaemon set run in foreground flag
+// 设置前台运行标志
+func (c *SupervisordConfig) WithNodaemon(nodaemon bool) *SupervisordConfig {
+	c.Nodaemon.Set(nodaemon)
+	return c
+}
+
+// WithMinfds set min file descriptors
+// 设置最少文件描述符数量
+func (c *SupervisordConfig) WithMinfds(minfds int) *SupervisordConfig {
+	c.Minfds.Set(minfds)
+	return c
+}
+
+// WithMinprocs set min process descriptors
+// 设置最少进程描述符数量
+func (c *SupervisordConfig) WithMinprocs(minprocs int) *SupervisordConfig {
+	c.Minprocs.Set(minprocs)
+	return c
+}
+
+// WithUmask set umask in octal, e.g. "022"
+// 设置八进制 umask，例如 "022"
+func (c *SupervisordConfig) WithUmask(umask string) *SupervisordConfig {
+	c.Umask.Set(umask)
+	return c
+}
+
+// WithUser set user to switch to after start
+// 设置启动后切换到的用户
+func (c *SupervisordConfig) WithUser(user string) *SupervisordConfig {
+	c.User.Set(user)
+	return c
+}
+
+// WithIdentifier set identifier string for RPC interface
+// 设置 RPC 接口的标识字符串
+func (c *SupervisordConfig) WithIdentifier(identifier string) *SupervisordConfig {
+	c.Identifier.Set(identifier)
+	return c
+}
+
+// WithDirectory set DIR to chdir to when daemonized
+// 设置守护进程化时切换到的目录
+func (c *SupervisordConfig) WithDirectory(directory string) *SupervisordConfig {
+	c.Directory.Set(directory)
+	return c
+}
+
+// WithNocleanup set no cleanup flag
+// 设置不清理标志
+func (c *SupervisordConfig) WithNocleanup(nocleanup bool) *SupervisordConfig {
+	c.Nocleanup.Set(nocleanup)
+	return c
+}
+
+// WithChildlogdir set DIR for AUTO child log files
+// 设置 AUTO 子进程日志文件目录
+func (c *SupervisordConfig) WithChildlogdir(childlogdir string) *SupervisordConfig {
+	c.Childlogdir.Set(childlogdir)
+	return c
+}
+
+// WithStripAnsi set strip ANSI flag
+// 设置去除 ANSI 标志
+func (c *SupervisordConfig) WithStripAnsi(stripAnsi bool) *SupervisordConfig {
+	c.StripAnsi.Set(stripAnsi)
+	return c
+}
+
+// WithEnvironment set environment variables for child processes
+// 设置子进程的环境变量
+func (c *SupervisordConfig) WithEnvironment(environment map[string]string) *SupervisordConfig {
+	c.Environment.Set(environment)
+	return c
+}
+
+// supervisordLogLevels log levels accepted by supervisord
+// supervisord 接受的日志级别
+var supervisordLogLevels = []string{"critical", "error", "warn", "info", "debug", "trace", "blather"}
+
+// Validate check supervisord config and return *ValidationError listing every invalid field
+// 校验 supervisord 配置，返回列出每个无效字段的 *ValidationError
+func (c *SupervisordConfig) Validate() error {
+	v := &validator{}
+	c.validateFields(v)
+	return v.result()
+}
+
+func (c *SupervisordConfig) validateFields(v *validator) {
+	const section = "supervisord"
+	if c == nil {
+		v.add(section, "SupervisordConfig", nil, ErrRequired, "nil config")
+		return
+	}
+	checkAbsPath(v, section, "Logfile", c.Logfile)
+	checkAbsPath(v, section, "Pidfile", c.Pidfile)
+
+	options := []struct {
+		field string
+		isNil bool
+	}{
+		{"LogfileMaxBytes", c.LogfileMaxBytes == nil},
+		{"LogfileBackups", c.LogfileBackups == nil},
+		{"LogLevel", c.LogLevel == nil},
+		{"Silent", c.Silent == nil},
+		{"Nodaemon", c.Nodaemon == nil},
+		{"Minfds", c.Minfds == nil},
+		{"Minprocs", c.Minprocs == nil},
+		{"Umask", c.Umask == nil},
+		{"User", c.User == nil},
+		{"Identifier", c.Identifier == nil},
+		{"Directory", c.Directory == nil},
+		{"Nocleanup", c.Nocleanup == nil},
+		{"Childlogdir", c.Childlogdir == nil},
+		{"StripAnsi", c.StripAnsi == nil},
+		{"Environment", c.Environment == nil},
+	}
+	missing := false
+	for _, option := range options {
+		if option.isNil {
+			v.add(section, option.field, nil, ErrRequired, "option is nil, create config with NewSupervisordConfig")
+			missing = true
+		}
+	}
+	if missing {
+		return
+	}
+
+	if _, err := ParseByteSize(c.LogfileMaxBytes.Get()); err != nil {
+		v.add(section, "LogfileMaxBytes", c.LogfileMaxBytes.Get(), ErrInvalidValue, "%s", err.Error())
+	}
+	checkMinInt(v, section, "LogfileBackups", c.LogfileBackups.Get(), 0)
+	if !slices.Contains(supervisordLogLevels, c.LogLevel.Get()) {
+		v.add(section, "LogLevel", c.LogLevel.Get(), ErrInvalidValue, "expect one of %s", strings.Join(supervisordLogLevels, ", "))
+	}
+	checkMinInt(v, section, "Minfds", c.Minfds.Get(), 1)
+	checkMinInt(v, section, "Minprocs", c.Minprocs.Get(), 1)
+	if umask, err := strconv.ParseUint(c.Umask.Get(), 8, 32); err != nil || umask > 0o777 {
+		v.add(section, "Umask", c.Umask.Get(), ErrInvalidValue, "expect octal umask like \"022\"")
+	}
+	if c.User.IsSet() && (c.User.Get() == "" || strings.ContainsAny(c.User.Get(), " \t\n:")) {
+		v.add(section, "User", c.User.Get(), ErrInvalidValue, "user name must be non-empty without blanks or \":\"")
+	}
+	if c.Identifier.Get() == "" || strings.ContainsAny(c.Identifier.Get(), " \t\n") {
+		v.add(section, "Identifier", c.Identifier.Get(), ErrInvalidValue, "identifier must be non-empty without blanks")
+	}
+	if c.Directory.IsSet() {
+		checkAbsPath(v, section, "Directory", c.Directory.Get())
+	}
+	if c.Childlogdir.IsSet() {
+		checkAbsPath(v, section, "Childlogdir", c.Childlogdir.Get())
+	}
+	checkEnvironment(v, section, c.Environment.Get())
+}
+
+// GenerateSupervisordConfig generate [supervisord] section, panics on invalid config
+// 生成 [supervisord] 段，配置无效时 panic
+func GenerateSupervisordConfig(config *SupervisordConfig) string {
+	return must.V1(GenerateSupervisordConfigE(config))
+}
+
+// GenerateSupervisordConfigE generate [supervisord] section
+// Returns *ValidationError listing every invalid field
+//
+// 生成 [supervisord] 段
+// 返回列出所有无效字段的 *ValidationError
+func GenerateSupervisordConfigE(config *SupervisordConfig) (string, error) {
+	if err := config.Validate(); err != nil {
+		return "", err
+	}
+	return renderSupervisordConfig(config), nil
+}
+
+func renderSupervisordConfig(config *SupervisordConfig) string {
+	ptx := printgo.NewPTX()
+
+	ptx.Println("[supervisord]")
+	ptx.Println(iniLine("logfile", config.Logfile))
+	if config.LogfileMaxBytes.IsSet() {
+		ptx.Println(iniLine("logfile_maxbytes", config.LogfileMaxBytes.Get()))
+	}
+	if config.LogfileBackups.IsSet() {
+		ptx.Println(iniLine("logfile_backups", strconv.Itoa(config.LogfileBackups.Get())))
+	}
+	if config.LogLevel.IsSet() {
+		ptx.Println(iniLine("loglevel", config.LogLevel.Get()))
+	}
+	if config.Silent.IsSet() {
+		ptx.Println(iniLine("silent", strconv.FormatBool(config.Silent.Get())))
+	}
+	ptx.Println(iniLine("pidfile", config.Pidfile))
+
+	// Only print explicitly set values (user configured)
+	// 只打印显式设置的值（用户配置的）
+	if config.Nodaemon.IsSet() {
+		ptx.Println(iniLine("nodaemon", strconv.FormatBool(config.Nodaemon.Get())))
+	}
+	if config.Minfds.IsSet() {
+		ptx.Println(iniLine("minfds", strconv.Itoa(config.Minfds.Get())))
+	}
+	if config.Minprocs.IsSet() {
+		ptx.Println(iniLine("minprocs", strconv.Itoa(config.Minprocs.Get())))
+	}
+	if config.Umask.IsSet() {
+		ptx.Println(iniLine("umask", config.Umask.Get()))
+	}
+	if config.User.IsSet() {
+		ptx.Println(iniLine("user", config.User.Get()))
+	}
+	if config.Identifier.IsSet() {
+		ptx.Println(iniLine("identifier", config.Identifier.Get()))
+	}
+	if config.Directory.IsSet() {
+		ptx.Println(iniLine("directory", config.Directory.Get()))
+	}
+	if config.Nocleanup.IsSet() {
+		ptx.Println(iniLine("nocleanup", strconv.FormatBool(config.Nocleanup.Get())))
+	}
+	if config.Childlogdir.IsSet() {
+		ptx.Println(iniLine("childlogdir", config.Childlogdir.Get()))
+	}
+	if config.StripAnsi.IsSet() {
+		ptx.Println(iniLine("strip_ansi", strconv.FormatBool(config.StripAnsi.Get())))
+	}
+	if config.Environment.IsSet() {
+		if env := combineEnvironment(config.Environment.Get(), ","); env != "" {
+			ptx.Println(iniLine("environment", env))
+		}
+	}
+	return ptx.String()
+}
+
+// iniLine format "key = value" line aligned the same way as program sections
+// 按与程序段相同的对齐方式格式化 "key = value" 行
+func iniLine(key string, value string) string {
+	return fmt.Sprintf("%-15s = %s", key, value)
+}
+
+func checkAbsPath(v *validator, section string, field string, path string) {
+	if path == "" {
+		v.add(section, field, path, ErrRequired, "path is empty")
+	} else if !filepath.IsAbs(path) {
+		v.add(section, field, path, ErrInvalidValue, "path must be absolute")
+	}
+}
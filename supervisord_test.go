@@ -0,0 +1,113 @@
+package supervisorkratos_test
+
+import (
+	"testing"
+
+	"github.com/orzkratos/supervisorkratos"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSupervisordConfig(t *testing.T) {
+	// Test [supervisord] section with customized settings
+	// 测试自定义设置的 [supervisord] 段
+	config := supervisorkratos.NewSupervisordConfig(
+		"/var/log/supervisor/supervisord.log",
+		"/var/run/supervisord.pid",
+	).WithLogfileMaxBytes("100MB").
+		WithLogfileBackups(5).
+		WithLogLevel("warn").
+		WithNodaemon(true).
+		WithMinfds(65535).
+		WithMinprocs(400).
+		WithUmask("027").
+		WithUser("root").
+		WithIdentifier("kratos-host").
+		WithChildlogdir("/var/log/supervisor").
+		WithEnvironment(map[string]string{
+			"TZ":   "Asia/Shanghai",
+			"LANG": "en_US.UTF-8",
+		})
+
+	content := supervisorkratos.GenerateSupervisordConfig(config)
+	t.Log("=== Supervisord configuration ===")
+	t.Log(content)
+
+	const expected = `[supervisord]
+logfile         = /var/log/supervisor/supervisord.log
+logfile_maxbytes = 100MB
+logfile_backups = 5
+loglevel        = warn
+pidfile         = /var/run/supervisord.pid
+nodaemon        = true
+minfds          = 65535
+minprocs        = 400
+umask           = 027
+user            = root
+identifier      = kratos-host
+childlogdir     = /var/log/supervisor
+environment     = LANG=en_US.UTF-8,TZ=Asia/Shanghai
+`
+
+	require.Equal(t, expected, content)
+}
+
+func TestSupervisordConfigDefaults(t *testing.T) {
+	// Test [supervisord] section with only required paths
+	// 测试只有必填路径的 [supervisord] 段
+	config := supervisorkratos.NewSupervisordConfig(
+		"/var/log/supervisor/supervisord.log",
+		"/var/run/supervisord.pid",
+	)
+
+	content := supervisorkratos.GenerateSupervisordConfig(config)
+	t.Log(content)
+
+	const expected = `[supervisord]
+logfile         = /var/log/supervisor/supervisord.log
+pidfile         = /var/run/supervisord.pid
+`
+
+	require.Equal(t, expected, content)
+
+	res, err := supervisorkratos.ParseIni(content)
+	require.NoError(t, err)
+	require.Len(t, res, 1)
+	require.Equal(t, "supervisord", res[0].Name)
+}
+
+func TestSupervisordConfigValidate(t *testing.T) {
+	// Test invalid [supervisord] settings are reported together
+	// 测试无效的 [supervisord] 设置会一起报告
+	config := supervisorkratos.NewSupervisordConfig(
+		"supervisord.log",
+		"/var/run/supervisord.pid",
+	).WithLogLevel("verbose").
+		WithUmask("999").
+		WithLogfileMaxBytes("big").
+		WithMinfds(0).
+		WithChildlogdir("logs")
+
+	_, err := supervisorkratos.GenerateSupervisordConfigE(config)
+	require.Error(t, err)
+	t.Log(err)
+
+	var verr *supervisorkratos.ValidationError
+	require.True(t, errors.As(err, &verr))
+	fields := make([]string, 0, len(verr.Errors))
+	for _, item := range verr.Errors {
+		fields = append(fields, item.Field)
+	}
+	require.Equal(t, []string{"Logfile", "LogfileMaxBytes", "LogLevel", "Minfds", "Umask", "Childlogdir"}, fields)
+}
+
+func TestSupervisordConfigEnvironment(t *testing.T) {
+	// Test environment values supervisor's lexer can't read back are rejected like program ones
+	// 测试与程序一样拒绝 supervisor 词法分析器无法读回的环境变量值
+	for _, value := range []string{"line\nbreak", `it's "x"`, `"quoted"`} {
+		config := supervisorkratos.NewSupervisordConfig("/var/log/supervisord.log", "/var/run/supervisord.pid").
+			WithEnvironment(map[string]string{"VALUE": value})
+		_, err := supervisorkratos.GenerateSupervisordConfigE(config)
+		require.ErrorIs(t, err, supervisorkratos.ErrInvalidValue, value)
+	}
+}
@@ -1,11 +1,13 @@
 package supervisorkratos
 
 import (
+	"maps"
 	"path/filepath"
+	"slices"
+	"sort"
 	"strconv"
 	"strings"
 
-	"github.com/pkg/errors"
 	"github.com/yyle88/must"
 	"github.com/yyle88/must/mustslice"
 	"github.com/yyle88/printgo"
@@ -20,6 +22,12 @@ type ProgramConfig struct {
 	Root     string // Program root DIR // 程序根目录
 	SlogRoot string // Standard output log root DIR // 标准输出日志根目录
 
+	// Command settings // 命令设置
+	Executable *Opt[string]   // Executable path, overrides <Root>/bin/<BinName> // 可执行文件路径，覆盖 <Root>/bin/<BinName>
+	BinName    *Opt[string]   // Binary name in <Root>/bin when differs from Name // 与 Name 不同时 <Root>/bin 下的二进制文件名
+	Args       *Opt[[]string] // Command arguments // 命令参数
+	Wrapper    *Opt[[]string] // Wrapper command before executable, e.g. nice -n 10 // 可执行文件之前的包装命令，例如 nice -n 10
+
 	// Environment variables // 环境变量
 	Environment *Opt[map[string]string] // Environment variables // 环境变量
 
@@ -45,13 +53,22 @@ type ProgramConfig struct {
 	// Multi-instance settings // 多实例设置
 	NumProcs    *Opt[int]    // Number of process instances // 进程实例数量
 	ProcessName *Opt[string] // Process name template // 进程名称模板
+
+	// Health check, not rendered into the program section // 健康检查，不渲染到程序段中
+	HealthCheck *HealthCheck // Optional readiness probe of instances // 可选的实例就绪探测
+
+	// Port allocation, rendered into the environment // 端口分配，渲染到环境变量中
+	Ports *PortAllocation // Optional HTTP and gRPC ports of instances // 可选的实例 HTTP 和 gRPC 端口
 }
 
 // GroupConfig supervisor group configuration
 // supervisor 组配置
 type GroupConfig struct {
-	Name     string           // Group name // 组名称
-	Programs []*ProgramConfig // Program configs // 程序配置列表
+	Name           string                 // Group name // 组名称
+	Programs       []*ProgramConfig       // Program configs // 程序配置列表
+	EventListeners []*EventListenerConfig // Event listeners rendered with the group, not listed in programs= // 随组一起渲染的事件监听器，不列入 programs=
+	FcgiPrograms   []*FcgiProgramConfig   // FastCGI programs rendered with the group, not listed in programs= // 随组一起渲染的 FastCGI 程序，不列入 programs=
+	ExpandNumProcs bool                   // Render each instance of NumProcs programs as its own section // 将 NumProcs 程序的每个实例渲染为独立的段
 }
 
 // NewProgramConfig create new ProgramConfig with required fields
@@ -67,6 +84,13 @@ func NewProgramConfig(name string, root string, userName string, slogRoot string
 		Root:     must.Nice(root),
 		SlogRoot: must.Nice(slogRoot),
 
+		// Command settings, default command is <Root>/bin/<Name>
+		// 命令设置，默认命令是 <Root>/bin/<Name>
+		Executable: NewOpt(""),
+		BinName:    NewOpt(name),
+		Args:       NewOpt([]string{}),
+		Wrapper:    NewOpt([]string{}),
+
 		// Environment variables // 环境变量
 		Environment: NewOpt(make(map[string]string)),
 
@@ -97,6 +121,11 @@ func NewProgramConfig(name string, root string, userName string, slogRoot string
 		// 多实例默认值
 		NumProcs:    NewOpt(1),
 		ProcessName: NewOpt("%(program_name)s"),
+
+		// No health check or port allocation by default
+		// 默认没有健康检查和端口分配
+		HealthCheck: nil,
+		Ports:       nil,
 	}
 }
 
@@ -104,8 +133,11 @@ func NewProgramConfig(name string, root string, userName string, slogRoot string
 // 创建新的 GroupConfig
 func NewGroupConfig(name string) *GroupConfig {
 	return &GroupConfig{
-		Name:     must.Nice(name),
-		Programs: make([]*ProgramConfig, 0),
+		Name:           must.Nice(name),
+		Programs:       make([]*ProgramConfig, 0),
+		EventListeners: make([]*EventListenerConfig, 0),
+		FcgiPrograms:   make([]*FcgiProgramConfig, 0),
+		ExpandNumProcs: false,
 	}
 }
 
@@ -116,9 +148,67 @@ func (g *GroupConfig) AddProgram(program *ProgramConfig) *GroupConfig {
 	return g
 }
 
+// AddEventListener add event listener to group
+// Supervisor runs each event listener as its own process group, so it is rendered with the group but not listed in programs=
+//
+// 添加事件监听器到组
+// supervisor 把每个事件监听器作为独立的进程组运行，因此它随组一起渲染但不列入 programs=
+func (g *GroupConfig) AddEventListener(listener *EventListenerConfig) *GroupConfig {
+	g.EventListeners = append(g.EventListeners, listener)
+	return g
+}
+
+// AddFcgiProgram add FastCGI program to group
+// Supervisor only creates the socket when the fcgi program is its own process group, so it is rendered with the group but not listed in programs=
+//
+// 添加 FastCGI 程序到组
+// 只有 fcgi 程序作为独立的进程组时 supervisor 才会创建 socket，因此它随组一起渲染但不列入 programs=
+func (g *GroupConfig) AddFcgiProgram(program *FcgiProgramConfig) *GroupConfig {
+	g.FcgiPrograms = append(g.FcgiPrograms, program)
+	return g
+}
+
+// WithExpandNumProcs render each instance of NumProcs programs as its own [program:<process name>] section
+// For tools that cannot handle numprocs, the "group:name" process names stay the same
+//
+// 将 NumProcs 程序的每个实例渲染为独立的 [program:<进程名称>] 段
+// 用于无法处理 numprocs 的工具，"group:name" 进程名称保持不变
+func (g *GroupConfig) WithExpandNumProcs(expand bool) *GroupConfig {
+	g.ExpandNumProcs = expand
+	return g
+}
+
 // ProgramConfig chain methods for configuration customization
 // ProgramConfig 链式配置方法
 
+// WithExecutable set executable path, overrides <Root>/bin/<BinName>
+// 设置可执行文件路径，覆盖 <Root>/bin/<BinName>
+func (p *ProgramConfig) WithExecutable(executable string) *ProgramConfig {
+	p.Executable.Set(executable)
+	return p
+}
+
+// WithBinName set binary name in <Root>/bin when it differs from program name
+// 设置 <Root>/bin 下的二进制文件名（与程序名称不同时使用）
+func (p *ProgramConfig) WithBinName(binName string) *ProgramConfig {
+	p.BinName.Set(binName)
+	return p
+}
+
+// WithArgs set command arguments, e.g. "-conf", "./configs"
+// 设置命令参数，例如 "-conf"、"./configs"
+func (p *ProgramConfig) WithArgs(args ...string) *ProgramConfig {
+	p.Args.Set(args)
+	return p
+}
+
+// WithWrapper set wrapper command before executable, e.g. "nice", "-n", "10"
+// 设置可执行文件之前的包装命令，例如 "nice"、"-n"、"10"
+func (p *ProgramConfig) WithWrapper(wrapper ...string) *ProgramConfig {
+	p.Wrapper.Set(wrapper)
+	return p
+}
+
 // WithAutoStart set auto start flag
 // 设置自动启动标志
 func (p *ProgramConfig) WithAutoStart(autoStart bool) *ProgramConfig {
@@ -241,20 +331,98 @@ func (p *ProgramConfig) WithProcessName(processName string) *ProgramConfig {
 	return p
 }
 
-// GenerateGroupConfig generate supervisor group configuration
-// 生成 supervisor 组配置
+// WithHealthCheck set health check of program instances
+// 设置程序实例的健康检查
+func (p *ProgramConfig) WithHealthCheck(healthCheck *HealthCheck) *ProgramConfig {
+	p.HealthCheck = healthCheck
+	return p
+}
+
+// WithPorts set HTTP and gRPC port allocation of program instances
+// 设置程序实例的 HTTP 和 gRPC 端口分配
+func (p *ProgramConfig) WithPorts(ports *PortAllocation) *ProgramConfig {
+	p.Ports = ports
+	return p
+}
+
+// Clone deep copy program config, the copy can be changed without touching the original
+// 深拷贝程序配置，修改副本不会影响原配置
+func (p *ProgramConfig) Clone() *ProgramConfig {
+	res := *p
+	res.Executable = p.Executable.clone()
+	res.BinName = p.BinName.clone()
+	res.Args = p.Args.clone()
+	res.Wrapper = p.Wrapper.clone()
+	res.Environment = p.Environment.clone()
+	res.AutoStart = p.AutoStart.clone()
+	res.AutoRestart = p.AutoRestart.clone()
+	res.StartRetries = p.StartRetries.clone()
+	res.StartSecs = p.StartSecs.clone()
+	res.LogMaxBytes = p.LogMaxBytes.clone()
+	res.LogBackups = p.LogBackups.clone()
+	res.RedirectStderr = p.RedirectStderr.clone()
+	res.StopAsGroup = p.StopAsGroup.clone()
+	res.StopWaitSecs = p.StopWaitSecs.clone()
+	res.KillAsGroup = p.KillAsGroup.clone()
+	res.StopSignal = p.StopSignal.clone()
+	res.Priority = p.Priority.clone()
+	res.ExitCodes = p.ExitCodes.clone()
+	res.NumProcs = p.NumProcs.clone()
+	res.ProcessName = p.ProcessName.clone()
+
+	// Reference values are copied too
+	// 引用类型的值也要复制
+	if res.Args != nil {
+		res.Args.Value = slices.Clone(res.Args.Value)
+	}
+	if res.Wrapper != nil {
+		res.Wrapper.Value = slices.Clone(res.Wrapper.Value)
+	}
+	if res.Environment != nil {
+		res.Environment.Value = maps.Clone(res.Environment.Value)
+	}
+	if res.ExitCodes != nil {
+		res.ExitCodes.Value = slices.Clone(res.ExitCodes.Value)
+	}
+	if p.HealthCheck != nil {
+		healthCheck := *p.HealthCheck
+		healthCheck.Command = slices.Clone(healthCheck.Command)
+		res.HealthCheck = &healthCheck
+	}
+	if p.Ports != nil {
+		ports := *p.Ports
+		res.Ports = &ports
+	}
+	return &res
+}
+
+// GenerateGroupConfig generate supervisor group configuration, panics on invalid config
+// 生成 supervisor 组配置，配置无效时 panic
 func GenerateGroupConfig(group *GroupConfig) string {
-	must.Full(group)
-	must.Nice(group.Name)
-	must.Have(group.Programs)
+	return must.V1(GenerateGroupConfigE(group))
+}
 
+// GenerateGroupConfigE generate supervisor group configuration
+// Returns *ValidationError listing every invalid field of every program
+//
+// 生成 supervisor 组配置
+// 返回列出每个程序所有无效字段的 *ValidationError
+func GenerateGroupConfigE(group *GroupConfig) (string, error) {
+	if err := group.Validate(); err != nil {
+		return "", err
+	}
+	return renderGroupConfig(group), nil
+}
+
+func renderGroupConfig(group *GroupConfig) string {
 	ptx := printgo.NewPTX()
 
 	// Generate group header
 	// 生成组头部
 	ptx.Println(`[group:` + group.Name + `]`)
-	programs := make([]string, 0, len(group.Programs))
-	for _, p := range group.Programs {
+	sections := group.programSections()
+	programs := make([]string, 0, len(sections))
+	for _, p := range sections {
 		programs = append(programs, p.Name)
 	}
 	ptx.Println(`programs=` + strings.Join(programs, ","))
@@ -262,36 +430,97 @@ func GenerateGroupConfig(group *GroupConfig) string {
 
 	// Generate each program config
 	// 生成每个程序配置
-	for _, program := range group.Programs {
+	for _, program := range sections {
+		ptx.Println()
+		cfs := renderProcessSection("program:"+program.Name, program, nil)
+		ptx.Println(strings.TrimSpace(cfs))
+	}
+
+	// Generate each event listener config
+	// 生成每个事件监听器配置
+	for _, listener := range group.EventListeners {
 		ptx.Println()
-		cfs := GenerateProgramConfig(program)
+		cfs := renderEventListenerConfig(listener)
+		ptx.Println(strings.TrimSpace(cfs))
+	}
+
+	// Generate each fcgi program config
+	// 生成每个 fcgi 程序配置
+	for _, program := range group.FcgiPrograms {
+		ptx.Println()
+		cfs := renderFcgiProgramConfig(program)
 		ptx.Println(strings.TrimSpace(cfs))
 	}
 
 	return ptx.String()
 }
 
-// GenerateProgramConfig generate single program configuration from ProgramConfig
-// 从 ProgramConfig 生成单个程序配置
+// programSections program sections of the group, NumProcs programs are expanded by ExpandNumProcs or their ports
+// 组的程序段，NumProcs 程序按 ExpandNumProcs 或其端口分配展开
+func (g *GroupConfig) programSections() []*ProgramConfig {
+	var res []*ProgramConfig
+	for _, program := range g.Programs {
+		if g.ExpandNumProcs && program.NumProcs.Get() > 1 {
+			res = append(res, program.instanceSections(g.Name)...)
+		} else {
+			res = append(res, program.portSections(g.Name)...)
+		}
+	}
+	return res
+}
+
+// GenerateProgramConfig generate single program configuration from ProgramConfig, panics on invalid config
+// 从 ProgramConfig 生成单个程序配置，配置无效时 panic
 func GenerateProgramConfig(program *ProgramConfig) string {
-	must.Full(program)
-	must.Nice(program.Name)
-	must.Nice(program.Root)
-	must.Nice(program.UserName)
-	must.Nice(program.SlogRoot)
+	return must.V1(GenerateProgramConfigE(program))
+}
+
+// GenerateProgramConfigE generate single program configuration from ProgramConfig
+// Returns *ValidationError listing every invalid field
+//
+// 从 ProgramConfig 生成单个程序配置
+// 返回列出所有无效字段的 *ValidationError
+func GenerateProgramConfigE(program *ProgramConfig) (string, error) {
+	if err := program.Validate(); err != nil {
+		return "", err
+	}
+	return renderProgramConfig(program), nil
+}
 
+// renderProgramConfig render the program section
+// Ports needing one section per instance render as a group named after the program, keeping the process names
+//
+// 渲染程序段
+// 需要每个实例一个段的端口分配会渲染为以程序命名的组，保持进程名称不变
+func renderProgramConfig(program *ProgramConfig) string {
+	sections := program.portSections("")
+	if len(sections) > 1 {
+		return renderGroupConfig(&GroupConfig{Name: program.Name, Programs: []*ProgramConfig{program}})
+	}
+	return renderProcessSection("program:"+program.Name, sections[0], nil)
+}
+
+// renderProcessSection render section with program keys, used by program and process-like sections
+// Section specific lines are printed after the command and environment
+//
+// 渲染带有程序键的段，供程序段以及类似程序的段使用
+// 段特有的行打印在命令和环境变量之后
+func renderProcessSection(section string, program *ProgramConfig, sectionLines []string) string {
 	ptx := printgo.NewPTX()
 
-	ptx.Println("[program:" + program.Name + "]")
+	ptx.Println("[" + section + "]")
 	ptx.Println("user            = " + program.UserName)
 	ptx.Println("directory       = " + program.Root)
-	ptx.Println("command         = " + filepath.Join(program.Root, "bin", program.Name))
+	ptx.Println("command         = " + program.CommandLine())
 
 	if program.Environment.IsSet() {
-		if env := combineSsMap(program.Environment.Get(), ","); env != "" {
+		if env := combineEnvironment(program.Environment.Get(), ","); env != "" {
 			ptx.Println("environment     = " + env)
 		}
 	}
+	for _, line := range sectionLines {
+		ptx.Println(line)
+	}
 	ptx.Println()
 	mark := ptx.Len()
 
@@ -307,8 +536,6 @@ func GenerateProgramConfig(program *ProgramConfig) string {
 			ptx.Println("autorestart     = " + strconv.FormatBool(v))
 		case string:
 			ptx.Println("autorestart     = " + v)
-		default:
-			panic(errors.New("IMPOSSIBLE: INVALID TYPE"))
 		}
 	}
 	if program.StartRetries.IsSet() {
@@ -395,13 +622,53 @@ func combineInts(items []int, sep string) string {
 	return strings.Join(results, sep)
 }
 
-func combineSsMap(items map[string]string, sep string) string {
+// combineEnvironment render environment as sorted KEY=value pairs
+// Values with characters supervisor's lexer would split are quoted, literal "%" is escaped as "%%"
+//
+// 把环境变量渲染为排序后的 KEY=value 对
+// 含有 supervisor 词法分析器会拆分的字符的值会加引号，字面量 "%" 会转义为 "%%"
+func combineEnvironment(items map[string]string, sep string) string {
 	if len(items) == 0 {
 		return ""
 	}
 	pairs := make([]string, 0, len(items))
-	for key, value := range items {
-		pairs = append(pairs, key+"="+value)
+	for _, key := range sortedKeys(items) {
+		pairs = append(pairs, key+"="+quoteEnvValue(escapePercent(items[key])))
 	}
 	return strings.Join(pairs, sep)
 }
+
+// quoteEnvValue quote environment value unless it only has supervisor word characters
+// supervisor's lexer has no escapes, so values holding a double quote are single quoted
+//
+// 除非环境变量值只包含 supervisor 的单词字符，否则为其加引号
+// supervisor 的词法分析器没有转义，因此包含双引号的值使用单引号
+func quoteEnvValue(value string) string {
+	for _, c := range value {
+		if !isEnvWordRune(c) {
+			if strings.Contains(value, `"`) {
+				return "'" + value + "'"
+			}
+			return `"` + value + `"`
+		}
+	}
+	if value == "" {
+		return `""`
+	}
+	return value
+}
+
+// isEnvWordRune check rune is a word character of supervisor's environment lexer
+// 检查字符是否是 supervisor 环境变量词法分析器的单词字符
+func isEnvWordRune(c rune) bool {
+	return (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || (c >= '0' && c <= '9') || strings.ContainsRune("_/.+-():", c)
+}
+
+func sortedKeys[V any](items map[string]V) []string {
+	keys := make([]string, 0, len(items))
+	for key := range items {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -552,3 +552,107 @@ stderr_logfile  = /var/log/minimal/zero-config.err
 
 	require.Equal(t, expected, content)
 }
+
+func TestEnvironmentSortedAndQuoted(t *testing.T) {
+	// Test environment is sorted and values are quoted when needed
+	// 测试环境变量按键排序，并在需要时为值加引号
+	program := supervisorkratos.NewProgramConfig(
+		"env-service",
+		"/opt/env-service",
+		"deploy",
+		"/var/log/env",
+	).WithEnvironment(map[string]string{
+		"ZONE":     "cn-east",
+		"APP_ENV":  "production",
+		"LABELS":   "a,b",
+		"GREETING": "hello world",
+		"DSN":      "user=root password=x",
+		"RATIO":    "100%",
+		"PORT":     "80%(process_num)02d",
+		"QUOTED":   `say "hi" \o/`,
+		"EMPTY":    "",
+		"PATH":     "/usr/local/bin:/usr/bin",
+	})
+
+	content := supervisorkratos.GenerateProgramConfig(program)
+	t.Log("=== Sorted and quoted environment ===")
+	t.Log(content)
+
+	const expected = `[program:env-service]
+user            = deploy
+directory       = /opt/env-service
+command         = /opt/env-service/bin/env-service
+environment     = APP_ENV=production,DSN="user=root password=x",EMPTY="",GREETING="hello world",LABELS="a,b",PATH=/usr/local/bin:/usr/bin,PORT="80%(process_num)02d",QUOTED='say "hi" \o/',RATIO="100%%",ZONE=cn-east
+
+stdout_logfile  = /var/log/env/env-service.log
+
+stderr_logfile  = /var/log/env/env-service.err
+
+`
+
+	require.Equal(t, expected, content)
+
+	// Output is stable across runs and survives parsing
+	// 输出在多次运行间保持稳定，并且可以被解析回来
+	for i := 0; i < 10; i++ {
+		require.Equal(t, content, supervisorkratos.GenerateProgramConfig(program))
+	}
+	res, err := supervisorkratos.ParseConfig(content)
+	require.NoError(t, err)
+	require.Equal(t, program.Environment.Get(), res.Programs[0].Environment.Get())
+}
+
+func TestEnvironmentInvalidNames(t *testing.T) {
+	// Test invalid environment variable names are rejected
+	// 测试无效的环境变量名称会被拒绝
+	for _, name := range []string{"", "1ST", "MY-VAR", "A B", "K=V"} {
+		program := supervisorkratos.NewProgramConfig(
+			"env-service",
+			"/opt/env-service",
+			"deploy",
+			"/var/log/env",
+		).WithEnvironment(map[string]string{
+			name: "value",
+		})
+		_, err := supervisorkratos.GenerateProgramConfigE(program)
+		require.ErrorIs(t, err, supervisorkratos.ErrInvalidValue, name)
+	}
+}
+
+func TestEnvironmentUnquotable(t *testing.T) {
+	// Test values supervisor's lexer can't read back are rejected, it strips outer quotes and has no escapes
+	// 测试拒绝 supervisor 词法分析器无法读回的值，它会去掉外层引号且没有转义
+	for _, value := range []string{`it's "x"`, `"quoted"`, "tail'"} {
+		program := supervisorkratos.NewProgramConfig("env-service", "/opt/env-service", "deploy", "/var/log/env").
+			WithEnvironment(map[string]string{"VALUE": value})
+		_, err := supervisorkratos.GenerateProgramConfigE(program)
+		require.ErrorIs(t, err, supervisorkratos.ErrInvalidValue, value)
+	}
+}
+
+func TestGroupExpandNumProcs(t *testing.T) {
+	// Test NumProcs programs expand into one section per instance with their own environment, logs and ports
+	// 测试 NumProcs 程序展开为每个实例一个段，各自有环境变量、日志和端口
+	api := supervisorkratos.NewProgramConfig("api", "/opt/api", "deploy", "/var/log/services").
+		WithNumProcs(2).
+		WithProcessName("%(program_name)s_%(process_num)02d").
+		WithEnvironment(map[string]string{"WORKER_ID": "%(process_num)d", "HOST": "%(host_node_name)s"}).
+		WithPorts(supervisorkratos.NewPortAllocation(8000, 0))
+	admin := supervisorkratos.NewProgramConfig("admin", "/opt/admin", "deploy", "/var/log/services")
+	group := supervisorkratos.NewGroupConfig("services").AddProgram(api).AddProgram(admin).WithExpandNumProcs(true)
+
+	config := supervisorkratos.GenerateGroupConfig(group)
+	t.Log(config)
+	require.Contains(t, config, "programs=api_00,api_01,admin")
+	require.Contains(t, config, "[program:api_01]")
+	require.Contains(t, config, "command         = /opt/api/bin/api\n")
+	require.Contains(t, config, "environment     = HOST=\"%(host_node_name)s\",KRATOS_HTTP_ADDR=0.0.0.0:8001,WORKER_ID=1")
+	require.Contains(t, config, "stdout_logfile  = /var/log/services/api_01.log")
+	require.NotContains(t, config, "numprocs")
+	require.Equal(t, []string{"services:api_00", "services:api_01"}, group.ProcessNames()["api"])
+
+	// Expanded names must not clash with other programs
+	// 展开后的名称不能与其他程序冲突
+	group.AddProgram(supervisorkratos.NewProgramConfig("api_01", "/opt/api", "deploy", "/var/log/services"))
+	require.ErrorIs(t, group.Validate(), supervisorkratos.ErrDuplicate)
+}
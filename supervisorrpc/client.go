@@ -0,0 +1,441 @@
+// Package supervisorrpc supervisor XML-RPC client over unix socket and HTTP
+// Package supervisorrpc 通过 unix socket 和 HTTP 访问 supervisor XML-RPC 的客户端
+package supervisorrpc
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// ProcessState supervisor process state code
+// supervisor 进程状态码
+type ProcessState int
+
+// Supervisor process states
+// supervisor 进程状态
+const (
+	ProcessStopped  ProcessState = 0
+	ProcessStarting ProcessState = 10
+	ProcessRunning  ProcessState = 20
+	ProcessBackoff  ProcessState = 30
+	ProcessStopping ProcessState = 40
+	ProcessExited   ProcessState = 100
+	ProcessFatal    ProcessState = 200
+	ProcessUnknown  ProcessState = 1000
+)
+
+// String state name as shown by supervisorctl status
+// supervisorctl status 显示的状态名称
+func (s ProcessState) String() string {
+	switch s {
+	case ProcessStopped:
+		return "STOPPED"
+	case ProcessStarting:
+		return "STARTING"
+	case ProcessRunning:
+		return "RUNNING"
+	case ProcessBackoff:
+		return "BACKOFF"
+	case ProcessStopping:
+		return "STOPPING"
+	case ProcessExited:
+		return "EXITED"
+	case ProcessFatal:
+		return "FATAL"
+	default:
+		return "UNKNOWN"
+	}
+}
+
+// State supervisord state returned by getState
+// getState 返回的 supervisord 状态
+type State struct {
+	Code int    // 2 RUNNING, 1 RESTARTING, 0 SHUTDOWN, -1 FATAL // 2 RUNNING，1 RESTARTING，0 SHUTDOWN，-1 FATAL
+	Name string // State name // 状态名称
+}
+
+// ProcessInfo process info returned by getProcessInfo and getAllProcessInfo
+// Group is the [group:x] name (or the program name) and Name the process name from process_name
+//
+// getProcessInfo 和 getAllProcessInfo 返回的进程信息
+// Group 是 [group:x] 的名称（或程序名称），Name 是 process_name 生成的进程名称
+type ProcessInfo struct {
+	Name          string       // Process name // 进程名称
+	Group         string       // Process group name // 进程组名称
+	Description   string       // Status description, e.g. "pid 123, uptime 0:01:00" // 状态描述
+	Start         time.Time    // Last start time // 最近启动时间
+	Stop          time.Time    // Last stop time // 最近停止时间
+	Now           time.Time    // Server time // 服务端时间
+	State         ProcessState // Process state // 进程状态
+	SpawnErr      string       // Spawn error text // 启动错误文本
+	ExitStatus    int          // Last exit status // 最近退出码
+	StdoutLogfile string       // Stdout log file // 标准输出日志文件
+	StderrLogfile string       // Stderr log file // 标准错误日志文件
+	PID           int          // Process id, 0 when not running // 进程号，未运行时为 0
+}
+
+// FullName "group:name" used by process methods, matches names from ProgramConfig.ProcessNames
+// 进程方法使用的 "group:name"，与 ProgramConfig.ProcessNames 生成的名称一致
+func (p *ProcessInfo) FullName() string {
+	return p.Group + ":" + p.Name
+}
+
+// ProcessStatus result of each process of startProcessGroup and stopProcessGroup
+// startProcessGroup 和 stopProcessGroup 中每个进程的结果
+type ProcessStatus struct {
+	Name        string // Process name // 进程名称
+	Group       string // Process group name // 进程组名称
+	Status      int    // Fault code, FaultSuccess on success // 错误码，成功时为 FaultSuccess
+	Description string // Status text // 状态文本
+}
+
+// ReloadResult process group names returned by reloadConfig
+// reloadConfig 返回的进程组名称
+type ReloadResult struct {
+	Added   []string // Groups with new config // 新增配置的组
+	Changed []string // Groups with changed config // 配置有变化的组
+	Removed []string // Groups no longer configured // 不再配置的组
+}
+
+// LogTail result of tailProcessStdoutLog
+// tailProcessStdoutLog 的结果
+type LogTail struct {
+	Bytes    string // Log content // 日志内容
+	Offset   int    // Offset to pass to the next call // 下次调用使用的偏移
+	Overflow bool   // Log grew more than requested length // 日志增长超过请求长度
+}
+
+// Client supervisor XML-RPC client
+// supervisor XML-RPC 客户端
+type Client struct {
+	endpoint   string
+	httpClient *http.Client
+	username   string
+	password   string
+}
+
+// NewClient create client with supervisorctl style server URL, unix:///path/to/supervisor.sock or http://host:port
+// 使用 supervisorctl 风格的服务地址创建客户端，unix:///path/to/supervisor.sock 或 http://host:port
+func NewClient(serverURL string) (*Client, error) {
+	res, err := url.Parse(serverURL)
+	if err != nil {
+		return nil, errors.WithMessagef(err, "parse server url %q", serverURL)
+	}
+	switch res.Scheme {
+	case "unix":
+		if res.Path == "" {
+			return nil, errors.Errorf("server url %q has no socket path", serverURL)
+		}
+		socketPath := res.Path
+		transport := &http.Transport{
+			DialContext: func(ctx context.Context, _ string, _ string) (net.Conn, error) {
+				var dialer net.Dialer
+				return dialer.DialContext(ctx, "unix", socketPath)
+			},
+		}
+		return &Client{
+			endpoint:   "http://localhost/RPC2",
+			httpClient: &http.Client{Transport: transport},
+		}, nil
+	case "http", "https":
+		if res.Host == "" {
+			return nil, errors.Errorf("server url %q has no host", serverURL)
+		}
+		return &Client{
+			endpoint:   strings.TrimSuffix(res.Scheme+"://"+res.Host+res.Path, "/") + "/RPC2",
+			httpClient: &http.Client{},
+		}, nil
+	default:
+		return nil, errors.Errorf("server url %q: unsupported scheme %q", serverURL, res.Scheme)
+	}
+}
+
+// WithBasicAuth set username and password of [unix_http_server] or [inet_http_server]
+// 设置 [unix_http_server] 或 [inet_http_server] 的用户名和密码
+func (c *Client) WithBasicAuth(username string, password string) *Client {
+	c.username = username
+	c.password = password
+	return c
+}
+
+// WithHTTPClient set http client, its Transport is kept when set
+// 设置 http 客户端，已设置的 Transport 会被保留
+func (c *Client) WithHTTPClient(httpClient *http.Client) *Client {
+	if httpClient.Transport == nil {
+		httpClient.Transport = c.httpClient.Transport
+	}
+	c.httpClient = httpClient
+	return c
+}
+
+// Call invoke XML-RPC method and return decoded result, returns *Fault on supervisor fault
+// 调用 XML-RPC 方法并返回解码结果，supervisor 报错时返回 *Fault
+func (c *Client) Call(ctx context.Context, method string, params ...any) (any, error) {
+	body, err := encodeMethodCall(method, params...)
+	if err != nil {
+		return nil, errors.WithMessagef(err, "encode %s", method)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.endpoint, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "text/xml")
+	if c.username != "" {
+		req.SetBasicAuth(c.username, c.password)
+	}
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, errors.WithMessagef(err, "call %s", method)
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, errors.WithMessagef(err, "read %s response", method)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, errors.Errorf("call %s: http status %s", method, resp.Status)
+	}
+	res, err := decodeMethodResponse(data)
+	if err != nil {
+		return nil, errors.WithMessagef(err, "call %s", method)
+	}
+	return res, nil
+}
+
+// GetState call supervisor.getState
+// 调用 supervisor.getState
+func (c *Client) GetState(ctx context.Context) (*State, error) {
+	res, err := c.Call(ctx, "supervisor.getState")
+	if err != nil {
+		return nil, err
+	}
+	fields, err := asStruct(res)
+	if err != nil {
+		return nil, err
+	}
+	return &State{Code: asInt(fields["statecode"]), Name: asString(fields["statename"])}, nil
+}
+
+// GetProcessInfo call supervisor.getProcessInfo, name is "group:name"
+// 调用 supervisor.getProcessInfo，name 为 "group:name"
+func (c *Client) GetProcessInfo(ctx context.Context, name string) (*ProcessInfo, error) {
+	res, err := c.Call(ctx, "supervisor.getProcessInfo", name)
+	if err != nil {
+		return nil, err
+	}
+	fields, err := asStruct(res)
+	if err != nil {
+		return nil, err
+	}
+	return newProcessInfo(fields), nil
+}
+
+// GetAllProcessInfo call supervisor.getAllProcessInfo
+// 调用 supervisor.getAllProcessInfo
+func (c *Client) GetAllProcessInfo(ctx context.Context) ([]*ProcessInfo, error) {
+	res, err := c.Call(ctx, "supervisor.getAllProcessInfo")
+	if err != nil {
+		return nil, err
+	}
+	items, err := asArray(res)
+	if err != nil {
+		return nil, err
+	}
+	infos := make([]*ProcessInfo, 0, len(items))
+	for _, item := range items {
+		fields, err := asStruct(item)
+		if err != nil {
+			return nil, err
+		}
+		infos = append(infos, newProcessInfo(fields))
+	}
+	return infos, nil
+}
+
+// StartProcess call supervisor.startProcess, name is "group:name" or "group:*"
+// 调用 supervisor.startProcess，name 为 "group:name" 或 "group:*"
+func (c *Client) StartProcess(ctx context.Context, name string, wait bool) error {
+	_, err := c.Call(ctx, "supervisor.startProcess", name, wait)
+	return err
+}
+
+// StopProcess call supervisor.stopProcess, name is "group:name" or "group:*"
+// 调用 supervisor.stopProcess，name 为 "group:name" 或 "group:*"
+func (c *Client) StopProcess(ctx context.Context, name string, wait bool) error {
+	_, err := c.Call(ctx, "supervisor.stopProcess", name, wait)
+	return err
+}
+
+// StartProcessGroup call supervisor.startProcessGroup
+// 调用 supervisor.startProcessGroup
+func (c *Client) StartProcessGroup(ctx context.Context, name string, wait bool) ([]*ProcessStatus, error) {
+	return c.callProcessGroup(ctx, "supervisor.startProcessGroup", name, wait)
+}
+
+// StopProcessGroup call supervisor.stopProcessGroup
+// 调用 supervisor.stopProcessGroup
+func (c *Client) StopProcessGroup(ctx context.Context, name string, wait bool) ([]*ProcessStatus, error) {
+	return c.callProcessGroup(ctx, "supervisor.stopProcessGroup", name, wait)
+}
+
+func (c *Client) callProcessGroup(ctx context.Context, method string, name string, wait bool) ([]*ProcessStatus, error) {
+	res, err := c.Call(ctx, method, name, wait)
+	if err != nil {
+		return nil, err
+	}
+	items, err := asArray(res)
+	if err != nil {
+		return nil, err
+	}
+	statuses := make([]*ProcessStatus, 0, len(items))
+	for _, item := range items {
+		fields, err := asStruct(item)
+		if err != nil {
+			return nil, err
+		}
+		statuses = append(statuses, &ProcessStatus{
+			Name:        asString(fields["name"]),
+			Group:       asString(fields["group"]),
+			Status:      asInt(fields["status"]),
+			Description: asString(fields["description"]),
+		})
+	}
+	return statuses, nil
+}
+
+// ReloadConfig call supervisor.reloadConfig, rereads config files without applying them
+// 调用 supervisor.reloadConfig，重新读取配置文件但不应用
+func (c *Client) ReloadConfig(ctx context.Context) (*ReloadResult, error) {
+	res, err := c.Call(ctx, "supervisor.reloadConfig")
+	if err != nil {
+		return nil, err
+	}
+	// Result is [[added, changed, removed]]
+	// 结果为 [[added, changed, removed]]
+	outer, err := asArray(res)
+	if err != nil || len(outer) != 1 {
+		return nil, errors.Errorf("unexpected reloadConfig result %v", res)
+	}
+	lists, err := asArray(outer[0])
+	if err != nil || len(lists) != 3 {
+		return nil, errors.Errorf("unexpected reloadConfig result %v", res)
+	}
+	result := &ReloadResult{}
+	for idx, target := range []*[]string{&result.Added, &result.Changed, &result.Removed} {
+		items, err := asArray(lists[idx])
+		if err != nil {
+			return nil, err
+		}
+		for _, item := range items {
+			*target = append(*target, asString(item))
+		}
+	}
+	return result, nil
+}
+
+// AddProcessGroup call supervisor.addProcessGroup
+// 调用 supervisor.addProcessGroup
+func (c *Client) AddProcessGroup(ctx context.Context, name string) error {
+	_, err := c.Call(ctx, "supervisor.addProcessGroup", name)
+	return err
+}
+
+// RemoveProcessGroup call supervisor.removeProcessGroup, processes of the group must be stopped
+// 调用 supervisor.removeProcessGroup，组内进程必须已停止
+func (c *Client) RemoveProcessGroup(ctx context.Context, name string) error {
+	_, err := c.Call(ctx, "supervisor.removeProcessGroup", name)
+	return err
+}
+
+// ReadProcessStdoutLog call supervisor.readProcessStdoutLog, negative offset reads from the end
+// 调用 supervisor.readProcessStdoutLog，负数偏移表示从末尾读取
+func (c *Client) ReadProcessStdoutLog(ctx context.Context, name string, offset int, length int) (string, error) {
+	res, err := c.Call(ctx, "supervisor.readProcessStdoutLog", name, offset, length)
+	if err != nil {
+		return "", err
+	}
+	return asString(res), nil
+}
+
+// TailProcessStdoutLog call supervisor.tailProcessStdoutLog
+// 调用 supervisor.tailProcessStdoutLog
+func (c *Client) TailProcessStdoutLog(ctx context.Context, name string, offset int, length int) (*LogTail, error) {
+	res, err := c.Call(ctx, "supervisor.tailProcessStdoutLog", name, offset, length)
+	if err != nil {
+		return nil, err
+	}
+	items, err := asArray(res)
+	if err != nil || len(items) != 3 {
+		return nil, errors.Errorf("unexpected tailProcessStdoutLog result %v", res)
+	}
+	overflow, _ := items[2].(bool)
+	return &LogTail{Bytes: asString(items[0]), Offset: asInt(items[1]), Overflow: overflow}, nil
+}
+
+// SignalProcess call supervisor.signalProcess, signal is a name like "HUP" or a number
+// 调用 supervisor.signalProcess，signal 为 "HUP" 这样的名称或数字
+func (c *Client) SignalProcess(ctx context.Context, name string, signal string) error {
+	_, err := c.Call(ctx, "supervisor.signalProcess", name, signal)
+	return err
+}
+
+func newProcessInfo(fields map[string]any) *ProcessInfo {
+	return &ProcessInfo{
+		Name:          asString(fields["name"]),
+		Group:         asString(fields["group"]),
+		Description:   asString(fields["description"]),
+		Start:         asTime(fields["start"]),
+		Stop:          asTime(fields["stop"]),
+		Now:           asTime(fields["now"]),
+		State:         ProcessState(asInt(fields["state"])),
+		SpawnErr:      asString(fields["spawnerr"]),
+		ExitStatus:    asInt(fields["exitstatus"]),
+		StdoutLogfile: asString(fields["stdout_logfile"]),
+		StderrLogfile: asString(fields["stderr_logfile"]),
+		PID:           asInt(fields["pid"]),
+	}
+}
+
+func asStruct(value any) (map[string]any, error) {
+	res, ok := value.(map[string]any)
+	if !ok {
+		return nil, errors.Errorf("expect struct, got %T", value)
+	}
+	return res, nil
+}
+
+func asArray(value any) ([]any, error) {
+	res, ok := value.([]any)
+	if !ok {
+		return nil, errors.Errorf("expect array, got %T", value)
+	}
+	return res, nil
+}
+
+func asString(value any) string {
+	res, _ := value.(string)
+	return res
+}
+
+func asInt(value any) int {
+	res, _ := value.(int)
+	return res
+}
+
+// asTime convert unix seconds to time, 0 means never
+// 将 unix 秒转换为时间，0 表示从未发生
+func asTime(value any) time.Time {
+	seconds := asInt(value)
+	if seconds == 0 {
+		return time.Time{}
+	}
+	return time.Unix(int64(seconds), 0)
+}
@@ -0,0 +1,183 @@
+package supervisorrpc_test
+
+import (
+	"context"
+	"encoding/xml"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/orzkratos/supervisorkratos/supervisorrpc"
+	"github.com/stretchr/testify/require"
+)
+
+type fakeCall struct {
+	Method string   `xml:"methodName"`
+	Params []string `xml:"params>param>value>string"`
+}
+
+// newFakeSupervisor fake supervisord answering XML-RPC calls with canned responses
+// 使用预设响应应答 XML-RPC 调用的假 supervisord
+func newFakeSupervisor(t *testing.T, calls *[]string) http.Handler {
+	responses := map[string]string{
+		"supervisor.getState": `<struct>
+<member><name>statecode</name><value><int>1</int></value></member>
+<member><name>statename</name><value><string>RUNNING</string></value></member>
+</struct>`,
+		"supervisor.getAllProcessInfo": `<array><data><value><struct>
+<member><name>name</name><value><string>web_00</string></value></member>
+<member><name>group</name><value><string>services</string></value></member>
+<member><name>description</name><value><string>pid 4242, uptime 0:01:00</string></value></member>
+<member><name>start</name><value><int>1700000000</int></value></member>
+<member><name>stop</name><value><int>0</int></value></member>
+<member><name>now</name><value><int>1700000060</int></value></member>
+<member><name>state</name><value><int>20</int></value></member>
+<member><name>statename</name><value><string>RUNNING</string></value></member>
+<member><name>spawnerr</name><value><string></string></value></member>
+<member><name>exitstatus</name><value><int>0</int></value></member>
+<member><name>stdout_logfile</name><value><string>/var/log/services/web.log</string></value></member>
+<member><name>stderr_logfile</name><value><string>/var/log/services/web.err</string></value></member>
+<member><name>pid</name><value><int>4242</int></value></member>
+</struct></value></data></array>`,
+		"supervisor.startProcess":    `<boolean>1</boolean>`,
+		"supervisor.signalProcess":   `<boolean>1</boolean>`,
+		"supervisor.addProcessGroup": `<boolean>1</boolean>`,
+		"supervisor.stopProcessGroup": `<array><data><value><struct>
+<member><name>name</name><value><string>web_00</string></value></member>
+<member><name>group</name><value><string>services</string></value></member>
+<member><name>status</name><value><int>80</int></value></member>
+<member><name>description</name><value><string>OK</string></value></member>
+</struct></value></data></array>`,
+		"supervisor.reloadConfig": `<array><data><value><array><data>
+<value><array><data><value><string>jobs</string></value></data></array></value>
+<value><array><data><value><string>services</string></value></data></array></value>
+<value><array><data></data></array></value>
+</data></array></value></data></array>`,
+		"supervisor.readProcessStdoutLog": `<string>hello &amp; bye</string>`,
+		"supervisor.tailProcessStdoutLog": `<array><data>
+<value><string>tail</string></value><value><int>128</int></value><value><boolean>0</boolean></value>
+</data></array>`,
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		username, password, ok := r.BasicAuth()
+		if !ok || username != "admin" || password != "secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		require.Equal(t, "/RPC2", r.URL.Path)
+		data, err := io.ReadAll(r.Body)
+		require.NoError(t, err)
+		var call fakeCall
+		require.NoError(t, xml.Unmarshal(data, &call))
+		*calls = append(*calls, call.Method+"("+strings.Join(call.Params, ",")+")")
+
+		value, ok := responses[call.Method]
+		if !ok || (len(call.Params) > 0 && call.Params[0] == "missing") {
+			_, _ = io.WriteString(w, `<?xml version="1.0"?><methodResponse><fault><value><struct>
+<member><name>faultCode</name><value><int>10</int></value></member>
+<member><name>faultString</name><value><string>BAD_NAME: missing</string></value></member>
+</struct></value></fault></methodResponse>`)
+			return
+		}
+		_, _ = io.WriteString(w, `<?xml version="1.0"?><methodResponse><params><param><value>`+value+`</value></param></params></methodResponse>`)
+	})
+}
+
+func TestClientHTTP(t *testing.T) {
+	// Test client methods against fake supervisord over HTTP with basic auth
+	// 测试客户端方法通过带基本认证的 HTTP 访问假 supervisord
+	var calls []string
+	server := httptest.NewServer(newFakeSupervisor(t, &calls))
+	defer server.Close()
+
+	client, err := supervisorrpc.NewClient(server.URL)
+	require.NoError(t, err)
+	client.WithBasicAuth("admin", "secret")
+	ctx := context.Background()
+
+	state, err := client.GetState(ctx)
+	require.NoError(t, err)
+	require.Equal(t, &supervisorrpc.State{Code: 1, Name: "RUNNING"}, state)
+
+	infos, err := client.GetAllProcessInfo(ctx)
+	require.NoError(t, err)
+	require.Len(t, infos, 1)
+	require.Equal(t, "services:web_00", infos[0].FullName())
+	require.Equal(t, supervisorrpc.ProcessRunning, infos[0].State)
+	require.Equal(t, "RUNNING", infos[0].State.String())
+	require.Equal(t, 4242, infos[0].PID)
+	require.Equal(t, int64(1700000000), infos[0].Start.Unix())
+	require.True(t, infos[0].Stop.IsZero())
+
+	require.NoError(t, client.StartProcess(ctx, "services:web_00", true))
+	require.NoError(t, client.SignalProcess(ctx, "services:web_00", "HUP"))
+	require.NoError(t, client.AddProcessGroup(ctx, "jobs"))
+
+	statuses, err := client.StopProcessGroup(ctx, "services", true)
+	require.NoError(t, err)
+	require.Equal(t, supervisorrpc.FaultSuccess, statuses[0].Status)
+
+	reload, err := client.ReloadConfig(ctx)
+	require.NoError(t, err)
+	require.Equal(t, &supervisorrpc.ReloadResult{Added: []string{"jobs"}, Changed: []string{"services"}}, reload)
+
+	text, err := client.ReadProcessStdoutLog(ctx, "services:web_00", -100, 100)
+	require.NoError(t, err)
+	require.Equal(t, "hello & bye", text)
+
+	tail, err := client.TailProcessStdoutLog(ctx, "services:web_00", 0, 100)
+	require.NoError(t, err)
+	require.Equal(t, &supervisorrpc.LogTail{Bytes: "tail", Offset: 128}, tail)
+
+	// Faults are typed
+	// 错误是有类型的
+	err = client.StopProcess(ctx, "missing", true)
+	require.True(t, supervisorrpc.IsFault(err, supervisorrpc.FaultBadName))
+	t.Log(err)
+
+	require.Equal(t, []string{
+		"supervisor.getState()",
+		"supervisor.getAllProcessInfo()",
+		"supervisor.startProcess(services:web_00)",
+		"supervisor.signalProcess(services:web_00,HUP)",
+		"supervisor.addProcessGroup(jobs)",
+		"supervisor.stopProcessGroup(services)",
+		"supervisor.reloadConfig()",
+		"supervisor.readProcessStdoutLog(services:web_00)",
+		"supervisor.tailProcessStdoutLog(services:web_00)",
+		"supervisor.stopProcess(missing)",
+	}, calls)
+
+	// Wrong credentials are rejected by the server
+	// 错误的凭据会被服务端拒绝
+	client.WithBasicAuth("admin", "wrong")
+	_, err = client.GetState(ctx)
+	require.Error(t, err)
+	require.False(t, supervisorrpc.IsFault(err, supervisorrpc.FaultBadName))
+}
+
+func TestClientUnixSocket(t *testing.T) {
+	// Test client over unix socket
+	// 测试通过 unix socket 访问客户端
+	var calls []string
+	socketPath := filepath.Join(t.TempDir(), "supervisor.sock")
+	listener, err := net.Listen("unix", socketPath)
+	require.NoError(t, err)
+	server := httptest.NewUnstartedServer(newFakeSupervisor(t, &calls))
+	server.Listener = listener
+	server.Start()
+	defer server.Close()
+
+	client, err := supervisorrpc.NewClient("unix://" + socketPath)
+	require.NoError(t, err)
+	state, err := client.WithBasicAuth("admin", "secret").GetState(context.Background())
+	require.NoError(t, err)
+	require.Equal(t, "RUNNING", state.Name)
+
+	_, err = supervisorrpc.NewClient("ftp://localhost")
+	require.Error(t, err)
+}
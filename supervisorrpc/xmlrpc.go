@@ -0,0 +1,200 @@
+package supervisorrpc
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/xml"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// Fault XML-RPC fault returned by supervisord
+// supervisord 返回的 XML-RPC 错误
+type Fault struct {
+	Code   int    // Fault code, see Fault* constants // 错误码，见 Fault* 常量
+	String string // Fault text, e.g. "BAD_NAME: api" // 错误文本，例如 "BAD_NAME: api"
+}
+
+// Error implements error
+// 实现 error 接口
+func (f *Fault) Error() string {
+	return fmt.Sprintf("supervisor fault %d: %s", f.Code, f.String)
+}
+
+// Supervisor fault codes
+// supervisor 错误码
+const (
+	FaultUnknownMethod       = 1
+	FaultIncorrectParameters = 2
+	FaultBadArguments        = 3
+	FaultSignatureUnsupport  = 4
+	FaultShutdownState       = 6
+	FaultBadName             = 10
+	FaultBadSignal           = 11
+	FaultNoFile              = 20
+	FaultNotExecutable       = 21
+	FaultFailed              = 30
+	FaultAbnormalTermination = 40
+	FaultSpawnError          = 50
+	FaultAlreadyStarted      = 60
+	FaultNotRunning          = 70
+	FaultSuccess             = 80
+	FaultAlreadyAdded        = 90
+	FaultStillRunning        = 91
+	FaultCantReread          = 92
+)
+
+// IsFault check err is a supervisor fault with the code
+// 检查 err 是否为指定错误码的 supervisor 错误
+func IsFault(err error, code int) bool {
+	var fault *Fault
+	return errors.As(err, &fault) && fault.Code == code
+}
+
+// encodeMethodCall encode XML-RPC method call, params are string, int, bool
+// 编码 XML-RPC 方法调用，参数类型为 string、int、bool
+func encodeMethodCall(method string, params ...any) ([]byte, error) {
+	var buf bytes.Buffer
+	buf.WriteString(`<?xml version="1.0"?><methodCall><methodName>`)
+	if err := xml.EscapeText(&buf, []byte(method)); err != nil {
+		return nil, err
+	}
+	buf.WriteString(`</methodName><params>`)
+	for _, param := range params {
+		buf.WriteString(`<param><value>`)
+		switch v := param.(type) {
+		case string:
+			buf.WriteString(`<string>`)
+			if err := xml.EscapeText(&buf, []byte(v)); err != nil {
+				return nil, err
+			}
+			buf.WriteString(`</string>`)
+		case int:
+			buf.WriteString(`<int>` + strconv.Itoa(v) + `</int>`)
+		case bool:
+			if v {
+				buf.WriteString(`<boolean>1</boolean>`)
+			} else {
+				buf.WriteString(`<boolean>0</boolean>`)
+			}
+		default:
+			return nil, errors.Errorf("unsupported param type %T", param)
+		}
+		buf.WriteString(`</value></param>`)
+	}
+	buf.WriteString(`</params></methodCall>`)
+	return buf.Bytes(), nil
+}
+
+type xmlMember struct {
+	Name  string   `xml:"name"`
+	Value xmlValue `xml:"value"`
+}
+
+type xmlValue struct {
+	Int      *string `xml:"int"`
+	I4       *string `xml:"i4"`
+	Boolean  *string `xml:"boolean"`
+	String   *string `xml:"string"`
+	Double   *string `xml:"double"`
+	Base64   *string `xml:"base64"`
+	DateTime *string `xml:"dateTime.iso8601"`
+	Nil      *string `xml:"nil"`
+	Array    *struct {
+		Values []xmlValue `xml:"data>value"`
+	} `xml:"array"`
+	Struct *struct {
+		Members []xmlMember `xml:"member"`
+	} `xml:"struct"`
+	Text string `xml:",chardata"`
+}
+
+type xmlMethodResponse struct {
+	Params []xmlValue `xml:"params>param>value"`
+	Fault  *xmlValue  `xml:"fault>value"`
+}
+
+// decodeMethodResponse decode XML-RPC response into Go values, returns *Fault on fault response
+// Values decode as int, bool, string, float64, []any and map[string]any
+//
+// 解码 XML-RPC 响应为 Go 值，错误响应返回 *Fault
+// 值解码为 int、bool、string、float64、[]any 和 map[string]any
+func decodeMethodResponse(data []byte) (any, error) {
+	var res xmlMethodResponse
+	if err := xml.Unmarshal(data, &res); err != nil {
+		return nil, errors.WithMessage(err, "decode xml-rpc response")
+	}
+	if res.Fault != nil {
+		value, err := res.Fault.decode()
+		if err != nil {
+			return nil, err
+		}
+		fields, _ := value.(map[string]any)
+		code, _ := fields["faultCode"].(int)
+		text, _ := fields["faultString"].(string)
+		return nil, &Fault{Code: code, String: text}
+	}
+	if len(res.Params) != 1 {
+		return nil, errors.Errorf("expect 1 response param, got %d", len(res.Params))
+	}
+	return res.Params[0].decode()
+}
+
+func (v *xmlValue) decode() (any, error) {
+	switch {
+	case v.Int != nil:
+		return strconv.Atoi(strings.TrimSpace(*v.Int))
+	case v.I4 != nil:
+		return strconv.Atoi(strings.TrimSpace(*v.I4))
+	case v.Boolean != nil:
+		switch strings.TrimSpace(*v.Boolean) {
+		case "1":
+			return true, nil
+		case "0":
+			return false, nil
+		}
+		return nil, errors.Errorf("invalid boolean %q", *v.Boolean)
+	case v.String != nil:
+		return *v.String, nil
+	case v.Double != nil:
+		return strconv.ParseFloat(strings.TrimSpace(*v.Double), 64)
+	case v.Base64 != nil:
+		data, err := base64.StdEncoding.DecodeString(strings.TrimSpace(*v.Base64))
+		if err != nil {
+			return nil, err
+		}
+		return string(data), nil
+	case v.DateTime != nil:
+		return strings.TrimSpace(*v.DateTime), nil
+	case v.Nil != nil:
+		return nil, nil
+	case v.Array != nil:
+		res := make([]any, 0, len(v.Array.Values))
+		for idx := range v.Array.Values {
+			item, err := v.Array.Values[idx].decode()
+			if err != nil {
+				return nil, err
+			}
+			res = append(res, item)
+		}
+		return res, nil
+	case v.Struct != nil:
+		res := make(map[string]any, len(v.Struct.Members))
+		for idx := range v.Struct.Members {
+			member := &v.Struct.Members[idx]
+			item, err := member.Value.decode()
+			if err != nil {
+				return nil, errors.WithMessagef(err, "member %q", member.Name)
+			}
+			res[member.Name] = item
+		}
+		return res, nil
+	default:
+		// Value without type element is a string
+		// 没有类型元素的值是字符串
+		return v.Text, nil
+	}
+}
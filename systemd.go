@@ -0,0 +1,319 @@
+package supervisorkratos
+
+import (
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/yyle88/must"
+	"github.com/yyle88/printgo"
+)
+
+// SystemdUnitName unit file name of program, the "<name>@.service" template when NumProcs > 1
+// 程序的单元文件名，NumProcs > 1 时为 "<name>@.service" 模板
+func (p *ProgramConfig) SystemdUnitName() string {
+	if p.NumProcs.Get() > 1 {
+		return p.Name + "@.service"
+	}
+	return p.Name + ".service"
+}
+
+// systemdInstanceNames unit names of the instances, "<name>@<num>.service" when NumProcs > 1
+// 实例的单元名称，NumProcs > 1 时为 "<name>@<num>.service"
+func (p *ProgramConfig) systemdInstanceNames() []string {
+	numProcs := p.NumProcs.Get()
+	if numProcs <= 1 {
+		return []string{p.Name + ".service"}
+	}
+	res := make([]string, 0, numProcs)
+	for num := range numProcs {
+		res = append(res, p.Name+"@"+strconv.Itoa(num)+".service")
+	}
+	return res
+}
+
+// GenerateSystemdProgramUnits generate systemd unit files of a standalone program keyed by file name, panics on invalid config
+// 生成独立程序的 systemd 单元文件，以文件名为键，配置无效时 panic
+func GenerateSystemdProgramUnits(program *ProgramConfig) map[string]string {
+	return must.V1(GenerateSystemdProgramUnitsE(program))
+}
+
+// GenerateSystemdProgramUnitsE generate systemd unit files of a standalone program keyed by file name
+// NumProcs > 1 gives a "<name>@.service" template and a "<name>.target" wanting every instance
+// Fields map as: UserName→User, Root→WorkingDirectory, command→ExecStart, Environment→Environment,
+// AutoRestart→Restart, StartRetries→StartLimitBurst, StopSignal→KillSignal, StopWaitSecs→TimeoutStopSec,
+// StopAsGroup/KillAsGroup→KillMode, ExitCodes→SuccessExitStatus, AutoStart→[Install] or the target's Wants
+// Not mapped: Priority, LogMaxBytes and LogBackups (rotate with logrotate), HealthCheck, ProcessName,
+// StartSecs only sizes the start limit window, and exit code 0 is always a success for systemd
+// Expressions systemd can't express, like %(here)s, %(ENV_X)s or a padded %(process_num)02d, are reported as errors
+//
+// 生成独立程序的 systemd 单元文件，以文件名为键
+// NumProcs > 1 时生成 "<name>@.service" 模板和 Wants 每个实例的 "<name>.target"
+// 字段映射：UserName→User，Root→WorkingDirectory，命令→ExecStart，Environment→Environment，
+// AutoRestart→Restart，StartRetries→StartLimitBurst，StopSignal→KillSignal，StopWaitSecs→TimeoutStopSec，
+// StopAsGroup/KillAsGroup→KillMode，ExitCodes→SuccessExitStatus，AutoStart→[Install] 或 target 的 Wants
+// 不映射：Priority、LogMaxBytes 和 LogBackups（使用 logrotate 轮转）、HealthCheck、ProcessName，
+// StartSecs 只用于计算启动限制的时间窗口，并且对 systemd 而言退出码 0 总是成功
+// systemd 无法表示的表达式，例如 %(here)s、%(ENV_X)s 或补零的 %(process_num)02d，会作为错误报告
+func GenerateSystemdProgramUnitsE(program *ProgramConfig) (map[string]string, error) {
+	if err := program.Validate(); err != nil {
+		return nil, err
+	}
+	v := &validator{}
+	files := make(map[string]string)
+	target := ""
+	if program.NumProcs.Get() > 1 {
+		target = program.Name + ".target"
+		files[target] = renderSystemdTarget(program.Name, program.systemdInstanceNames(), program.AutoStart.Get())
+	}
+	program.systemdUnits(v, "", target, files)
+	if err := v.result(); err != nil {
+		return nil, err
+	}
+	return files, nil
+}
+
+// GenerateSystemdGroupUnits generate systemd unit files of a group keyed by file name, panics on invalid config
+// 生成组的 systemd 单元文件，以文件名为键，配置无效时 panic
+func GenerateSystemdGroupUnits(group *GroupConfig) map[string]string {
+	return must.V1(GenerateSystemdGroupUnitsE(group))
+}
+
+// GenerateSystemdGroupUnitsE generate systemd unit files of a group keyed by file name
+// The group becomes "<group>.target" wanting the instances of AutoStart programs, every service is PartOf the target
+// Programs map as in GenerateSystemdProgramUnitsE, ExpandNumProcs is not needed since template instances are separate units
+// Event listeners and FastCGI programs have no systemd equivalent and are reported as errors
+//
+// 生成组的 systemd 单元文件，以文件名为键
+// 组成为 "<group>.target"，Wants 所有 AutoStart 程序的实例，每个服务都 PartOf 该 target
+// 程序的映射与 GenerateSystemdProgramUnitsE 相同，模板实例本身就是独立的单元，因此不需要 ExpandNumProcs
+// 事件监听器和 FastCGI 程序没有 systemd 对应物，会作为错误报告
+func GenerateSystemdGroupUnitsE(group *GroupConfig) (map[string]string, error) {
+	if err := group.Validate(); err != nil {
+		return nil, err
+	}
+	v := &validator{}
+	section := "group:" + group.Name
+	if len(group.EventListeners) > 0 {
+		v.add(section, "EventListeners", len(group.EventListeners), ErrInvalidValue, "event listeners have no systemd equivalent")
+	}
+	if len(group.FcgiPrograms) > 0 {
+		v.add(section, "FcgiPrograms", len(group.FcgiPrograms), ErrInvalidValue, "FastCGI programs have no systemd equivalent")
+	}
+
+	target := group.Name + ".target"
+	files := make(map[string]string)
+	var wants []string
+	for _, program := range group.Programs {
+		if program.AutoStart.Get() {
+			wants = append(wants, program.systemdInstanceNames()...)
+		}
+		program.systemdUnits(v, group.Name, target, files)
+	}
+	if _, ok := files[target]; ok {
+		v.add(section, "Name", group.Name, ErrDuplicate, "file %q is written twice", target)
+	}
+	files[target] = renderSystemdTarget(group.Name, wants, true)
+	if err := v.result(); err != nil {
+		return nil, err
+	}
+	return files, nil
+}
+
+// renderSystemdTarget render a target wanting the units, installed into multi-user.target when install is true
+// 渲染 Wants 这些单元的 target，install 为 true 时安装到 multi-user.target
+func renderSystemdTarget(name string, wants []string, install bool) string {
+	ptx := printgo.NewPTX()
+	ptx.Println("[Unit]")
+	ptx.Println("Description=" + name)
+	if len(wants) > 0 {
+		ptx.Println("Wants=" + strings.Join(wants, " "))
+	}
+	if install {
+		ptx.Println()
+		ptx.Println("[Install]")
+		ptx.Println("WantedBy=multi-user.target")
+	}
+	return ptx.String()
+}
+
+// systemdUnits add the service of program in group groupName into files, with one ports drop-in per template instance
+// Services of a target are PartOf it, services without a target install into multi-user.target when AutoStart
+//
+// 将 groupName 组中 program 的服务加入 files，模板实例各有一个端口 drop-in
+// 属于 target 的服务 PartOf 该 target，没有 target 的服务在 AutoStart 时安装到 multi-user.target
+func (p *ProgramConfig) systemdUnits(v *validator, groupName string, target string, files map[string]string) {
+	section := "program:" + p.Name
+	name := p.SystemdUnitName()
+	if _, ok := files[name]; ok {
+		v.add(section, "Name", p.Name, ErrDuplicate, "file %q is written twice", name)
+		return
+	}
+	template := p.NumProcs.Get() > 1
+	vars := p.instanceVars(groupName, 0)
+	expand := func(field string, value string) string {
+		res, err := systemdExpand(value, vars, template)
+		if err != nil {
+			v.add(section, field, value, ErrInvalidValue, "%s", err.Error())
+		}
+		return res
+	}
+
+	environment := p.Environment.Get()
+	if p.Ports != nil && !template {
+		addresses, _ := p.Ports.portEnvironment(1, 0)
+		environment = mergeEnvironment(environment, addresses)
+	}
+	command := make([]string, 0, len(p.CommandArgs()))
+	for _, arg := range p.CommandArgs() {
+		command = append(command, systemdQuoteArg(expand("Command", arg)))
+	}
+
+	ptx := printgo.NewPTX()
+	ptx.Println("[Unit]")
+	if template {
+		ptx.Println("Description=" + p.Name + " %i")
+	} else {
+		ptx.Println("Description=" + p.Name)
+	}
+	ptx.Println("After=network.target")
+	if target != "" {
+		ptx.Println("PartOf=" + target)
+	}
+	burst := p.StartRetries.Get() + 1 // The first start and the retries // 首次启动加上重试
+	ptx.Println("StartLimitIntervalSec=" + strconv.Itoa(burst*(p.StartSecs.Get()+1)))
+	ptx.Println("StartLimitBurst=" + strconv.Itoa(burst))
+	ptx.Println()
+
+	ptx.Println("[Service]")
+	ptx.Println("Type=simple")
+	ptx.Println("User=" + expand("UserName", p.UserName))
+	ptx.Println("WorkingDirectory=" + expand("Root", p.Root))
+	ptx.Println("ExecStart=" + strings.Join(command, " "))
+	for _, key := range sortedKeys(environment) {
+		ptx.Println("Environment=" + systemdQuoteEnv(key, expand("Environment", environment[key])))
+	}
+	ptx.Println("Restart=" + systemdRestart(p.AutoRestart.Get()))
+	ptx.Println("RestartSec=1")
+	if codes := slices.DeleteFunc(slices.Clone(p.ExitCodes.Get()), func(code int) bool { return code == 0 }); len(codes) > 0 {
+		ptx.Println("SuccessExitStatus=" + combineInts(codes, " "))
+	}
+	ptx.Println("KillMode=" + systemdKillMode(p.StopAsGroup.Get(), p.KillAsGroup.Get()))
+	ptx.Println("KillSignal=SIG" + signalName(p.StopSignal.Get()))
+	ptx.Println("TimeoutStopSec=" + strconv.Itoa(p.StopWaitSecs.Get()))
+	ptx.Println("StandardOutput=append:" + expand("SlogRoot", filepath.Join(p.SlogRoot, p.Name+".log")))
+	if p.RedirectStderr.Get() {
+		ptx.Println("StandardError=inherit")
+	} else {
+		ptx.Println("StandardError=append:" + expand("SlogRoot", filepath.Join(p.SlogRoot, p.Name+".err")))
+	}
+	if target == "" && p.AutoStart.Get() {
+		ptx.Println()
+		ptx.Println("[Install]")
+		ptx.Println("WantedBy=multi-user.target")
+	}
+	files[name] = ptx.String()
+
+	// Template instances can't compute base + num*stride, each instance gets its addresses from a drop-in
+	// 模板实例无法计算 base + num*stride，每个实例从 drop-in 获取地址
+	if p.Ports != nil && template {
+		for num, instance := range p.systemdInstanceNames() {
+			addresses, _ := p.Ports.portEnvironment(p.NumProcs.Get(), num)
+			dropIn := printgo.NewPTX()
+			dropIn.Println("[Service]")
+			for _, key := range sortedKeys(addresses) {
+				dropIn.Println("Environment=" + systemdQuoteEnv(key, strings.ReplaceAll(addresses[key], "%", "%%")))
+			}
+			files[instance+".d/ports.conf"] = dropIn.String()
+		}
+	}
+}
+
+// systemdExpand translate supervisor expressions of value into systemd specifiers, escaping literal "%" as "%%"
+// In a template %(process_num)d becomes %i, %(host_node_name)s becomes %H and other known names are expanded
+//
+// 将 value 中的 supervisor 表达式转换为 systemd 说明符，字面量 "%" 转义为 "%%"
+// 模板中 %(process_num)d 变为 %i，%(host_node_name)s 变为 %H，其他已知名称直接展开
+func systemdExpand(value string, vars map[string]string, template bool) (string, error) {
+	var res strings.Builder
+	for i := 0; i < len(value); i++ {
+		if value[i] != '%' {
+			res.WriteByte(value[i])
+			continue
+		}
+		name, size, ok := scanExpansion(value[i:])
+		if !ok || (!slices.Contains(expansionNames, name) && !strings.HasPrefix(name, "ENV_")) {
+			res.WriteString("%%")
+			continue
+		}
+		expression := value[i : i+size]
+		switch {
+		case name == "process_num" && template:
+			if !slices.Contains([]string{"%(process_num)d", "%(process_num)i", "%(process_num)s"}, expression) {
+				return "", errors.Errorf("%s has no systemd equivalent, template instances only expand %%(process_num)d", expression)
+			}
+			res.WriteString("%i")
+		case name == "host_node_name":
+			if expression != "%(host_node_name)s" {
+				return "", errors.Errorf("%s has no systemd equivalent, only %%(host_node_name)s is supported", expression)
+			}
+			res.WriteString("%H")
+		case vars[name] != "" || name == "group_name":
+			res.WriteString(strings.ReplaceAll(expandExpressions(expression, vars), "%", "%%"))
+		default:
+			return "", errors.Errorf("%s has no systemd equivalent", expression)
+		}
+		i += size - 1
+	}
+	return res.String(), nil
+}
+
+// systemdQuoteArg quote ExecStart argument for systemd's splitting, "$" is escaped as "$$" to skip variable expansion
+// 为 systemd 的拆分规则给 ExecStart 参数加引号，"$" 转义为 "$$" 以跳过变量展开
+func systemdQuoteArg(arg string) string {
+	arg = strings.ReplaceAll(arg, "$", "$$")
+	if arg == ";" {
+		return `\;`
+	}
+	if arg != "" && !strings.ContainsAny(arg, " \t\n\"'\\") {
+		return arg
+	}
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`, "\t", `\t`).Replace(arg) + `"`
+}
+
+// systemdQuoteEnv quote KEY=value assignment of Environment=
+// 为 Environment= 的 KEY=value 赋值加引号
+func systemdQuoteEnv(key string, value string) string {
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(key+"="+value) + `"`
+}
+
+// systemdRestart map autorestart to Restart=, "unexpected" restarts on exit codes outside SuccessExitStatus
+// 将 autorestart 映射为 Restart=，"unexpected" 在退出码不属于 SuccessExitStatus 时重启
+func systemdRestart(autoRestart any) string {
+	switch autoRestart {
+	case true, "true":
+		return "always"
+	case false, "false":
+		return "no"
+	default:
+		return "on-failure"
+	}
+}
+
+// systemdKillMode map stopasgroup and killasgroup to KillMode=
+// stopasgroup signals every process, killasgroup only kills the rest after the stop signal reached the main process
+//
+// 将 stopasgroup 和 killasgroup 映射为 KillMode=
+// stopasgroup 向所有进程发送信号，killasgroup 只在停止信号发给主进程之后杀死其余进程
+func systemdKillMode(stopAsGroup bool, killAsGroup bool) string {
+	switch {
+	case stopAsGroup:
+		return "control-group"
+	case killAsGroup:
+		return "mixed"
+	default:
+		return "process"
+	}
+}
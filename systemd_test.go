@@ -0,0 +1,96 @@
+package supervisorkratos_test
+
+import (
+	"testing"
+
+	"github.com/orzkratos/supervisorkratos"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSystemdProgramUnits(t *testing.T) {
+	// Test a single program renders one service with the supervisor fields mapped
+	// 测试单个程序渲染为一个服务，supervisor 字段被映射
+	program := supervisorkratos.NewProgramConfig("api", "/opt/api", "deploy", "/var/log/services").
+		WithArgs("-conf", "/opt/api/configs", "-name", "%(program_name)s $HOME 100%").
+		WithEnvironment(map[string]string{"APP_ENV": "prod"}).
+		WithAutoRestartMode("unexpected").
+		WithStartRetries(5).
+		WithStopSignal("INT").
+		WithStopWaitSecs(30).
+		WithKillAsGroup(true).
+		WithExitCodes([]int{0, 2}).
+		WithRedirectStderr(true)
+
+	files := supervisorkratos.GenerateSystemdProgramUnits(program)
+	require.Len(t, files, 1)
+	unit := files["api.service"]
+	t.Log(unit)
+	require.Contains(t, unit, "User=deploy\nWorkingDirectory=/opt/api\n")
+	require.Contains(t, unit, `ExecStart=/opt/api/bin/api -conf /opt/api/configs -name "api $$HOME 100%%"`)
+	require.Contains(t, unit, `Environment="APP_ENV=prod"`)
+	require.Contains(t, unit, "Restart=on-failure\n")
+	require.Contains(t, unit, "StartLimitBurst=6\n")
+	require.Contains(t, unit, "SuccessExitStatus=2\n")
+	require.Contains(t, unit, "KillMode=mixed\nKillSignal=SIGINT\nTimeoutStopSec=30\n")
+	require.Contains(t, unit, "StandardOutput=append:/var/log/services/api.log\nStandardError=inherit\n")
+	require.Contains(t, unit, "[Install]\nWantedBy=multi-user.target")
+	require.NotContains(t, unit, "PartOf=")
+
+	// Signal names are accepted in any case with or without the "SIG" prefix
+	// 信号名称可以是任意大小写，带或不带 "SIG" 前缀
+	for _, signal := range []string{"SIGINT", "int", "SigInt"} {
+		require.Contains(t, supervisorkratos.GenerateSystemdProgramUnits(program.WithStopSignal(signal))["api.service"], "KillSignal=SIGINT\n")
+	}
+}
+
+func TestSystemdTemplateUnits(t *testing.T) {
+	// Test NumProcs renders a template unit, a target wanting each instance and per-instance port drop-ins
+	// 测试 NumProcs 渲染为模板单元、Wants 每个实例的 target 以及每个实例的端口 drop-in
+	program := supervisorkratos.NewProgramConfig("api", "/opt/api", "deploy", "/var/log/services").
+		WithNumProcs(2).
+		WithProcessName("%(program_name)s_%(process_num)d").
+		WithArgs("-id", "%(process_num)d", "-host", "%(host_node_name)s", "-group", "%(group_name)s").
+		WithPorts(supervisorkratos.NewPortAllocation(8001, 0))
+
+	files := supervisorkratos.GenerateSystemdProgramUnits(program)
+	require.Len(t, files, 4)
+	require.Equal(t, "api@.service", program.SystemdUnitName())
+	require.Contains(t, files["api@.service"], "ExecStart=/opt/api/bin/api -id %i -host %H -group api\n")
+	require.Contains(t, files["api@.service"], "PartOf=api.target\n")
+	require.NotContains(t, files["api@.service"], "[Install]")
+	require.Contains(t, files["api.target"], "Wants=api@0.service api@1.service\n")
+	require.Equal(t, "[Service]\nEnvironment=\"KRATOS_HTTP_ADDR=0.0.0.0:8002\"\n", files["api@1.service.d/ports.conf"])
+
+	// Padded process numbers have no specifier
+	// 补零的进程编号没有对应的说明符
+	program.WithArgs("-id", "%(process_num)02d")
+	_, err := supervisorkratos.GenerateSystemdProgramUnitsE(program)
+	require.ErrorIs(t, err, supervisorkratos.ErrInvalidValue)
+	require.ErrorContains(t, err, "%(process_num)02d")
+}
+
+func TestSystemdGroupUnits(t *testing.T) {
+	// Test a group renders a target wanting the AutoStart programs, listeners are rejected
+	// 测试组渲染为 Wants 所有 AutoStart 程序的 target，事件监听器会被拒绝
+	group := supervisorkratos.NewGroupConfig("services").
+		AddProgram(supervisorkratos.NewProgramConfig("api", "/opt/api", "deploy", "/var/log/services").
+			WithArgs("-group", "%(group_name)s")).
+		AddProgram(supervisorkratos.NewProgramConfig("worker", "/opt/worker", "deploy", "/var/log/services").
+			WithAutoStart(false).
+			WithAutoRestart(true))
+
+	files := supervisorkratos.GenerateSystemdGroupUnits(group)
+	require.Len(t, files, 3)
+	t.Log(files["services.target"])
+	require.Contains(t, files["services.target"], "Wants=api.service\n")
+	require.Contains(t, files["services.target"], "WantedBy=multi-user.target")
+	require.Contains(t, files["api.service"], "ExecStart=/opt/api/bin/api -group services\n")
+	require.Contains(t, files["worker.service"], "PartOf=services.target\n")
+	require.Contains(t, files["worker.service"], "Restart=always\n")
+	require.NotContains(t, files["worker.service"], "[Install]")
+
+	group.AddEventListener(supervisorkratos.NewEventListenerConfig("crashmail", "/opt/crashmail", "deploy", "/var/log/services", supervisorkratos.EventProcessStateExited))
+	_, err := supervisorkratos.GenerateSystemdGroupUnitsE(group)
+	require.ErrorIs(t, err, supervisorkratos.ErrInvalidValue)
+	require.ErrorContains(t, err, "event listeners")
+}
@@ -0,0 +1,468 @@
+package supervisorkratos
+
+import (
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// Validation error kinds, use errors.Is to check the kind of a FieldError
+// 校验错误类型，使用 errors.Is 判断 FieldError 的类型
+var (
+	ErrRequired     = errors.New("required")      // Field is missing or empty // 字段缺失或为空
+	ErrInvalidType  = errors.New("invalid type")  // Field holds a value of unsupported type // 字段的值类型不受支持
+	ErrInvalidValue = errors.New("invalid value") // Field value is not accepted by supervisor // 字段的值不被 supervisor 接受
+	ErrDuplicate    = errors.New("duplicate")     // Name is used more than once // 名称被重复使用
+	ErrOutOfRange   = errors.New("out of range")  // Number is outside accepted range // 数值超出可接受范围
+)
+
+// FieldError single invalid field of a config section
+// 配置段中单个无效字段
+type FieldError struct {
+	Section string // Section name, e.g. "program:myapp" // 段名称，例如 "program:myapp"
+	Field   string // Field name, e.g. "StopSignal" // 字段名称，例如 "StopSignal"
+	Value   any    // Invalid value // 无效的值
+	Err     error  // Error kind, one of the Err* values // 错误类型，Err* 之一
+	Reason  string // Human readable reason // 可读的原因
+}
+
+// Error implements error
+// 实现 error 接口
+func (e *FieldError) Error() string {
+	msg := e.Section + "." + e.Field + ": " + e.Err.Error()
+	if e.Reason != "" {
+		msg += ": " + e.Reason
+	}
+	return msg
+}
+
+// Unwrap returns the error kind so errors.Is works
+// 返回错误类型，以便 errors.Is 生效
+func (e *FieldError) Unwrap() error {
+	return e.Err
+}
+
+// ValidationError aggregated invalid fields of one or more config sections
+// 一个或多个配置段中所有无效字段的汇总
+type ValidationError struct {
+	Errors []*FieldError // Invalid fields in order // 按顺序排列的无效字段
+}
+
+// Error implements error
+// 实现 error 接口
+func (e *ValidationError) Error() string {
+	messages := make([]string, 0, len(e.Errors))
+	for _, item := range e.Errors {
+		messages = append(messages, item.Error())
+	}
+	return fmt.Sprintf("%d invalid fields: %s", len(e.Errors), strings.Join(messages, "; "))
+}
+
+// Unwrap returns each FieldError so errors.Is and errors.As work
+// 返回每个 FieldError，以便 errors.Is 和 errors.As 生效
+func (e *ValidationError) Unwrap() []error {
+	res := make([]error, 0, len(e.Errors))
+	for _, item := range e.Errors {
+		res = append(res, item)
+	}
+	return res
+}
+
+// Section get invalid fields of the given section
+// 获取指定段中的无效字段
+func (e *ValidationError) Section(section string) []*FieldError {
+	res := make([]*FieldError, 0)
+	for _, item := range e.Errors {
+		if item.Section == section {
+			res = append(res, item)
+		}
+	}
+	return res
+}
+
+// validator collects field errors of sections
+// 收集各个段的字段错误
+type validator struct {
+	errs []*FieldError
+}
+
+func (v *validator) add(section string, field string, value any, err error, format string, args ...any) {
+	v.errs = append(v.errs, &FieldError{
+		Section: section,
+		Field:   field,
+		Value:   value,
+		Err:     err,
+		Reason:  fmt.Sprintf(format, args...),
+	})
+}
+
+func (v *validator) result() error {
+	if len(v.errs) == 0 {
+		return nil
+	}
+	return &ValidationError{Errors: v.errs}
+}
+
+// Validate check program config and return *ValidationError listing every invalid field
+// 校验程序配置，返回列出每个无效字段的 *ValidationError
+func (p *ProgramConfig) Validate() error {
+	if p == nil {
+		return &ValidationError{Errors: []*FieldError{{Section: "program", Field: "ProgramConfig", Err: ErrRequired, Reason: "nil config"}}}
+	}
+	v := &validator{}
+	p.validateFields(v, "program:"+p.Name)
+	return v.result()
+}
+
+func (p *ProgramConfig) validateFields(v *validator, section string) {
+
+	// Required fields // 必填字段
+	if p.Name == "" {
+		v.add(section, "Name", p.Name, ErrRequired, "program name is empty")
+	} else if !isValidSectionName(p.Name) {
+		v.add(section, "Name", p.Name, ErrInvalidValue, sectionNameReason)
+	}
+	if p.UserName == "" {
+		v.add(section, "UserName", p.UserName, ErrRequired, "user name is empty")
+	} else if strings.ContainsAny(p.UserName, " \t\n:") {
+		v.add(section, "UserName", p.UserName, ErrInvalidValue, "user name must not contain blanks or \":\"")
+	}
+	if p.Root == "" {
+		v.add(section, "Root", p.Root, ErrRequired, "root DIR is empty")
+	} else if !filepath.IsAbs(p.Root) {
+		v.add(section, "Root", p.Root, ErrInvalidValue, "root DIR must be an absolute path")
+	}
+	if p.SlogRoot == "" {
+		v.add(section, "SlogRoot", p.SlogRoot, ErrRequired, "log root DIR is empty")
+	} else if !filepath.IsAbs(p.SlogRoot) {
+		v.add(section, "SlogRoot", p.SlogRoot, ErrInvalidValue, "log root DIR must be an absolute path")
+	}
+
+	// Option fields must be initialized, use NewProgramConfig to get defaults
+	// 选项字段必须初始化，使用 NewProgramConfig 获取默认值
+	options := []struct {
+		field string
+		isNil bool
+	}{
+		{"Executable", p.Executable == nil},
+		{"BinName", p.BinName == nil},
+		{"Args", p.Args == nil},
+		{"Wrapper", p.Wrapper == nil},
+		{"Environment", p.Environment == nil},
+		{"AutoStart", p.AutoStart == nil},
+		{"AutoRestart", p.AutoRestart == nil},
+		{"StartRetries", p.StartRetries == nil},
+		{"StartSecs", p.StartSecs == nil},
+		{"LogMaxBytes", p.LogMaxBytes == nil},
+		{"LogBackups", p.LogBackups == nil},
+		{"RedirectStderr", p.RedirectStderr == nil},
+		{"StopAsGroup", p.StopAsGroup == nil},
+		{"StopWaitSecs", p.StopWaitSecs == nil},
+		{"KillAsGroup", p.KillAsGroup == nil},
+		{"StopSignal", p.StopSignal == nil},
+		{"Priority", p.Priority == nil},
+		{"ExitCodes", p.ExitCodes == nil},
+		{"NumProcs", p.NumProcs == nil},
+		{"ProcessName", p.ProcessName == nil},
+	}
+	missing := false
+	for _, option := range options {
+		if option.isNil {
+			v.add(section, option.field, nil, ErrRequired, "option is nil, create config with NewProgramConfig")
+			missing = true
+		}
+	}
+	if missing {
+		return
+	}
+
+	if p.AutoRestart.IsSet() {
+		switch value := p.AutoRestart.Get().(type) {
+		case bool:
+		case string:
+			if value != "false" && value != "true" && value != "unexpected" {
+				v.add(section, "AutoRestart", value, ErrInvalidValue, "expect \"false\", \"true\" or \"unexpected\"")
+			}
+		default:
+			v.add(section, "AutoRestart", value, ErrInvalidType, "expect bool or string, got %T", value)
+		}
+	}
+
+	// Command settings // 命令设置
+	if p.Executable.IsSet() && p.Executable.Get() == "" {
+		v.add(section, "Executable", p.Executable.Get(), ErrRequired, "executable path is empty")
+	}
+	if p.BinName.IsSet() && (p.BinName.Get() == "" || strings.ContainsRune(p.BinName.Get(), '/')) {
+		v.add(section, "BinName", p.BinName.Get(), ErrInvalidValue, "binary name must be a non-empty file name")
+	}
+	if p.Wrapper.IsSet() && len(p.Wrapper.Get()) > 0 && p.Wrapper.Get()[0] == "" {
+		v.add(section, "Wrapper", p.Wrapper.Get(), ErrInvalidValue, "wrapper command is empty")
+	}
+	for _, arg := range slices.Concat(p.Wrapper.Get(), []string{p.Executable.Get()}, p.Args.Get()) {
+		if strings.ContainsAny(arg, "\n\r\x00") {
+			v.add(section, "Args", arg, ErrInvalidValue, "command argument %q contains line break or NUL", arg)
+		}
+	}
+
+	// Environment variables // 环境变量
+	checkEnvironment(v, section, p.Environment.Get())
+
+	// Counters and timeouts // 计数和超时
+	checkMinInt(v, section, "StartRetries", p.StartRetries.Get(), 0)
+	checkMinInt(v, section, "StartSecs", p.StartSecs.Get(), 0)
+	checkMinInt(v, section, "LogBackups", p.LogBackups.Get(), 0)
+	checkMinInt(v, section, "StopWaitSecs", p.StopWaitSecs.Get(), 0)
+
+	// Log settings // 日志设置
+	if _, err := ParseByteSize(p.LogMaxBytes.Get()); err != nil {
+		v.add(section, "LogMaxBytes", p.LogMaxBytes.Get(), ErrInvalidValue, "%s", err.Error())
+	}
+
+	// Advanced process control // 高级进程控制
+	if !IsValidSignal(p.StopSignal.Get()) {
+		v.add(section, "StopSignal", p.StopSignal.Get(), ErrInvalidValue, "unknown signal %q, expect one of %s", p.StopSignal.Get(), strings.Join(supervisorSignals, ", "))
+	}
+	if len(p.ExitCodes.Get()) == 0 {
+		v.add(section, "ExitCodes", p.ExitCodes.Get(), ErrRequired, "exit codes list is empty")
+	}
+	for _, code := range p.ExitCodes.Get() {
+		if code < 0 || code > 255 {
+			v.add(section, "ExitCodes", code, ErrOutOfRange, "exit code %d is not within 0-255", code)
+		}
+	}
+
+	// Multi-instance settings // 多实例设置
+	checkMinInt(v, section, "NumProcs", p.NumProcs.Get(), 1)
+	if p.ProcessName.Get() == "" {
+		v.add(section, "ProcessName", p.ProcessName.Get(), ErrRequired, "process name template is empty")
+	} else if err := checkExpansions(p.ProcessName.Get()); err != nil {
+		v.add(section, "ProcessName", p.ProcessName.Get(), ErrInvalidValue, "%s", err.Error())
+	}
+	if p.NumProcs.Get() > 1 && !strings.Contains(p.ProcessName.Get(), "%(process_num)") {
+		v.add(section, "ProcessName", p.ProcessName.Get(), ErrInvalidValue, "numprocs = %d requires process name containing %%(process_num)", p.NumProcs.Get())
+	}
+
+	// Health check and ports // 健康检查和端口
+	if p.HealthCheck != nil {
+		p.HealthCheck.validateFields(v, section, p.Ports != nil)
+	}
+	if p.Ports != nil {
+		p.Ports.validateFields(v, section, p.NumProcs.Get())
+	}
+}
+
+// envNameRegexp valid environment variable name
+// 有效的环境变量名称
+var envNameRegexp = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+func checkMinInt(v *validator, section string, field string, value int, min int) {
+	if value < min {
+		v.add(section, field, value, ErrOutOfRange, "%d is less than %d", value, min)
+	}
+}
+
+// supervisorSignals signal names accepted by supervisor stopsignal
+// supervisor stopsignal 接受的信号名称
+var supervisorSignals = []string{"TERM", "HUP", "INT", "QUIT", "KILL", "USR1", "USR2"}
+
+// IsValidSignal check signal name is accepted by supervisor, case-insensitive with optional "SIG" prefix
+// 检查信号名称是否被 supervisor 接受，不区分大小写，可带 "SIG" 前缀
+func IsValidSignal(name string) bool {
+	return slices.Contains(supervisorSignals, signalName(name))
+}
+
+// signalName normalize signal name to the upper case form without "SIG" prefix, like "INT"
+// 将信号名称规范化为不带 "SIG" 前缀的大写形式，例如 "INT"
+func signalName(name string) string {
+	return strings.TrimPrefix(strings.ToUpper(name), "SIG")
+}
+
+// ParseByteSize parse supervisor byte size like "50MB", "1GB", "1024" into bytes
+// Suffixes KB/MB/GB are case-insensitive and use 1024 multiplier, 0 means unlimited
+//
+// 解析 supervisor 字节大小（如 "50MB"、"1GB"、"1024"）为字节数
+// 后缀 KB/MB/GB 不区分大小写，按 1024 进制计算，0 表示不限制
+func ParseByteSize(value string) (int64, error) {
+	text := strings.ToUpper(strings.TrimSpace(value))
+	multiplier := int64(1)
+	for _, unit := range []struct {
+		suffix     string
+		multiplier int64
+	}{
+		{"KB", 1 << 10},
+		{"MB", 1 << 20},
+		{"GB", 1 << 30},
+	} {
+		if strings.HasSuffix(text, unit.suffix) {
+			text = strings.TrimSuffix(text, unit.suffix)
+			multiplier = unit.multiplier
+			break
+		}
+	}
+	num, err := strconv.ParseInt(text, 10, 64)
+	if err != nil || num < 0 {
+		return 0, errors.Errorf("invalid byte size %q, expect like \"50MB\", \"1GB\" or \"1024\"", value)
+	}
+	return num * multiplier, nil
+}
+
+// sectionNameReason reason reported for names failing isValidSectionName
+// 名称未通过 isValidSectionName 时报告的原因
+const sectionNameReason = "name must not be \".\" or \"..\" or contain blanks, \":\", \"[\", \"]\", \"%%\", \"/\" or \"\\\""
+
+// isValidSectionName check name can be used in a section header and as the <name>.conf file name
+// 检查名称能否用于段头以及 <name>.conf 文件名
+func isValidSectionName(name string) bool {
+	return name != "" && name != "." && name != ".." && !strings.ContainsAny(name, " \t\n:[]%/\\")
+}
+
+// expansionNames names supervisor expands in %(name)s expressions
+// supervisor 在 %(name)s 表达式中展开的名称
+var expansionNames = []string{"program_name", "process_num", "group_name", "host_node_name", "numprocs", "here"}
+
+// checkEnvironment check names and values of environment rendered by combineEnvironment
+// supervisor's lexer strips outer quotes and has no escapes, so some values can't be written at all
+//
+// 检查由 combineEnvironment 渲染的环境变量的名称和值
+// supervisor 的词法分析器会去掉外层引号且没有转义，因此有些值根本无法写出
+func checkEnvironment(v *validator, section string, environment map[string]string) {
+	for _, key := range sortedKeys(environment) {
+		if !envNameRegexp.MatchString(key) {
+			v.add(section, "Environment", key, ErrInvalidValue, "invalid variable name %q, expect letters, digits and \"_\" not starting with digit", key)
+		}
+		if value := environment[key]; strings.ContainsAny(value, "\n\r\x00") {
+			v.add(section, "Environment", value, ErrInvalidValue, "value of %q contains line break or NUL", key)
+		} else if strings.Contains(value, `"`) && strings.Contains(value, "'") || strings.Trim(value, `'"`) != value {
+			v.add(section, "Environment", value, ErrInvalidValue, "value of %q can't be quoted for supervisor, which strips outer quotes and has no escapes", key)
+		}
+	}
+}
+
+// checkExpansions check %(name)s expressions use known names, "%%" is literal percent
+// ENV_ prefixed names refer to supervisord environment variables
+//
+// 检查 %(name)s 表达式使用的是已知名称，"%%" 表示百分号字面量
+// ENV_ 前缀的名称引用 supervisord 的环境变量
+func checkExpansions(value string) error {
+	for i := 0; i < len(value); i++ {
+		if value[i] != '%' {
+			continue
+		}
+		if i+1 < len(value) && value[i+1] == '%' {
+			i++
+			continue
+		}
+		name, size, ok := scanExpansion(value[i:])
+		if !ok {
+			return errors.Errorf("invalid %%-expression at %q, use %%%% for a literal percent", value[i:])
+		}
+		if !slices.Contains(expansionNames, name) && !strings.HasPrefix(name, "ENV_") {
+			return errors.Errorf("unknown expansion name %q", name)
+		}
+		i += size - 1
+	}
+	return nil
+}
+
+// scanExpansion scan a %(name)<flags><conv> expression at the start of value
+// 扫描 value 开头的 %(name)<flags><conv> 表达式
+func scanExpansion(value string) (name string, size int, ok bool) {
+	if !strings.HasPrefix(value, "%(") {
+		return "", 0, false
+	}
+	end := strings.IndexByte(value, ')')
+	if end < 0 {
+		return "", 0, false
+	}
+	name = value[2:end]
+	pos := end + 1
+	for pos < len(value) && strings.IndexByte("#0- +123456789.", value[pos]) >= 0 {
+		pos++
+	}
+	if pos >= len(value) || strings.IndexByte("sdixXorf", value[pos]) < 0 || name == "" {
+		return "", 0, false
+	}
+	return name, pos + 1, true
+}
+
+// Validate check group config and its programs, return *ValidationError listing every invalid field
+// 校验组配置及其程序，返回列出每个无效字段的 *ValidationError
+func (g *GroupConfig) Validate() error {
+	if g == nil {
+		return &ValidationError{Errors: []*FieldError{{Section: "group", Field: "GroupConfig", Err: ErrRequired, Reason: "nil config"}}}
+	}
+	v := &validator{}
+	g.validateFields(v)
+	return v.result()
+}
+
+func (g *GroupConfig) validateFields(v *validator) {
+	section := "group:" + g.Name
+	errCount := len(v.errs)
+	if g.Name == "" {
+		v.add(section, "Name", g.Name, ErrRequired, "group name is empty")
+	} else if !isValidSectionName(g.Name) {
+		v.add(section, "Name", g.Name, ErrInvalidValue, sectionNameReason)
+	}
+	if len(g.Programs) == 0 {
+		v.add(section, "Programs", nil, ErrRequired, "group has no programs")
+	}
+	names := make(map[string]bool, len(g.Programs))
+	for idx, program := range g.Programs {
+		if program == nil {
+			v.add(section, fmt.Sprintf("Programs[%d]", idx), nil, ErrRequired, "nil program")
+			continue
+		}
+		if names[program.Name] {
+			v.add(section, fmt.Sprintf("Programs[%d]", idx), program.Name, ErrDuplicate, "program %q is listed twice", program.Name)
+		}
+		names[program.Name] = true
+		program.validateFields(v, "program:"+program.Name)
+	}
+	// Event listeners and fcgi programs are process groups of their own, names must not clash
+	// 事件监听器和 fcgi 程序各自是独立的进程组，名称不能冲突
+	groupNames := map[string]bool{g.Name: true}
+	for idx, listener := range g.EventListeners {
+		if listener == nil || listener.ProgramConfig == nil {
+			v.add(section, fmt.Sprintf("EventListeners[%d]", idx), nil, ErrRequired, "nil event listener")
+			continue
+		}
+		if groupNames[listener.Name] {
+			v.add(section, fmt.Sprintf("EventListeners[%d]", idx), listener.Name, ErrDuplicate, "process group name %q is used twice", listener.Name)
+		}
+		groupNames[listener.Name] = true
+		listener.validateFields(v)
+	}
+	for idx, program := range g.FcgiPrograms {
+		if program == nil || program.ProgramConfig == nil {
+			v.add(section, fmt.Sprintf("FcgiPrograms[%d]", idx), nil, ErrRequired, "nil fcgi program")
+			continue
+		}
+		if groupNames[program.Name] {
+			v.add(section, fmt.Sprintf("FcgiPrograms[%d]", idx), program.Name, ErrDuplicate, "process group name %q is used twice", program.Name)
+		}
+		if names[program.Name] {
+			v.add(section, fmt.Sprintf("FcgiPrograms[%d]", idx), program.Name, ErrDuplicate, "name %q is both a program and an fcgi program", program.Name)
+		}
+		groupNames[program.Name] = true
+		program.validateFields(v)
+	}
+	g.checkPortCollisions(v)
+
+	// Expanded instance sections must not clash with other program sections of the group
+	// 展开的实例段不能与组内其他程序段冲突
+	if len(v.errs) == errCount {
+		sectionNames := make(map[string]bool, len(g.Programs))
+		for _, program := range g.programSections() {
+			if sectionNames[program.Name] {
+				v.add(section, "Programs", program.Name, ErrDuplicate, "section name %q is used twice after expanding instances", program.Name)
+			}
+			sectionNames[program.Name] = true
+		}
+	}
+}
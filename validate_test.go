@@ -0,0 +1,220 @@
+package supervisorkratos_test
+
+import (
+	"testing"
+
+	"github.com/orzkratos/supervisorkratos"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGenerateProgramConfigE(t *testing.T) {
+	// Test error-returning generation gives same output as panicking variant
+	// 测试返回错误的生成函数与 panic 版本输出一致
+	program := supervisorkratos.NewProgramConfig(
+		"myapp",
+		"/opt/myapp",
+		"deploy",
+		"/var/log/myapp",
+	).WithStartRetries(10)
+
+	content, err := supervisorkratos.GenerateProgramConfigE(program)
+	require.NoError(t, err)
+	require.Equal(t, supervisorkratos.GenerateProgramConfig(program), content)
+}
+
+func TestGenerateProgramConfigEInvalid(t *testing.T) {
+	// Test every invalid field is reported instead of panic
+	// 测试报告每个无效字段而不是 panic
+	program := supervisorkratos.NewProgramConfig(
+		"myapp",
+		"/opt/myapp",
+		"deploy",
+		"/var/log/myapp",
+	)
+	program.UserName = ""
+	program.AutoRestart.Set(3)
+
+	_, err := supervisorkratos.GenerateProgramConfigE(program)
+	require.Error(t, err)
+	t.Log(err)
+
+	var verr *supervisorkratos.ValidationError
+	require.True(t, errors.As(err, &verr))
+	require.Len(t, verr.Errors, 2)
+	require.Equal(t, "UserName", verr.Errors[0].Field)
+	require.ErrorIs(t, verr.Errors[0], supervisorkratos.ErrRequired)
+	require.Equal(t, "AutoRestart", verr.Errors[1].Field)
+	require.ErrorIs(t, verr.Errors[1], supervisorkratos.ErrInvalidType)
+	require.ErrorIs(t, err, supervisorkratos.ErrInvalidType)
+
+	require.Panics(t, func() {
+		supervisorkratos.GenerateProgramConfig(program)
+	})
+}
+
+func TestGenerateProgramConfigENilOptions(t *testing.T) {
+	// Test config created without constructor reports nil options
+	// 测试未使用构造函数创建的配置会报告 nil 选项
+	program := &supervisorkratos.ProgramConfig{
+		Name:     "raw",
+		UserName: "deploy",
+		Root:     "/opt/raw",
+		SlogRoot: "/var/log/raw",
+	}
+	_, err := supervisorkratos.GenerateProgramConfigE(program)
+	require.ErrorIs(t, err, supervisorkratos.ErrRequired)
+
+	_, err = supervisorkratos.GenerateProgramConfigE(nil)
+	require.ErrorIs(t, err, supervisorkratos.ErrRequired)
+}
+
+func TestGenerateGroupConfigEInvalid(t *testing.T) {
+	// Test group errors are aggregated per program
+	// 测试组错误会按程序汇总
+	program1 := supervisorkratos.NewProgramConfig(
+		"api",
+		"/opt/api",
+		"deploy",
+		"/var/log/services",
+	)
+	program1.Root = ""
+
+	program2 := supervisorkratos.NewProgramConfig(
+		"worker",
+		"/opt/worker",
+		"deploy",
+		"/var/log/services",
+	)
+	program2.AutoRestart.Set("always")
+
+	group := supervisorkratos.NewGroupConfig("services").
+		AddProgram(program1).
+		AddProgram(program2).
+		AddProgram(program2)
+
+	_, err := supervisorkratos.GenerateGroupConfigE(group)
+	require.Error(t, err)
+	t.Log(err)
+
+	var verr *supervisorkratos.ValidationError
+	require.True(t, errors.As(err, &verr))
+	require.Len(t, verr.Section("program:api"), 1)
+	require.Equal(t, "Root", verr.Section("program:api")[0].Field)
+	require.Len(t, verr.Section("program:worker"), 2)
+	require.ErrorIs(t, verr.Section("program:worker")[0], supervisorkratos.ErrInvalidValue)
+	require.Len(t, verr.Section("group:services"), 1)
+	require.ErrorIs(t, verr.Section("group:services")[0], supervisorkratos.ErrDuplicate)
+
+	_, err = supervisorkratos.GenerateGroupConfigE(&supervisorkratos.GroupConfig{Name: "empty"})
+	require.ErrorIs(t, err, supervisorkratos.ErrRequired)
+}
+
+func TestValidateNamesStayInDir(t *testing.T) {
+	// Test program and group names that would leave the conf.d directory are rejected
+	// 测试会离开 conf.d 目录的程序和组名称被拒绝
+	for _, name := range []string{"../escape", "a/b", `a\b`, ".", ".."} {
+		program := supervisorkratos.NewProgramConfig("api", "/opt/api", "deploy", "/var/log/services")
+		program.Name = name
+		require.ErrorIs(t, program.Validate(), supervisorkratos.ErrInvalidValue, name)
+
+		group := supervisorkratos.NewGroupConfig("services").AddProgram(supervisorkratos.NewProgramConfig("api", "/opt/api", "deploy", "/var/log/services"))
+		group.Name = name
+		require.ErrorIs(t, group.Validate(), supervisorkratos.ErrInvalidValue, name)
+	}
+}
+
+func TestProgramConfigValidate(t *testing.T) {
+	// Test each field value mistake is reported with its field name and kind
+	// 测试每个字段值错误都会报告字段名称和错误类型
+	newProgram := func() *supervisorkratos.ProgramConfig {
+		return supervisorkratos.NewProgramConfig(
+			"myapp",
+			"/opt/myapp",
+			"deploy",
+			"/var/log/myapp",
+		)
+	}
+
+	testCases := []struct {
+		name   string
+		config *supervisorkratos.ProgramConfig
+		field  string
+		kind   error
+	}{
+		{"name with colon", supervisorkratos.NewProgramConfig("my:app", "/opt/myapp", "deploy", "/var/log/myapp"), "Name", supervisorkratos.ErrInvalidValue},
+		{"relative root", supervisorkratos.NewProgramConfig("myapp", "opt/myapp", "deploy", "/var/log/myapp"), "Root", supervisorkratos.ErrInvalidValue},
+		{"relative log root", supervisorkratos.NewProgramConfig("myapp", "/opt/myapp", "deploy", "logs"), "SlogRoot", supervisorkratos.ErrInvalidValue},
+		{"user with blank", supervisorkratos.NewProgramConfig("myapp", "/opt/myapp", "de ploy", "/var/log/myapp"), "UserName", supervisorkratos.ErrInvalidValue},
+		{"unknown signal", newProgram().WithStopSignal("STOP"), "StopSignal", supervisorkratos.ErrInvalidValue},
+		{"bad log size", newProgram().WithLogMaxBytes("50 megabytes"), "LogMaxBytes", supervisorkratos.ErrInvalidValue},
+		{"negative log size", newProgram().WithLogMaxBytes("-1MB"), "LogMaxBytes", supervisorkratos.ErrInvalidValue},
+		{"negative retries", newProgram().WithStartRetries(-1), "StartRetries", supervisorkratos.ErrOutOfRange},
+		{"negative start secs", newProgram().WithStartSecs(-1), "StartSecs", supervisorkratos.ErrOutOfRange},
+		{"negative stop wait", newProgram().WithStopWaitSecs(-5), "StopWaitSecs", supervisorkratos.ErrOutOfRange},
+		{"negative backups", newProgram().WithLogBackups(-2), "LogBackups", supervisorkratos.ErrOutOfRange},
+		{"exit code too large", newProgram().WithExitCodes([]int{0, 256}), "ExitCodes", supervisorkratos.ErrOutOfRange},
+		{"empty exit codes", newProgram().WithExitCodes([]int{}), "ExitCodes", supervisorkratos.ErrRequired},
+		{"zero numprocs", newProgram().WithNumProcs(0), "NumProcs", supervisorkratos.ErrOutOfRange},
+		{"numprocs without process_num", newProgram().WithNumProcs(2), "ProcessName", supervisorkratos.ErrInvalidValue},
+		{"unknown expansion", newProgram().WithProcessName("%(program)s"), "ProcessName", supervisorkratos.ErrInvalidValue},
+		{"bare percent", newProgram().WithProcessName("app%"), "ProcessName", supervisorkratos.ErrInvalidValue},
+		{"empty env name", newProgram().WithEnvironment(map[string]string{"": "x"}), "Environment", supervisorkratos.ErrInvalidValue},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			err := tc.config.Validate()
+			require.Error(t, err)
+			t.Log(err)
+
+			var verr *supervisorkratos.ValidationError
+			require.True(t, errors.As(err, &verr))
+			require.Len(t, verr.Errors, 1)
+			require.Equal(t, tc.field, verr.Errors[0].Field)
+			require.ErrorIs(t, verr.Errors[0], tc.kind)
+		})
+	}
+}
+
+func TestProgramConfigValidateAccepts(t *testing.T) {
+	// Test values accepted by supervisor pass validation
+	// 测试 supervisor 接受的值能通过校验
+	program := supervisorkratos.NewProgramConfig(
+		"myapp",
+		"/opt/myapp",
+		"deploy",
+		"/var/log/myapp",
+	).WithStopSignal("sigusr1").
+		WithLogMaxBytes("1gb").
+		WithExitCodes([]int{0, 255}).
+		WithNumProcs(4).
+		WithProcessName("%(program_name)s_%(process_num)02d").
+		WithStartRetries(0).
+		WithAutoRestartMode("unexpected")
+	require.NoError(t, program.Validate())
+}
+
+func TestParseByteSize(t *testing.T) {
+	// Test byte sizes use supervisor suffix multipliers
+	// 测试字节大小使用 supervisor 的后缀倍数
+	testCases := map[string]int64{
+		"0":     0,
+		"1024":  1024,
+		"50MB":  50 << 20,
+		"50mb":  50 << 20,
+		"1GB":   1 << 30,
+		"64KB":  64 << 10,
+		" 2MB ": 2 << 20,
+	}
+	for value, expected := range testCases {
+		size, err := supervisorkratos.ParseByteSize(value)
+		require.NoError(t, err)
+		require.Equal(t, expected, size)
+	}
+
+	for _, value := range []string{"", "MB", "1.5GB", "1TB", "-1"} {
+		_, err := supervisorkratos.ParseByteSize(value)
+		require.Error(t, err)
+	}
+}
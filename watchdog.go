@@ -0,0 +1,253 @@
+package supervisorkratos
+
+import (
+	"bufio"
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/orzkratos/supervisorkratos/supervisorrpc"
+	"github.com/pkg/errors"
+)
+
+// WatchdogListener event listener running the program health check inside supervisord
+// watchdogPath is a binary calling RunWatchdog, it restarts instances failing Threshold checks in a row
+// Add the listener to the group with GroupConfig.AddEventListener
+//
+// 在 supervisord 中执行程序健康检查的事件监听器
+// watchdogPath 是调用 RunWatchdog 的二进制文件，连续 Threshold 次检查失败的实例会被重启
+// 使用 GroupConfig.AddEventListener 将监听器加入组
+func (p *ProgramConfig) WatchdogListener(groupName string, watchdogPath string) (*EventListenerConfig, error) {
+	if err := p.Validate(); err != nil {
+		return nil, err
+	}
+	if p.HealthCheck == nil {
+		return nil, errors.Errorf("program %s has no health check", p.Name)
+	}
+	check := p.HealthCheck
+
+	// Ticks are the only clock of a listener, pick the finest one the interval needs
+	// tick 是监听器唯一的时钟，选择间隔所需的最细粒度
+	event := EventTick3600
+	if check.Interval < time.Minute {
+		event = EventTick5
+	} else if check.Interval < time.Hour {
+		event = EventTick60
+	}
+
+	args := []string{"-kind", string(check.Kind)}
+	if check.Path != "" {
+		args = append(args, "-path", check.Path)
+	}
+	if check.Service != "" {
+		args = append(args, "-service", check.Service)
+	}
+	args = append(args,
+		"-interval", check.Interval.String(),
+		"-timeout", check.Timeout.String(),
+		"-threshold", strconv.Itoa(check.Threshold),
+	)
+	// The listener runs on the host of supervisord, which expands %(host_node_name)s there
+	// 监听器运行在 supervisord 所在主机上，由其在该主机展开 %(host_node_name)s
+	for num, name := range p.ProcessNames(groupName) {
+		args = append(args, "-target", name+"="+p.expandHealthAddress(groupName, num, ""))
+	}
+	if check.Kind == HealthCheckExec {
+		args = append(append(args, "--"), check.Command...)
+	}
+
+	listener := NewEventListenerConfig(p.Name+"-watchdog", p.Root, p.UserName, p.SlogRoot, event)
+	listener.WithExecutable(watchdogPath).WithArgs(args...)
+	if err := listener.Validate(); err != nil {
+		return nil, err
+	}
+	return listener, nil
+}
+
+// WatchdogTarget process watched by Watchdog
+// Watchdog 监视的进程
+type WatchdogTarget struct {
+	Process string // Process name "group:name" // 进程名称 "group:name"
+	Address string // Expanded instance address // 展开后的实例地址
+}
+
+// Watchdog event listener restarting RUNNING processes that fail the health check Threshold times in a row
+// Watchdog 事件监听器，重启连续 Threshold 次未通过健康检查的 RUNNING 进程
+type Watchdog struct {
+	Check    *HealthCheck      // Health check run on each target // 对每个目标执行的健康检查
+	Targets  []*WatchdogTarget // Watched processes // 监视的进程
+	Log      io.Writer         // Log of failures and restarts, stderr goes to the listener log // 失败和重启的日志，stderr 会写入监听器日志
+	failures map[string]int
+	last     time.Time
+}
+
+// ParseWatchdogArgs parse the arguments rendered by WatchdogListener
+// 解析 WatchdogListener 渲染的参数
+func ParseWatchdogArgs(args []string) (*Watchdog, error) {
+	flags := flag.NewFlagSet("watchdog", flag.ContinueOnError)
+	flags.SetOutput(io.Discard)
+	kind := flags.String("kind", "", "health check kind")
+	path := flags.String("path", "", "HTTP GET path")
+	service := flags.String("service", "", "gRPC health service")
+	interval := flags.Duration("interval", 10*time.Second, "interval between checks")
+	timeout := flags.Duration("timeout", 5*time.Second, "timeout of one check")
+	threshold := flags.Int("threshold", 3, "consecutive failures before restart")
+	var targets []*WatchdogTarget
+	flags.Func("target", "process=address", func(value string) error {
+		process, address, ok := strings.Cut(value, "=")
+		if !ok || process == "" {
+			return errors.Errorf("expect process=address, got %q", value)
+		}
+		targets = append(targets, &WatchdogTarget{Process: process, Address: address})
+		return nil
+	})
+	if err := flags.Parse(args); err != nil {
+		return nil, errors.WithMessage(err, "parse watchdog args")
+	}
+
+	check := &HealthCheck{
+		Kind:      HealthCheckKind(*kind),
+		Path:      *path,
+		Service:   *service,
+		Command:   flags.Args(),
+		Interval:  *interval,
+		Timeout:   *timeout,
+		Threshold: *threshold,
+	}
+	if len(targets) == 0 {
+		return nil, errors.Errorf("watchdog has no -target")
+	}
+	// Validate with the address of the first target, the others come from the same template
+	// 使用第一个目标的地址校验，其他地址来自同一模板
+	check.Address = targets[0].Address
+	v := &validator{}
+	check.validateFields(v, "watchdog", false)
+	if err := v.result(); err != nil {
+		return nil, err
+	}
+	check.Address = ""
+	return &Watchdog{Check: check, Targets: targets, Log: os.Stderr, failures: map[string]int{}}, nil
+}
+
+// RunWatchdog entry of a watchdog binary, reads the arguments and talks to supervisord at $SUPERVISOR_SERVER_URL
+// RunWatchdog 是 watchdog 二进制文件的入口，读取参数并连接 $SUPERVISOR_SERVER_URL 上的 supervisord
+func RunWatchdog(ctx context.Context) error {
+	watchdog, err := ParseWatchdogArgs(os.Args[1:])
+	if err != nil {
+		return err
+	}
+	client, err := supervisorrpc.NewClient(os.Getenv("SUPERVISOR_SERVER_URL"))
+	if err != nil {
+		return errors.WithMessage(err, "connect supervisord")
+	}
+	return watchdog.Serve(ctx, os.Stdin, os.Stdout, client)
+}
+
+// Serve speak the supervisor event listener protocol on in and out until in is closed or ctx is done
+// Each TICK event runs the checks once Interval has passed since the last run
+//
+// 在 in 和 out 上使用 supervisor 事件监听器协议，直到 in 关闭或 ctx 结束
+// 每个 TICK 事件在距上次执行超过 Interval 后执行一次检查
+func (w *Watchdog) Serve(ctx context.Context, in io.Reader, out io.Writer, client ProcessClient) error {
+	reader := bufio.NewReader(in)
+	for ctx.Err() == nil {
+		if _, err := io.WriteString(out, "READY\n"); err != nil {
+			return err
+		}
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			if err == io.EOF && line == "" {
+				return nil
+			}
+			return errors.WithMessage(err, "read event header")
+		}
+		header := parseEventTokens(line)
+		size, err := strconv.Atoi(header["len"])
+		if err != nil {
+			return errors.Errorf("bad event header %q", strings.TrimSpace(line))
+		}
+		payload := make([]byte, size)
+		if _, err := io.ReadFull(reader, payload); err != nil {
+			return errors.WithMessage(err, "read event payload")
+		}
+
+		if strings.HasPrefix(header["eventname"], "TICK_") {
+			now := time.Now()
+			if when, err := strconv.ParseInt(parseEventTokens(string(payload))["when"], 10, 64); err == nil {
+				now = time.Unix(when, 0)
+			}
+			if now.Sub(w.last) >= w.Check.Interval {
+				w.last = now
+				w.checkTargets(ctx, client)
+			}
+		}
+		if _, err := io.WriteString(out, "RESULT 2\nOK"); err != nil {
+			return err
+		}
+	}
+	return ctx.Err()
+}
+
+// checkTargets check every RUNNING target, restart the ones reaching Threshold failures
+// 检查每个 RUNNING 目标，重启失败次数达到 Threshold 的目标
+func (w *Watchdog) checkTargets(ctx context.Context, client ProcessClient) {
+	if w.failures == nil {
+		w.failures = map[string]int{}
+	}
+	for _, target := range w.Targets {
+		info, err := client.GetProcessInfo(ctx, target.Process)
+		if err != nil {
+			w.logf("get process info %s: %v", target.Process, err)
+			continue
+		}
+		// Starting, stopped and backoff processes are supervisord's job
+		// 启动中、已停止和退避中的进程由 supervisord 处理
+		if info.State != supervisorrpc.ProcessRunning {
+			w.failures[target.Process] = 0
+			continue
+		}
+		err = w.Check.Check(ctx, target.Process, target.Address)
+		if err == nil {
+			w.failures[target.Process] = 0
+			continue
+		}
+		w.failures[target.Process]++
+		w.logf("health check %s failed %d/%d: %v", target.Process, w.failures[target.Process], w.Check.Threshold, err)
+		if w.failures[target.Process] < w.Check.Threshold {
+			continue
+		}
+		w.failures[target.Process] = 0
+		if err := client.StopProcess(ctx, target.Process, true); err != nil && !supervisorrpc.IsFault(err, supervisorrpc.FaultNotRunning) {
+			w.logf("stop %s: %v", target.Process, err)
+			continue
+		}
+		if err := client.StartProcess(ctx, target.Process, false); err != nil {
+			w.logf("start %s: %v", target.Process, err)
+			continue
+		}
+		w.logf("restarted %s", target.Process)
+	}
+}
+
+func (w *Watchdog) logf(format string, args ...any) {
+	if w.Log != nil {
+		_, _ = fmt.Fprintf(w.Log, format+"\n", args...)
+	}
+}
+
+// parseEventTokens parse "key:value key:value" of event headers and TICK payloads
+// 解析事件头和 TICK 负载中的 "key:value key:value"
+func parseEventTokens(line string) map[string]string {
+	res := make(map[string]string)
+	for _, token := range strings.Fields(line) {
+		if key, value, ok := strings.Cut(token, ":"); ok {
+			res[key] = value
+		}
+	}
+	return res
+}
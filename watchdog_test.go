@@ -0,0 +1,87 @@
+package supervisorkratos_test
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/orzkratos/supervisorkratos"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWatchdogListener(t *testing.T) {
+	// Test watchdog listener renders a target per instance and parses back
+	// 测试 watchdog 监听器为每个实例渲染一个目标，并能解析回来
+	program := supervisorkratos.NewProgramConfig("api", "/opt/api", "deploy", "/var/log/services").
+		WithNumProcs(2).
+		WithProcessName("%(program_name)s_%(process_num)d").
+		WithHealthCheck(supervisorkratos.NewHTTPHealthCheck("127.0.0.1:80%(process_num)02d", "/healthz"))
+
+	listener, err := program.WatchdogListener("services", "/opt/watchdog/bin/watchdog")
+	require.NoError(t, err)
+	require.Equal(t, "api-watchdog", listener.Name)
+	require.Equal(t, []supervisorkratos.EventType{supervisorkratos.EventTick5}, listener.Events)
+
+	config := supervisorkratos.GenerateEventListenerConfig(listener)
+	t.Log(config)
+	require.Contains(t, config, "[eventlistener:api-watchdog]")
+	require.Contains(t, config, "command         = /opt/watchdog/bin/watchdog -kind http -path /healthz -interval 10s -timeout 5s -threshold 3 -target services:api_0=127.0.0.1:8000 -target services:api_1=127.0.0.1:8001")
+	require.Contains(t, config, "events          = TICK_5")
+
+	watchdog, err := supervisorkratos.ParseWatchdogArgs(listener.Args.Get())
+	require.NoError(t, err)
+	require.Equal(t, supervisorkratos.HealthCheckHTTP, watchdog.Check.Kind)
+	require.Equal(t, "/healthz", watchdog.Check.Path)
+	require.Equal(t, 10*time.Second, watchdog.Check.Interval)
+	require.Equal(t, []*supervisorkratos.WatchdogTarget{
+		{Process: "services:api_0", Address: "127.0.0.1:8000"},
+		{Process: "services:api_1", Address: "127.0.0.1:8001"},
+	}, watchdog.Targets)
+
+	_, err = supervisorkratos.NewProgramConfig("web", "/opt/web", "deploy", "/var/log/services").WatchdogListener("", "/opt/watchdog/bin/watchdog")
+	require.ErrorContains(t, err, "no health check")
+
+	// The host name is left for supervisord on the target host, not the host rendering the config
+	// 主机名留给目标主机上的 supervisord，而不是渲染配置的主机
+	hostName, err := os.Hostname()
+	require.NoError(t, err)
+	program = supervisorkratos.NewProgramConfig("web", "/opt/web", "deploy", "/var/log/services").
+		WithHealthCheck(supervisorkratos.NewHTTPHealthCheck("%(host_node_name)s:8080", "/healthz"))
+	listener, err = program.WatchdogListener("", "/opt/watchdog/bin/watchdog")
+	require.NoError(t, err)
+	config = supervisorkratos.GenerateEventListenerConfig(listener)
+	require.Contains(t, config, "-target web:web=%(host_node_name)s:8080")
+	require.NotContains(t, config, hostName+":8080")
+}
+
+func TestWatchdogServe(t *testing.T) {
+	// Test watchdog restarts a RUNNING process after threshold failed ticks and answers every event
+	// 测试 watchdog 在连续多次 tick 检查失败后重启 RUNNING 进程，并应答每个事件
+	program := supervisorkratos.NewProgramConfig("api", "/opt/api", "deploy", "/var/log/services").
+		WithHealthCheck(supervisorkratos.NewExecHealthCheck("false").WithThreshold(2))
+	listener, err := program.WatchdogListener("", "/opt/watchdog/bin/watchdog")
+	require.NoError(t, err)
+	require.Equal(t, []string{"-kind", "exec", "-interval", "10s", "-timeout", "5s", "-threshold", "2", "-target", "api:api=", "--", "false"}, listener.Args.Get())
+	watchdog, err := supervisorkratos.ParseWatchdogArgs(listener.Args.Get())
+	require.NoError(t, err)
+	watchdog.Log = &bytes.Buffer{}
+
+	// Ticks at 0s, 5s and 10s, the 5s one is within the interval
+	// 在 0s、5s 和 10s 的 tick，5s 的那次在间隔之内
+	var in strings.Builder
+	for _, when := range []int{1700000000, 1700000005, 1700000010} {
+		payload := fmt.Sprintf("when:%d", when)
+		in.WriteString(fmt.Sprintf("ver:3.0 server:supervisor serial:1 pool:api-watchdog poolserial:1 eventname:TICK_5 len:%d\n%s", len(payload), payload))
+	}
+	var out bytes.Buffer
+	client := newFakeProcesses()
+	client.polls["api:api"] = 1 // Already RUNNING // 已经是 RUNNING
+	require.NoError(t, watchdog.Serve(context.Background(), strings.NewReader(in.String()), &out, client))
+	require.Equal(t, strings.Repeat("READY\nRESULT 2\nOK", 3)+"READY\n", out.String())
+	require.Equal(t, []string{"stop api:api", "start api:api"}, client.calls)
+	require.Contains(t, watchdog.Log.(*bytes.Buffer).String(), "restarted api:api")
+}